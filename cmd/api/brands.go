@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/validator"
+	"net/http"
+	"strings"
+)
+
+// POST "/v1/brands"
+func (app *application) createBrandHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string `json:"name"`
+		Slug        string `json:"slug"`
+		Country     string `json:"country"`
+		Description string `json:"description"`
+		LogoURL     string `json:"logo_url"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	brand := &data.Brand{
+		Name:        input.Name,
+		Slug:        input.Slug,
+		Country:     input.Country,
+		Description: input.Description,
+		LogoURL:     input.LogoURL,
+	}
+	if brand.Slug == "" {
+		brand.Slug = data.Slugify(brand.Name)
+	}
+
+	v := validator.New()
+	if data.ValidateBrand(v, brand); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Brands.Insert(r.Context(), brand)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateBrand):
+			v.AddError("name", "a brand with this name or slug already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/brands/%d", brand.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"brand": brand}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GET "/v1/brands/:id"
+func (app *application) showBrandHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	brand, err := app.models.Brands.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"brand": brand}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// PATCH "/v1/brands/:id"
+func (app *application) updateBrandHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	brand, err := app.models.Brands.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name"`
+		Slug        *string `json:"slug"`
+		Country     *string `json:"country"`
+		Description *string `json:"description"`
+		LogoURL     *string `json:"logo_url"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		brand.Name = *input.Name
+	}
+	if input.Slug != nil {
+		brand.Slug = *input.Slug
+	}
+	if input.Country != nil {
+		brand.Country = *input.Country
+	}
+	if input.Description != nil {
+		brand.Description = *input.Description
+	}
+	if input.LogoURL != nil {
+		brand.LogoURL = *input.LogoURL
+	}
+
+	v := validator.New()
+	if data.ValidateBrand(v, brand); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Brands.Update(r.Context(), brand)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateBrand):
+			v.AddError("name", "a brand with this name or slug already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"brand": brand}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// DELETE "/v1/brands/:id"
+func (app *application) deleteBrandHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Brands.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrBrandInUse):
+			app.brandInUseResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "brand successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GET "/v1/brands"
+func (app *application) listBrandsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Name = app.readString(qs, "name", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "name")
+	input.Filters.SortSafelist = []string{"id", "name", "slug", "-id", "-name", "-slug"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	brands, metadata, err := app.models.Brands.GetAll(r.Context(), input.Name, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"brands": brands, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// resolveBrand links watch to the brand given by its BrandID or, when that is
+// zero, by its Brand name, and copies the brand's name into Brand. A name
+// without a brand is left for the watch model to create along with the watch,
+// so clients can keep creating watches by brand name alone, but only users
+// who may create brands can do so. Problems with the input are added to v.
+func (app *application) resolveBrand(r *http.Request, watch *data.Watch, v *validator.Validator) error {
+	if watch.BrandID != 0 {
+		brand, err := app.models.Brands.Get(r.Context(), watch.BrandID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("brand_id", "must reference an existing brand")
+				return nil
+			default:
+				return err
+			}
+		}
+
+		watch.Brand = brand.Name
+		return nil
+	}
+
+	name := strings.TrimSpace(watch.Brand)
+	if name == "" || len(name) > 500 {
+		// Left for ValidateWatch to report.
+		return nil
+	}
+
+	brand, err := app.models.Brands.GetByName(r.Context(), name)
+	if err != nil {
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			return err
+		}
+
+		allowed, err := app.hasPermission(r, "brands:write")
+		if err != nil {
+			return err
+		}
+
+		v.Check(allowed, "brand", "must name an existing brand; brands are created through /v1/brands")
+		watch.Brand = name
+		return nil
+	}
+
+	watch.BrandID = brand.ID
+	watch.Brand = brand.Name
+	return nil
+}
+
+// brandIncluder embeds the brand of every watch.
+func (app *application) brandIncluder(ctx context.Context, ids []int64) (map[int64]interface{}, error) {
+	brands, err := app.models.Brands.GetForWatches(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	related := make(map[int64]interface{}, len(brands))
+	for id, brand := range brands {
+		related[id] = brand
+	}
+	return related, nil
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/validator"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// cartTokenHeader carries the token of the cart of a guest, which every
+// response with a guest cart hands out.
+const cartTokenHeader = "X-Cart-Token"
+
+// GET "/v1/cart"
+//
+// Shows the cart, discounted by the promotion with promotion_code if one is
+// given, to preview what an order placed with it would cost.
+func (app *application) showCartHandler(w http.ResponseWriter, r *http.Request) {
+	cart, err := app.requestCart(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if code := app.readString(r.URL.Query(), "promotion_code", ""); code != "" {
+		v := validator.New()
+
+		err = app.applyPromotion(r, cart, code, v)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	app.writeCart(w, r, cart)
+}
+
+// POST "/v1/cart/items"
+//
+// Adds a quantity of a watch to the cart, on top of any already in it. A
+// guest without a cart gets a new one.
+func (app *application) addCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		WatchID  int64  `json:"watch_id"`
+		Quantity *int32 `json:"quantity"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	quantity := int32(1)
+	if input.Quantity != nil {
+		quantity = *input.Quantity
+	}
+
+	v := validator.New()
+
+	v.Check(input.WatchID > 0, "watch_id", "must be provided")
+	if data.ValidateCartQuantity(v, quantity); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	cart, err := app.requestCart(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.setCartItem(w, r, cart, input.WatchID, cart.Quantity(input.WatchID)+quantity, v)
+}
+
+// PUT "/v1/cart/items/:id"
+//
+// Sets the quantity of a watch already in the cart. The :id is that of the
+// watch.
+func (app *application) updateCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	watchID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Quantity int32 `json:"quantity"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateCartQuantity(v, input.Quantity); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	cart, err := app.requestCart(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if cart.Quantity(watchID) == 0 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	app.setCartItem(w, r, cart, watchID, input.Quantity, v)
+}
+
+// setCartItem puts a quantity of a watch in cart, checking through the watch
+// model that the watch exists and has enough of it in stock, and responds
+// with the updated cart.
+func (app *application) setCartItem(w http.ResponseWriter, r *http.Request, cart *data.Cart, watchID int64, quantity int32, v *validator.Validator) {
+	watch, err := app.models.Watches.Get(r.Context(), watchID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("watch_id", "must reference an existing watch")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v.Check(quantity <= watch.StockQuantity, "quantity", fmt.Sprintf("must not be more than the %d in stock", watch.StockQuantity))
+	if data.ValidateCartQuantity(v, quantity); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if cart.ID == 0 {
+		cart, err = app.createCart(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.models.Carts.SetItem(r.Context(), cart.ID, watchID, quantity)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("watch_id", "must reference an existing watch")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	cart, err = app.models.Carts.Get(r.Context(), cart.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeCart(w, r, cart)
+}
+
+// DELETE "/v1/cart/items/:id"
+func (app *application) removeCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	watchID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	cart, err := app.requestCart(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if cart.ID == 0 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Carts.RemoveItem(r.Context(), cart.ID, watchID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	cart, err = app.models.Carts.Get(r.Context(), cart.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeCart(w, r, cart)
+}
+
+// DELETE "/v1/cart"
+func (app *application) clearCartHandler(w http.ResponseWriter, r *http.Request) {
+	cart, err := app.requestCart(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if cart.ID != 0 {
+		err = app.models.Carts.Clear(r.Context(), cart.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		cart.Items = []*data.CartItem{}
+		cart.Total.Amount = 0
+		cart.ItemCount = 0
+	}
+
+	app.writeCart(w, r, cart)
+}
+
+// writeCart responds with a cart, handing a guest the token of their cart
+// in the body and the X-Cart-Token header.
+func (app *application) writeCart(w http.ResponseWriter, r *http.Request, cart *data.Cart) {
+	env := envelope{"cart": cart}
+	headers := make(http.Header)
+
+	if cart.UserID == 0 && cart.ID != 0 {
+		token := app.signCartToken(cart.ID)
+		env["cart_token"] = token
+		headers.Set(cartTokenHeader, token)
+	}
+
+	err := app.writeJSON(w, http.StatusOK, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// requestCart returns the cart of the user making the request or, for a
+// guest, the cart named by the X-Cart-Token header. If there is none yet, an
+// empty cart without an id is returned.
+func (app *application) requestCart(r *http.Request) (*data.Cart, error) {
+	user := app.contextGetUser(r)
+	if !user.IsAnonymous() {
+		return app.models.Carts.GetForUser(r.Context(), user.ID)
+	}
+
+	cart, err := app.guestCart(r.Context(), r)
+	if err != nil || cart != nil {
+		return cart, err
+	}
+
+	return &data.Cart{Items: []*data.CartItem{}, Total: data.Money{Currency: data.CatalogCurrency}}, nil
+}
+
+// createCart creates the cart of the user making the request, or a new cart
+// for a guest.
+func (app *application) createCart(r *http.Request) (*data.Cart, error) {
+	user := app.contextGetUser(r)
+	if user.IsAnonymous() {
+		return app.models.Carts.NewGuest(r.Context())
+	}
+
+	id, err := app.models.Carts.ForUser(r.Context(), user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.models.Carts.Get(r.Context(), id)
+}
+
+// guestCart returns the guest cart named by the X-Cart-Token header of the
+// request, or nil if the header holds no valid token of an existing one.
+func (app *application) guestCart(ctx context.Context, r *http.Request) (*data.Cart, error) {
+	id, ok := app.verifyCartToken(r.Header.Get(cartTokenHeader))
+	if !ok {
+		return nil, nil
+	}
+
+	cart, err := app.models.Carts.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if cart.UserID != 0 {
+		return nil, nil
+	}
+
+	return cart, nil
+}
+
+// mergeGuestCart moves the items of the guest cart named by the request, if
+// any, into the cart of the user.
+func (app *application) mergeGuestCart(r *http.Request, userID int64) error {
+	guest, err := app.guestCart(r.Context(), r)
+	if err != nil || guest == nil {
+		return err
+	}
+
+	id, err := app.models.Carts.ForUser(r.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	return app.models.Carts.Merge(r.Context(), guest.ID, id)
+}
+
+// signCartToken returns the token of the guest cart with the given id: the
+// id followed by an HMAC-SHA256 of it under the cart secret.
+func (app *application) signCartToken(id int64) string {
+	mac := hmac.New(sha256.New, []byte(app.config.cart.secret))
+	fmt.Fprintf(mac, "cart:%d", id)
+
+	return strconv.FormatInt(id, 10) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyCartToken returns the id of the cart a token was signed for.
+func (app *application) verifyCartToken(token string) (int64, bool) {
+	digits, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, false
+	}
+
+	id, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || id < 1 {
+		return 0, false
+	}
+
+	if !hmac.Equal([]byte(token), []byte(app.signCartToken(id))) {
+		return 0, false
+	}
+
+	return id, true
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCartToken(t *testing.T) {
+	app := &application{}
+	app.config.cart.secret = "cart-secret"
+
+	other := &application{}
+	other.config.cart.secret = "other-secret"
+
+	token := app.signCartToken(42)
+
+	id, mac, _ := strings.Cut(token, ".")
+	if id != "42" {
+		t.Fatalf("token %q does not start with the cart id", token)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		wantID int64
+		wantOK bool
+	}{
+		{name: "valid", token: token, wantID: 42, wantOK: true},
+		{name: "signed again", token: app.signCartToken(42), wantID: 42, wantOK: true},
+		{name: "other cart", token: "43." + mac},
+		{name: "leading zero", token: "042." + mac},
+		{name: "signed with another secret", token: other.signCartToken(42)},
+		{name: "tampered signature", token: token[:len(token)-1] + "A"},
+		{name: "truncated signature", token: token[:len(token)-2]},
+		{name: "no signature", token: "42"},
+		{name: "empty signature", token: "42."},
+		{name: "id that is no number", token: "cart." + mac},
+		{name: "zero id", token: app.signCartToken(0)},
+		{name: "negative id", token: app.signCartToken(-1)},
+		{name: "empty", token: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, ok := app.verifyCartToken(tt.token)
+			if id != tt.wantID || ok != tt.wantOK {
+				t.Errorf("got %d, %t; want %d, %t", id, ok, tt.wantID, tt.wantOK)
+			}
+		})
+	}
+}
@@ -10,8 +10,11 @@ type contextKey string
 
 const userContextKey = contextKey("user")
 
+// contextSetUser also makes the user the actor of the writes done for the
+// request, so that they show up in the revision history.
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
+	ctx = data.WithActor(ctx, user.ID)
 	return r.WithContext(ctx)
 }
 
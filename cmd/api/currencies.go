@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/validator"
+	"net/http"
+	"net/url"
+)
+
+// GET "/v1/currencies"
+func (app *application) listCurrencyRatesHandler(w http.ResponseWriter, r *http.Request) {
+	rates, err := app.models.Currencies.GetAll(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"catalog_currency": data.CatalogCurrency, "rates": rates}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// PUT "/v1/currencies/:code"
+//
+// Sets the exchange rate of a currency, adding the currency if it had none.
+func (app *application) setCurrencyRateHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		// Rate may be sent as a JSON number or a string; either way its
+		// digits are kept exactly.
+		Rate json.Number `json:"rate"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	rate := &data.CurrencyRate{
+		Currency: httprouter.ParamsFromContext(r.Context()).ByName("code"),
+		Rate:     input.Rate.String(),
+	}
+
+	v := validator.New()
+	if data.ValidateCurrencyRate(v, rate); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Currencies.Set(r.Context(), rate)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"rate": rate}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// DELETE "/v1/currencies/:code"
+func (app *application) deleteCurrencyRateHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Currencies.Delete(r.Context(), httprouter.ParamsFromContext(r.Context()).ByName("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "currency rate successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readCurrencyRate reads the currency= parameter that watch prices are to be
+// shown in, returning the rate to convert them with, or nil to leave them in
+// the catalog currency.
+func (app *application) readCurrencyRate(ctx context.Context, qs url.Values, v *validator.Validator) (*data.CurrencyRate, error) {
+	currency := app.readString(qs, "currency", data.CatalogCurrency)
+	if currency == data.CatalogCurrency {
+		return nil, nil
+	}
+
+	rate, err := app.models.Currencies.Get(ctx, currency)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("currency", "must be the catalog currency or a currency with an exchange rate")
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return rate, nil
+}
+
+// convertPrices converts the prices of the watches with rate, if it is not
+// nil. The discount is the same in every currency.
+func (app *application) convertPrices(rate *data.CurrencyRate, watches ...*data.Watch) {
+	if rate == nil {
+		return
+	}
+
+	ratio := rate.Ratio()
+
+	for _, watch := range watches {
+		watch.Price = watch.Price.Convert(rate.Currency, ratio)
+		if watch.PreviousPrice != nil {
+			previous := watch.PreviousPrice.Convert(rate.Currency, ratio)
+			watch.PreviousPrice = &previous
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"jewelry.abgdrv.com/internal/patch"
 	"net/http"
 )
 
@@ -24,10 +27,37 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 
 // 500
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		app.requestCanceledResponse(w, r)
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		app.timeoutResponse(w, r, err)
+		return
+	}
+
 	app.logError(r, err)
 	app.errorResponse(w, r, http.StatusInternalServerError, "the server encountered a problem and could not process your request")
 }
 
+// 499 Client Closed Request (the client went away or the server is shutting down)
+func (app *application) requestCanceledResponse(w http.ResponseWriter, r *http.Request) {
+	app.logger.PrintInfo("request canceled", map[string]string{
+		"request_method": r.Method,
+		"request_url":    r.URL.String(),
+	})
+	message := "the request was canceled before it could be completed"
+	app.errorResponse(w, r, 499, message)
+}
+
+// 503 Service Unavailable (a database operation ran out of time)
+func (app *application) timeoutResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+	w.Header().Set("Retry-After", "1")
+	message := "the server timed out while processing your request, please try again"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
+
 // 404
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	app.errorResponse(w, r, http.StatusNotFound, "the requested resource could not be found")
@@ -39,11 +69,28 @@ func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.
 	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
 }
 
+// 406
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "none of the media types in the Accept header can be produced for this resource"
+	app.errorResponse(w, r, http.StatusNotAcceptable, message)
+}
+
 // 400
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 }
 
+// 415 Unsupported Media Type
+func (app *application) unsupportedPatchTypeResponse(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("the Content-Type must be application/json, %s or %s", patch.MediaTypeMergePatch, patch.MediaTypeJSONPatch)
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+// 422 Unprocessable Entity (the patch is well formed but cannot be applied)
+func (app *application) unprocessablePatchResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, err.Error())
+}
+
 // Failed validation
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
@@ -55,6 +102,54 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+// 409 Conflict
+func (app *application) patchTestFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	message := fmt.Sprintf("the patch was not applied because a test did not hold: %s", err)
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// 409 Conflict
+func (app *application) insufficientStockResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the stock of this watch is too low for the requested movement"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// 409 Conflict
+func (app *application) outOfStockResponse(w http.ResponseWriter, r *http.Request, watchID int64) {
+	message := fmt.Sprintf("there are not enough of watch %d in stock to place the order", watchID)
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// 409 Conflict
+func (app *application) unavailableWatchesResponse(w http.ResponseWriter, r *http.Request, watchIDs []int64) {
+	message := fmt.Sprintf("watches %v of the cart are no longer available; remove them to place the order", watchIDs)
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// 409 Conflict
+func (app *application) brandInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the brand is still referenced by watches, including any in the trash, or by promotions, and cannot be deleted"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// 409 Conflict
+func (app *application) watchInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the watch is still targeted by promotions and cannot be permanently deleted"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// 412 Precondition Failed
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has changed since the version in the If-Match header, fetch it again and retry"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+// 428 Precondition Required
+func (app *application) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this request must be made conditional with an If-Match header holding the ETag of the record"
+	app.errorResponse(w, r, http.StatusPreconditionRequired, message)
+}
+
 // 429 Too Many Requests
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
@@ -80,6 +175,12 @@ func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+// 401 Unauthorized
+func (app *application) invalidWebhookSignatureResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or missing webhook signature"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
 // 403 Forbidden
 func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account must be activated to access this resource"
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/validator"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// exportFlushRows is the number of rows written between flushes of the
+	// response, each of which also extends the write deadline.
+	exportFlushRows = 500
+	// exportWriteTimeout is how long the client may take to receive the rows
+	// written between two flushes.
+	exportWriteTimeout = time.Minute
+)
+
+// watchEncoder writes exported watches in one of the export formats. flush
+// passes on whatever the encoder buffers itself.
+type watchEncoder interface {
+	begin() error
+	encode(watch *data.Watch) error
+	end() error
+	flush() error
+}
+
+type exportFormat struct {
+	contentType string
+	extension   string
+	encoder     func(w io.Writer) watchEncoder
+}
+
+var exportFormats = map[string]exportFormat{
+	"csv": {
+		contentType: "text/csv; charset=utf-8",
+		extension:   "csv",
+		encoder:     func(w io.Writer) watchEncoder { return &csvWatchEncoder{w: csv.NewWriter(w)} },
+	},
+	"ndjson": {
+		contentType: "application/x-ndjson",
+		extension:   "ndjson",
+		encoder:     func(w io.Writer) watchEncoder { return &ndjsonWatchEncoder{enc: json.NewEncoder(w)} },
+	},
+	"spreadsheetml": {
+		contentType: "application/vnd.ms-excel",
+		extension:   "xml",
+		encoder:     func(w io.Writer) watchEncoder { return &spreadsheetWatchEncoder{w: w} },
+	},
+}
+
+// GET "/v1/watches/export"
+//
+// Streams every watch matching the filters of listWatchesHandler, without
+// paging, as CSV, NDJSON or a SpreadsheetML workbook that Excel opens. The
+// format is given by the format parameter or else negotiated from Accept.
+func (app *application) exportWatchesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Filter  data.WatchFilter
+		Filters data.Filters
+		Format  string
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filter = app.readWatchFilters(qs, v)
+	input.Filters.Sort, input.Filters.SortSafelist = app.readWatchSort(qs, input.Filter, "id", v)
+	// Exports are not paged; only the sort is validated.
+	input.Filters.Page = 1
+	input.Filters.PageSize = 1
+
+	input.Format = app.readString(qs, "format", "")
+	if input.Format != "" {
+		_, ok := exportFormats[input.Format]
+		v.Check(ok, "format", "must be csv, ndjson or spreadsheetml")
+	}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.Format == "" {
+		var ok bool
+		input.Format, ok = negotiateExportFormat(r.Header.Get("Accept"))
+		if !ok {
+			app.notAcceptableResponse(w, r)
+			return
+		}
+	}
+
+	format := exportFormats[input.Format]
+
+	rc := http.NewResponseController(w)
+	buf := bufio.NewWriter(w)
+	enc := format.encoder(buf)
+
+	// The response is only started with the first row, so that an error
+	// running the query can still be reported properly.
+	started := false
+	rows := 0
+
+	extendDeadline := func() error {
+		err := rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	}
+
+	start := func() error {
+		started = true
+
+		if err := extendDeadline(); err != nil {
+			return err
+		}
+
+		w.Header().Set("Content-Type", format.contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="watches.%s"`, format.extension))
+		w.WriteHeader(http.StatusOK)
+
+		return enc.begin()
+	}
+
+	err := app.models.Watches.Export(r.Context(), input.Filter, input.Filters, func(watch *data.Watch) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		if err := enc.encode(watch); err != nil {
+			return err
+		}
+
+		rows++
+		if rows%exportFlushRows != 0 {
+			return nil
+		}
+
+		if err := enc.flush(); err != nil {
+			return err
+		}
+		if err := buf.Flush(); err != nil {
+			return err
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return extendDeadline()
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = enc.end()
+	}
+	if err == nil {
+		err = enc.flush()
+	}
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err != nil {
+		if !started {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// The status line is gone, so the connection is dropped instead to
+		// keep the client from taking a truncated file for a complete one.
+		app.logError(r, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// negotiateExportFormat picks the first export format accepted by an Accept
+// header, defaulting to CSV.
+func negotiateExportFormat(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return "csv", true
+	}
+
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+
+		switch mediaType {
+		case "text/csv", "text/*", "*/*":
+			return "csv", true
+		case "application/x-ndjson", "application/ndjson":
+			return "ndjson", true
+		case "application/vnd.ms-excel", "application/xml":
+			return "spreadsheetml", true
+		}
+	}
+
+	return "", false
+}
+
+// exportColumns are the columns of the CSV and SpreadsheetML exports.
+var exportColumns = []string{
+	"id", "brand", "brand_id", "model", "dial_color", "strap_type", "diameter",
+	"energy", "gender", "price", "currency", "image_url", "sku", "stock_quantity", "version",
+}
+
+// exportValues returns the values of the export columns of a watch, and
+// whether each of them is a number.
+func exportValues(watch *data.Watch) ([]string, []bool) {
+	brandID := ""
+	if watch.BrandID != 0 {
+		brandID = strconv.FormatInt(watch.BrandID, 10)
+	}
+
+	values := []string{
+		strconv.FormatInt(watch.ID, 10),
+		watch.Brand,
+		brandID,
+		watch.Model,
+		watch.DialColor,
+		watch.StrapType,
+		strconv.Itoa(int(watch.Diameter)),
+		watch.Energy,
+		watch.Gender,
+		watch.Price.Decimal(),
+		watch.Price.Currency,
+		watch.ImageURL,
+		watch.SKU,
+		strconv.Itoa(int(watch.StockQuantity)),
+		strconv.Itoa(int(watch.Version)),
+	}
+	numeric := []bool{true, false, brandID != "", false, false, false, true, false, false, true, false, false, false, true, true}
+
+	return values, numeric
+}
+
+type csvWatchEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvWatchEncoder) begin() error {
+	return e.w.Write(exportColumns)
+}
+
+func (e *csvWatchEncoder) encode(watch *data.Watch) error {
+	values, _ := exportValues(watch)
+	return e.w.Write(values)
+}
+
+func (e *csvWatchEncoder) end() error {
+	return nil
+}
+
+func (e *csvWatchEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonWatchEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonWatchEncoder) begin() error {
+	return nil
+}
+
+// encode writes the watch as listWatchesHandler does, on a line of its own.
+func (e *ndjsonWatchEncoder) encode(watch *data.Watch) error {
+	return e.enc.Encode(watch)
+}
+
+func (e *ndjsonWatchEncoder) end() error {
+	return nil
+}
+
+func (e *ndjsonWatchEncoder) flush() error {
+	return nil
+}
+
+// spreadsheetWatchEncoder writes an XML Spreadsheet 2003 workbook with one
+// worksheet. Unlike XLSX it is plain XML and can be written as it goes.
+type spreadsheetWatchEncoder struct {
+	w io.Writer
+}
+
+func (e *spreadsheetWatchEncoder) begin() error {
+	_, err := io.WriteString(e.w, xml.Header+`<?mso-application progid="Excel.Sheet"?>
+<Workbook xmlns="urn:schemas-microsoft-com:office:spreadsheet" xmlns:ss="urn:schemas-microsoft-com:office:spreadsheet">
+<Worksheet ss:Name="Watches">
+<Table>
+`)
+	if err != nil {
+		return err
+	}
+
+	numeric := make([]bool, len(exportColumns))
+	return e.row(exportColumns, numeric)
+}
+
+func (e *spreadsheetWatchEncoder) encode(watch *data.Watch) error {
+	return e.row(exportValues(watch))
+}
+
+func (e *spreadsheetWatchEncoder) end() error {
+	_, err := io.WriteString(e.w, "</Table>\n</Worksheet>\n</Workbook>\n")
+	return err
+}
+
+func (e *spreadsheetWatchEncoder) flush() error {
+	return nil
+}
+
+func (e *spreadsheetWatchEncoder) row(values []string, numeric []bool) error {
+	var b strings.Builder
+
+	b.WriteString("<Row>")
+	for i, value := range values {
+		cellType := "String"
+		if numeric[i] {
+			cellType = "Number"
+		}
+
+		fmt.Fprintf(&b, `<Cell><Data ss:Type="%s">`, cellType)
+		if err := xml.EscapeText(&b, []byte(value)); err != nil {
+			return err
+		}
+		b.WriteString("</Data></Cell>")
+	}
+	b.WriteString("</Row>\n")
+
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
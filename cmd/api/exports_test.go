@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"jewelry.abgdrv.com/internal/data"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateExportFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+		wantOK bool
+	}{
+		{accept: "", want: "csv", wantOK: true},
+		{accept: "  ", want: "csv", wantOK: true},
+		{accept: "text/csv", want: "csv", wantOK: true},
+		{accept: "*/*", want: "csv", wantOK: true},
+		{accept: "text/*;q=0.5", want: "csv", wantOK: true},
+		{accept: "application/x-ndjson", want: "ndjson", wantOK: true},
+		{accept: "application/ndjson; charset=utf-8", want: "ndjson", wantOK: true},
+		{accept: "application/vnd.ms-excel", want: "spreadsheetml", wantOK: true},
+		{accept: "application/xml", want: "spreadsheetml", wantOK: true},
+		{accept: "application/json, application/x-ndjson", want: "ndjson", wantOK: true},
+		{accept: "text/csv;q=0, application/xml", want: "spreadsheetml", wantOK: true},
+		{accept: "not a media type, text/csv", want: "csv", wantOK: true},
+		{accept: "application/json"},
+		{accept: "text/csv;q=0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			got, ok := negotiateExportFormat(tt.accept)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("got %q, %t; want %q, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// exportTestWatches are written by the encoder tests. The second one has
+// what has to be quoted or escaped in every format.
+var exportTestWatches = []*data.Watch{
+	{
+		ID:            1,
+		Brand:         "Omega",
+		BrandID:       3,
+		Model:         "Seamaster",
+		DialColor:     "blue",
+		StrapType:     "steel",
+		Diameter:      42,
+		Energy:        "mechanical",
+		Gender:        "male",
+		Price:         data.Money{Amount: 520000, Currency: "USD"},
+		ImageURL:      "https://example.com/seamaster.png",
+		SKU:           "OM-SEA-42",
+		StockQuantity: 4,
+		Version:       2,
+	},
+	{
+		ID:            2,
+		Brand:         "Tissot",
+		Model:         `PRX "Powermatic", <80>`,
+		DialColor:     "green",
+		StrapType:     "steel",
+		Diameter:      40,
+		Energy:        "mechanical",
+		Gender:        "unisex",
+		Price:         data.Money{Amount: 72550, Currency: "USD"},
+		ImageURL:      "https://example.com/prx.png?size=large&crop=1",
+		StockQuantity: 0,
+		Version:       1,
+	},
+}
+
+// encodeWatches writes the watches with an encoder of the given format.
+func encodeWatches(t *testing.T, format string, watches []*data.Watch) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	enc := exportFormats[format].encoder(&buf)
+
+	err := enc.begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, watch := range watches {
+		err = enc.encode(watch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = enc.end()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = enc.flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestCSVWatchEncoder(t *testing.T) {
+	got := string(encodeWatches(t, "csv", exportTestWatches))
+
+	want := `id,brand,brand_id,model,dial_color,strap_type,diameter,energy,gender,price,currency,image_url,sku,stock_quantity,version
+1,Omega,3,Seamaster,blue,steel,42,mechanical,male,5200.00,USD,https://example.com/seamaster.png,OM-SEA-42,4,2
+2,Tissot,,"PRX ""Powermatic"", <80>",green,steel,40,mechanical,unisex,725.50,USD,https://example.com/prx.png?size=large&crop=1,,0,1
+`
+
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCSVExportImport(t *testing.T) {
+	rows, err := readImportCSV(bytes.NewReader(encodeWatches(t, "csv", exportTestWatches)))
+	if err != nil {
+		t.Fatalf("importing the export: %v", err)
+	}
+
+	if len(rows) != len(exportTestWatches) {
+		t.Fatalf("got %d rows; want %d", len(rows), len(exportTestWatches))
+	}
+
+	for i, row := range rows {
+		if !row.v.Valid() {
+			t.Errorf("row %d: unexpected errors: %v", i, row.v.Errors)
+		}
+
+		// What is left is what an import sets.
+		want := *exportTestWatches[i]
+		want.ID = 0
+		want.StockQuantity = 0
+		want.Version = 0
+
+		if !reflect.DeepEqual(row.watch, &want) {
+			t.Errorf("row %d: watch %+v; want %+v", i, row.watch, &want)
+		}
+	}
+}
+
+func TestNDJSONWatchEncoder(t *testing.T) {
+	got := encodeWatches(t, "ndjson", exportTestWatches)
+
+	lines := strings.Split(strings.TrimSuffix(string(got), "\n"), "\n")
+	if len(lines) != len(exportTestWatches) {
+		t.Fatalf("got %d lines; want %d:\n%s", len(lines), len(exportTestWatches), got)
+	}
+
+	for i, line := range lines {
+		var watch data.Watch
+
+		err := json.Unmarshal([]byte(line), &watch)
+		if err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+
+		if !reflect.DeepEqual(&watch, exportTestWatches[i]) {
+			t.Errorf("line %d: watch %+v; want %+v", i+1, &watch, exportTestWatches[i])
+		}
+	}
+}
+
+func TestSpreadsheetWatchEncoder(t *testing.T) {
+	got := encodeWatches(t, "spreadsheetml", exportTestWatches)
+
+	var workbook struct {
+		Worksheet struct {
+			Name string `xml:"Name,attr"`
+			Rows []struct {
+				Cells []struct {
+					Data struct {
+						Type  string `xml:"Type,attr"`
+						Value string `xml:",chardata"`
+					}
+				} `xml:"Cell"`
+			} `xml:"Table>Row"`
+		}
+	}
+
+	err := xml.Unmarshal(got, &workbook)
+	if err != nil {
+		t.Fatalf("the workbook is not well-formed: %v\n%s", err, got)
+	}
+
+	if workbook.Worksheet.Name != "Watches" {
+		t.Errorf("worksheet %q; want %q", workbook.Worksheet.Name, "Watches")
+	}
+
+	rows := workbook.Worksheet.Rows
+	if len(rows) != len(exportTestWatches)+1 {
+		t.Fatalf("got %d rows; want a header and %d watches", len(rows), len(exportTestWatches))
+	}
+
+	for i, row := range rows {
+		var values, types []string
+		for _, cell := range row.Cells {
+			values = append(values, cell.Data.Value)
+			types = append(types, cell.Data.Type)
+		}
+
+		wantValues := exportColumns
+		wantTypes := make([]string, len(exportColumns))
+		for j := range wantTypes {
+			wantTypes[j] = "String"
+		}
+
+		if i > 0 {
+			var numeric []bool
+			wantValues, numeric = exportValues(exportTestWatches[i-1])
+			for j, number := range numeric {
+				if number {
+					wantTypes[j] = "Number"
+				}
+			}
+		}
+
+		if !reflect.DeepEqual(values, wantValues) {
+			t.Errorf("row %d: values %q; want %q", i, values, wantValues)
+		}
+		if !reflect.DeepEqual(types, wantTypes) {
+			t.Errorf("row %d: types %v; want %v", i, types, wantTypes)
+		}
+	}
+
+	// The brand id of the second watch is empty, which is no number.
+	if typ := rows[2].Cells[2].Data.Type; typ != "String" {
+		t.Errorf("empty brand_id has type %s; want String", typ)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/validator"
+	"net/http"
+	"time"
+)
+
+// GET "/v1/watches/facets"
+func (app *application) watchFacetsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	input := app.readWatchFilters(r.URL.Query(), v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var facets data.Facets
+	var err error
+
+	if app.config.facets.materializedView && input.IsEmpty() {
+		facets, err = app.models.Watches.CachedFacets(r.Context())
+	} else {
+		facets, err = app.models.Watches.Facets(r.Context(), input)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"facets": facets}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// refreshFacets periodically refreshes the materialized view that serves
+// unfiltered facet counts.
+func (app *application) refreshFacets() {
+	go func() {
+		for {
+			time.Sleep(app.config.facets.refreshInterval)
+
+			err := app.models.Watches.RefreshFacets(context.Background())
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}
+	}()
+}
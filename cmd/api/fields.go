@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"jewelry.abgdrv.com/internal/validator"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// includer loads a related resource for each of the given ids so that it can
+// be embedded in a response with include=. Ids without the relation are left
+// out of the returned map.
+type includer func(ctx context.Context, ids []int64) (map[int64]interface{}, error)
+
+// shape holds the fields= and include= options of a request. The zero value
+// leaves a resource exactly as writeJSON would encode it.
+type shape struct {
+	fields   []string
+	includes []string
+}
+
+// readShape parses fields= against the JSON keys of resource and include=
+// against the names in includers.
+func (app *application) readShape(qs url.Values, resource interface{}, includers map[string]includer, v *validator.Validator) shape {
+	var s shape
+
+	allowed := jsonFieldNames(resource)
+
+	s.fields = app.readCSV(qs, "fields", nil)
+	for _, field := range s.fields {
+		v.Check(validator.In(field, allowed...), "fields", fmt.Sprintf("unknown field %q", field))
+	}
+	v.Check(validator.Unique(s.fields), "fields", "must not contain duplicate values")
+
+	s.includes = app.readCSV(qs, "include", nil)
+	for _, name := range s.includes {
+		_, ok := includers[name]
+		v.Check(ok, "include", fmt.Sprintf("unknown relation %q", name))
+	}
+	v.Check(validator.Unique(s.includes), "include", "must not contain duplicate values")
+
+	return s
+}
+
+func (s shape) empty() bool {
+	return len(s.fields) == 0 && len(s.includes) == 0
+}
+
+// apply encodes every item as a JSON object trimmed to the requested fields
+// and embeds the requested relations under their include names. ids holds
+// the id of each item.
+func (s shape) apply(ctx context.Context, items []interface{}, ids []int64, includers map[string]includer) ([]map[string]interface{}, error) {
+	objects := make([]map[string]interface{}, len(items))
+
+	for i, item := range items {
+		js, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+
+		var object map[string]json.RawMessage
+		err = json.Unmarshal(js, &object)
+		if err != nil {
+			return nil, err
+		}
+
+		objects[i] = make(map[string]interface{}, len(object))
+		for key, value := range object {
+			if len(s.fields) == 0 || validator.In(key, s.fields...) {
+				objects[i][key] = value
+			}
+		}
+	}
+
+	for _, name := range s.includes {
+		related, err := includers[name](ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, id := range ids {
+			objects[i][name] = related[id]
+		}
+	}
+
+	return objects, nil
+}
+
+// jsonFieldNames returns the JSON keys a struct value is encoded with.
+func jsonFieldNames(resource interface{}) []string {
+	t := reflect.TypeOf(resource)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var names []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+
+	return names
+}
@@ -6,33 +6,57 @@ import (
 	"fmt"
 	"github.com/julienschmidt/httprouter"
 	"io"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/patch"
 	"jewelry.abgdrv.com/internal/validator"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type envelope map[string]interface{}
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readNamedIDParam(r, "id")
+}
+
+// readNamedIDParam reads an id from the route parameter with the given name,
+// for routes such as /v1/watches/:id/images/:image_id.
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 	return id, nil
 }
 
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	js, err := json.MarshalIndent(data, "", "\t")
+	js, err := app.encodeJSON(data)
 	if err != nil {
 		return err
 	}
 
-	js = append(js, '\n')
+	app.writeEncodedJSON(w, status, js, headers)
 
+	return nil
+}
+
+// encodeJSON encodes a response body the way writeJSON sends it.
+func (app *application) encodeJSON(data envelope) ([]byte, error) {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(js, '\n'), nil
+}
+
+func (app *application) writeEncodedJSON(w http.ResponseWriter, status int, js []byte, headers http.Header) {
 	for key, val := range headers {
 		w.Header()[key] = val
 	}
@@ -40,8 +64,19 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	w.Write(js)
+}
 
-	return nil
+// readPatch reads a patch document in any of the formats of the patch
+// package, chosen by the Content-Type of the request.
+func (app *application) readPatch(w http.ResponseWriter, r *http.Request) (patch.Patch, error) {
+	var body json.RawMessage
+
+	err := app.readJSON(w, r, &body)
+	if err != nil {
+		return nil, err
+	}
+
+	return patch.Parse(r.Header.Get("Content-Type"), body)
 }
 
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
@@ -56,6 +91,7 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 		var syntaxError *json.SyntaxError
 		var unmarshalTypeError *json.UnmarshalTypeError
 		var invalidUnmarshalError *json.InvalidUnmarshalError
+		var moneyError *data.MoneyError
 
 		switch {
 		case errors.As(err, &syntaxError):
@@ -73,6 +109,9 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 		case errors.Is(err, io.EOF):
 			return errors.New("body must not be empty")
 
+		case errors.As(err, &moneyError):
+			return fmt.Errorf("body contains an invalid amount of money: %s", moneyError)
+
 		case strings.HasPrefix(err.Error(), "json: unknown field "):
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
 			return fmt.Errorf("body contains unknown key %s", fieldName)
@@ -109,7 +148,30 @@ func (app *application) readCSV(qs url.Values, key string, defaultValue []string
 	if csv == "" {
 		return defaultValue
 	}
-	return strings.Split(csv, ",")
+
+	values := strings.Split(csv, ",")
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return values
+}
+
+func (app *application) readIntCSV(qs url.Values, key string, defaultValue []int, v *validator.Validator) []int {
+	csv := app.readCSV(qs, key, nil)
+	if csv == nil {
+		return defaultValue
+	}
+
+	values := make([]int, len(csv))
+	for i, s := range csv {
+		value, err := strconv.Atoi(s)
+		if err != nil {
+			v.AddError(key, "must contain integer values")
+			return defaultValue
+		}
+		values[i] = value
+	}
+	return values
 }
 
 func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
@@ -126,6 +188,68 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+func (app *application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		v.AddError(key, "must be a decimal value")
+		return defaultValue
+	}
+	return f
+}
+
+func (app *application) readBool(qs url.Values, key string, defaultValue *bool, v *validator.Validator) *bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return &b
+}
+
+// readTime reads an RFC 3339 timestamp or a plain date, which is taken as
+// midnight UTC.
+func (app *application) readTime(qs url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+
+	v.AddError(key, "must be a date (2006-01-02) or an RFC 3339 timestamp")
+	return defaultValue
+}
+
+// readMoney reads a decimal amount in currency, returning the zero amount if
+// the parameter is missing.
+func (app *application) readMoney(qs url.Values, key string, currency string, v *validator.Validator) data.Money {
+	s := qs.Get(key)
+	if s == "" {
+		return data.Money{Currency: currency}
+	}
+
+	money, err := data.ParseMoney(s, currency)
+	if err != nil {
+		v.AddError(key, "must be an amount of "+currency)
+		return data.Money{Currency: currency}
+	}
+	return money
+}
+
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
 
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/imaging"
+	"jewelry.abgdrv.com/internal/validator"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// thumbnailSize is the longest side of a thumbnail in pixels.
+	thumbnailSize = 320
+	// maxImagePixels caps the decoded size of an upload, which a small
+	// compressed file can otherwise inflate to gigabytes of memory.
+	maxImagePixels = 40_000_000
+)
+
+// imageExtensions maps the accepted content types of uploads to the file
+// extension they are stored with.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// POST "/v1/watches/:id/images"
+func (app *application) uploadWatchImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	// Leave room for the multipart headers and the other form fields.
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.images.maxSize+1<<20)
+
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			v.AddError("image", fmt.Sprintf("must not be larger than %d bytes", app.config.images.maxSize))
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, http.ErrMissingFile):
+			app.badRequestResponse(w, r, errors.New("body must be a multipart form with an image file"))
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+	defer file.Close()
+	defer r.MultipartForm.RemoveAll()
+
+	primary := false
+	if s := r.FormValue("primary"); s != "" {
+		primary, err = strconv.ParseBool(s)
+		v.Check(err == nil, "primary", "must be a boolean value")
+	}
+
+	v.Check(header.Size <= app.config.images.maxSize, "image", fmt.Sprintf("must not be larger than %d bytes", app.config.images.maxSize))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	original, err := io.ReadAll(file)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	contentType := http.DetectContentType(original)
+	extension, ok := imageExtensions[contentType]
+	if !ok {
+		v.AddError("image", "must be a JPEG, PNG or GIF image")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(original))
+	if err == nil && config.Width*config.Height > maxImagePixels {
+		v.AddError("image", fmt.Sprintf("must not have more than %d pixels", maxImagePixels))
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		v.AddError("image", "must be a valid image")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// JPEG thumbnails for photos; PNG for the rest, which may be transparent.
+	var thumbnail bytes.Buffer
+	thumbnailExtension := ".png"
+
+	if contentType == "image/jpeg" {
+		thumbnailExtension = ".jpg"
+		err = jpeg.Encode(&thumbnail, imaging.Thumbnail(img, thumbnailSize), &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&thumbnail, imaging.Thumbnail(img, thumbnailSize))
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	name, err := randomName()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	watchImage := &data.WatchImage{
+		WatchID:      id,
+		Primary:      primary,
+		ContentType:  contentType,
+		Width:        int32(img.Bounds().Dx()),
+		Height:       int32(img.Bounds().Dy()),
+		Size:         int64(len(original)),
+		Key:          fmt.Sprintf("watches/%d/%s%s", id, name, extension),
+		ThumbnailKey: fmt.Sprintf("watches/%d/%s_thumb%s", id, name, thumbnailExtension),
+	}
+	watchImage.URL = app.blobs.URL(watchImage.Key)
+	watchImage.ThumbnailURL = app.blobs.URL(watchImage.ThumbnailKey)
+
+	err = app.blobs.Put(r.Context(), watchImage.Key, bytes.NewReader(original))
+	if err == nil {
+		err = app.blobs.Put(r.Context(), watchImage.ThumbnailKey, &thumbnail)
+	}
+	if err == nil {
+		err = app.models.Images.Insert(r.Context(), watchImage)
+	}
+	if err != nil {
+		app.deleteImageBlobs(watchImage)
+
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/watches/%d/images/%d", id, watchImage.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"image": watchImage}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GET "/v1/watches/:id/images"
+func (app *application) listWatchImagesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Watches.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	images, err := app.models.Images.GetAllForWatches(r.Context(), []int64{id})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if images[id] == nil {
+		images[id] = []*data.WatchImage{}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"images": images[id]}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// PATCH "/v1/watches/:id/images/:image_id"
+func (app *application) updateWatchImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	imageID, err := app.readNamedIDParam(r, "image_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	watchImage, err := app.models.Images.Get(r.Context(), id, imageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Position *int32 `json:"position"`
+		Primary  *bool  `json:"primary"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if input.Position != nil {
+		v.Check(*input.Position > 0, "position", "must be greater than zero")
+		watchImage.Position = *input.Position
+	}
+	if input.Primary != nil {
+		v.Check(*input.Primary, "primary", "cannot be unset, make another image primary instead")
+		watchImage.Primary = *input.Primary
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Images.Update(r.Context(), watchImage)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"image": watchImage}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// DELETE "/v1/watches/:id/images/:image_id"
+func (app *application) deleteWatchImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	imageID, err := app.readNamedIDParam(r, "image_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	watchImage, err := app.models.Images.Get(r.Context(), id, imageID)
+	if err == nil {
+		err = app.models.Images.Delete(r.Context(), id, imageID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.deleteImageBlobs(watchImage)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "image successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteImageBlobs removes the stored files of images in the background.
+// Failures only leave orphaned files behind, so they are logged and
+// otherwise ignored.
+func (app *application) deleteImageBlobs(images ...*data.WatchImage) {
+	app.background(func() {
+		for _, image := range images {
+			for _, key := range []string{image.Key, image.ThumbnailKey} {
+				err := app.blobs.Delete(context.Background(), key)
+				if err != nil {
+					app.logger.PrintError(err, map[string]string{"key": key})
+				}
+			}
+		}
+	})
+}
+
+// imagesIncluder embeds the ordered gallery of every watch.
+func (app *application) imagesIncluder(ctx context.Context, ids []int64) (map[int64]interface{}, error) {
+	images, err := app.models.Images.GetAllForWatches(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	related := make(map[int64]interface{}, len(ids))
+	for _, id := range ids {
+		if images[id] == nil {
+			images[id] = []*data.WatchImage{}
+		}
+		related[id] = images[id]
+	}
+	return related, nil
+}
+
+// randomName returns a random hex string for naming stored files, which keeps
+// their URLs unguessable and safe to cache forever.
+func randomName() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
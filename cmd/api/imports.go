@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/validator"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxImportRows caps the number of watches in one import.
+	maxImportRows = 50_000
+	// maxImportLine caps the length of one NDJSON line.
+	maxImportLine = 1 << 20
+	// importTimeout replaces the server's read and write timeouts for imports,
+	// which are too short to upload and store a large file.
+	importTimeout = 5 * time.Minute
+)
+
+// importRow is one watch read from an import file, along with the problems
+// found with it. Line is the line of the file the watch starts on.
+type importRow struct {
+	line  int
+	watch *data.Watch
+	v     *validator.Validator
+}
+
+type importRowErrors struct {
+	Line   int               `json:"line"`
+	Errors map[string]string `json:"errors"`
+}
+
+type importReport struct {
+	DryRun   bool              `json:"dry_run"`
+	Rows     int               `json:"rows"`
+	Valid    int               `json:"valid"`
+	Invalid  int               `json:"invalid"`
+	Imported int               `json:"imported"`
+	Errors   []importRowErrors `json:"errors"`
+}
+
+// POST "/v1/watches/import"
+//
+// The body is a CSV file with a header row naming the columns, or NDJSON with
+// one watch object per line, as told by the format parameter or the
+// Content-Type. Every row is validated and the errors are reported per line.
+// With dry_run=true nothing else happens; otherwise the watches are imported
+// if every row is valid, and none is if any is not.
+func (app *application) importWatchesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	dryRun := *app.readBool(qs, "dry_run", new(bool), v)
+
+	format := app.readString(qs, "format", "")
+	if format == "" {
+		format = importFormat(r.Header.Get("Content-Type"))
+	}
+	v.Check(validator.In(format, "csv", "ndjson"), "format", "must be csv or ndjson, unless given by the Content-Type header")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	for _, setDeadline := range []func(time.Time) error{rc.SetReadDeadline, rc.SetWriteDeadline} {
+		err := setDeadline(time.Now().Add(importTimeout))
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(w, r.Body, app.config.imports.maxSize)
+
+	var rows []*importRow
+	var err error
+
+	switch format {
+	case "csv":
+		rows, err = readImportCSV(body)
+	default:
+		rows, err = readImportNDJSON(body)
+	}
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			err = fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if len(rows) == 0 {
+		app.badRequestResponse(w, r, errors.New("body must contain at least one watch"))
+		return
+	}
+
+	err = app.validateImport(r, rows)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	report := importReport{DryRun: dryRun, Rows: len(rows), Errors: []importRowErrors{}}
+	for _, row := range rows {
+		if row.v.Valid() {
+			report.Valid++
+			continue
+		}
+		report.Invalid++
+		report.Errors = append(report.Errors, importRowErrors{Line: row.line, Errors: row.v.Errors})
+	}
+
+	if dryRun {
+		err = app.writeJSON(w, http.StatusOK, envelope{"report": report}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if report.Invalid > 0 {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, report)
+		return
+	}
+
+	watches := make([]*data.Watch, len(rows))
+	for i, row := range rows {
+		watches[i] = row.watch
+	}
+
+	err = app.models.Watches.Import(r.Context(), watches)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateSKU):
+			v.AddError("sku", "a watch with one of the skus was added meanwhile")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	report.Imported = len(watches)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// importFormat returns the import format for a Content-Type, or an empty
+// string if it names none.
+func importFormat(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "text/csv":
+		return "csv"
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return "ndjson"
+	}
+	return ""
+}
+
+// validateImport checks every row the way createWatchHandler checks a single
+// watch, and also rejects SKUs used more than once or already taken. Brands
+// are looked up but not created; the watch model creates them along with the
+// watches.
+func (app *application) validateImport(r *http.Request, rows []*importRow) error {
+	ctx := r.Context()
+
+	err := app.importBrands(r, rows)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		// A row that could not be read has no fields worth validating.
+		if _, ok := row.v.Errors["row"]; !ok {
+			data.ValidateWatch(row.v, row.watch)
+		}
+	}
+
+	lines := make(map[string]int)
+	var skus []string
+
+	for _, row := range rows {
+		sku := row.watch.SKU
+		if sku == "" {
+			continue
+		}
+		if line, ok := lines[sku]; ok {
+			row.v.AddError("sku", fmt.Sprintf("is already used on line %d", line))
+			continue
+		}
+		lines[sku] = row.line
+		skus = append(skus, sku)
+	}
+
+	if len(skus) == 0 {
+		return nil
+	}
+
+	existing, err := app.models.Watches.ExistingSKUs(ctx, skus)
+	if err != nil {
+		return err
+	}
+
+	taken := make(map[string]bool, len(existing))
+	for _, sku := range existing {
+		taken[sku] = true
+	}
+
+	for _, row := range rows {
+		if taken[row.watch.SKU] {
+			row.v.AddError("sku", "a watch with this sku already exists")
+		}
+	}
+
+	return nil
+}
+
+// importBrands links the watches of rows to their brands as resolveBrand
+// does, looking every distinct brand up only once. Brand names without a
+// brand are left as they are, and reported unless the user may create
+// brands.
+func (app *application) importBrands(r *http.Request, rows []*importRow) error {
+	byID := make(map[int64]*data.Brand)
+	byName := make(map[string]*data.Brand)
+
+	var allowed *bool
+
+	for _, row := range rows {
+		watch := row.watch
+
+		if watch.BrandID != 0 {
+			brand, ok := byID[watch.BrandID]
+			if !ok {
+				var err error
+				brand, err = app.models.Brands.Get(r.Context(), watch.BrandID)
+				if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+					return err
+				}
+				byID[watch.BrandID] = brand
+			}
+
+			if brand == nil {
+				row.v.AddError("brand_id", "must reference an existing brand")
+				continue
+			}
+
+			watch.Brand = brand.Name
+			continue
+		}
+
+		name := strings.TrimSpace(watch.Brand)
+		if name == "" || len(name) > 500 {
+			// Left for ValidateWatch to report.
+			continue
+		}
+
+		key := strings.ToLower(name)
+
+		brand, ok := byName[key]
+		if !ok {
+			var err error
+			brand, err = app.models.Brands.GetByName(r.Context(), name)
+			if errors.Is(err, data.ErrRecordNotFound) {
+				brand, err = nil, nil
+			}
+			if err != nil {
+				return err
+			}
+			byName[key] = brand
+		}
+
+		if brand == nil {
+			if allowed == nil {
+				permitted, err := app.hasPermission(r, "brands:write")
+				if err != nil {
+					return err
+				}
+				allowed = &permitted
+			}
+
+			row.v.Check(*allowed, "brand", "must name an existing brand; brands are created through /v1/brands")
+			watch.Brand = name
+			continue
+		}
+
+		watch.BrandID = brand.ID
+		watch.Brand = brand.Name
+	}
+
+	return nil
+}
+
+// importColumns maps the columns of a CSV import to the fields of a watch.
+// The setters return a message to report for the column if the value cannot
+// be used.
+var importColumns = map[string]func(watch *data.Watch, value string) string{
+	"brand":      func(watch *data.Watch, value string) string { watch.Brand = value; return "" },
+	"model":      func(watch *data.Watch, value string) string { watch.Model = value; return "" },
+	"dial_color": func(watch *data.Watch, value string) string { watch.DialColor = value; return "" },
+	"strap_type": func(watch *data.Watch, value string) string { watch.StrapType = value; return "" },
+	"energy":     func(watch *data.Watch, value string) string { watch.Energy = value; return "" },
+	"gender":     func(watch *data.Watch, value string) string { watch.Gender = value; return "" },
+	"image_url":  func(watch *data.Watch, value string) string { watch.ImageURL = value; return "" },
+	"sku":        func(watch *data.Watch, value string) string { watch.SKU = value; return "" },
+	"brand_id": func(watch *data.Watch, value string) string {
+		if value == "" {
+			return ""
+		}
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id < 1 {
+			return "must be a positive integer"
+		}
+		watch.BrandID = id
+		return ""
+	},
+	"diameter": func(watch *data.Watch, value string) string {
+		diameter, err := strconv.ParseInt(value, 10, 8)
+		if err != nil {
+			return "must be an integer no greater than 127"
+		}
+		watch.Diameter = int8(diameter)
+		return ""
+	},
+	"price": func(watch *data.Watch, value string) string {
+		price, err := data.ParseMoney(value, data.CatalogCurrency)
+		if err != nil {
+			return "must be an amount of " + data.CatalogCurrency
+		}
+		watch.Price.Amount = price.Amount
+		if watch.Price.Currency == "" {
+			watch.Price.Currency = price.Currency
+		}
+		return ""
+	},
+	// currency is optional, as prices are in the catalog currency; exports
+	// include it to make the amounts unambiguous.
+	"currency": func(watch *data.Watch, value string) string {
+		if value != "" {
+			watch.Price.Currency = value
+		}
+		return ""
+	},
+}
+
+// importIgnoredColumns are the columns of a CSV export that an import cannot
+// set. They are accepted and ignored, so that an export can be imported again.
+var importIgnoredColumns = map[string]bool{
+	"id":             true,
+	"stock_quantity": true,
+	"version":        true,
+}
+
+// readImportCSV reads the watches of a CSV import. The first row names the
+// columns, in any order; columns left out keep their zero values.
+func readImportCSV(r io.Reader) ([]*importRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body must not be empty")
+		}
+		return nil, csvError(err)
+	}
+
+	seen := make(map[string]bool)
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if _, ok := importColumns[column]; !ok && !importIgnoredColumns[column] {
+			return nil, fmt.Errorf("body contains unknown column %q", column)
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("body contains column %q more than once", column)
+		}
+		seen[column] = true
+		header[i] = column
+	}
+
+	var rows []*importRow
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, csvError(err)
+		}
+
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("body must not contain more than %d watches", maxImportRows)
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := &importRow{line: line, watch: &data.Watch{}, v: validator.New()}
+
+		if len(record) != len(header) {
+			row.v.AddError("row", fmt.Sprintf("must have %d fields", len(header)))
+		} else {
+			for i, value := range record {
+				set, ok := importColumns[header[i]]
+				if !ok {
+					continue
+				}
+				if message := set(row.watch, strings.TrimSpace(value)); message != "" {
+					row.v.AddError(header[i], message)
+				}
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// csvError describes a CSV parse error, passing on other read errors.
+func csvError(err error) error {
+	var parseError *csv.ParseError
+	if errors.As(err, &parseError) {
+		return fmt.Errorf("body contains badly-formed CSV (line %d): %v", parseError.Line, parseError.Err)
+	}
+	return err
+}
+
+// importInput is one line of an NDJSON import, with the fields accepted by
+// createWatchHandler.
+type importInput struct {
+	Brand     string     `json:"brand"`
+	BrandID   int64      `json:"brand_id"`
+	Model     string     `json:"model"`
+	DialColor string     `json:"dial_color"`
+	StrapType string     `json:"strap_type"`
+	Diameter  int8       `json:"diameter"`
+	Energy    string     `json:"energy"`
+	Gender    string     `json:"gender"`
+	Price     data.Money `json:"price"`
+	ImageURL  string     `json:"image_url"`
+	SKU       string     `json:"sku"`
+}
+
+// readImportNDJSON reads the watches of an NDJSON import, one JSON object per
+// line. Blank lines are skipped.
+func readImportNDJSON(r io.Reader) ([]*importRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLine)
+
+	var rows []*importRow
+
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("body must not contain more than %d watches", maxImportRows)
+		}
+
+		row := &importRow{line: line, watch: &data.Watch{}, v: validator.New()}
+
+		var input importInput
+
+		dec := json.NewDecoder(bytes.NewReader(text))
+		dec.DisallowUnknownFields()
+
+		err := dec.Decode(&input)
+		switch {
+		case err != nil:
+			row.v.AddError("row", importJSONError(err))
+		case dec.More():
+			row.v.AddError("row", "must only contain a single JSON object")
+		default:
+			*row.watch = data.Watch{
+				Brand:     input.Brand,
+				BrandID:   input.BrandID,
+				Model:     input.Model,
+				DialColor: input.DialColor,
+				StrapType: input.StrapType,
+				Diameter:  input.Diameter,
+				Energy:    input.Energy,
+				Gender:    input.Gender,
+				Price:     input.Price,
+				ImageURL:  input.ImageURL,
+				SKU:       input.SKU,
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("body must not contain lines longer than %d bytes", maxImportLine)
+		}
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// importJSONError describes why a line of an NDJSON import could not be
+// decoded, in the terms readJSON uses for request bodies.
+func importJSONError(err error) string {
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+	var moneyError *data.MoneyError
+
+	switch {
+	case errors.As(err, &syntaxError), errors.Is(err, io.ErrUnexpectedEOF):
+		return "contains badly-formed JSON"
+	case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+		return fmt.Sprintf("contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return "contains unknown key " + strings.TrimPrefix(err.Error(), "json: unknown field ")
+	case errors.As(err, &moneyError):
+		return "contains an invalid amount of money: " + moneyError.Error()
+	default:
+		return "must be a JSON object"
+	}
+}
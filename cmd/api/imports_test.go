@@ -0,0 +1,179 @@
+package main
+
+import (
+	"jewelry.abgdrv.com/internal/data"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadImportCSV(t *testing.T) {
+	const header = "brand,model,dial_color,strap_type,diameter,energy,gender,price,image_url\n"
+
+	usd := func(amount int64) data.Money {
+		return data.Money{Amount: amount, Currency: data.CatalogCurrency}
+	}
+
+	seamaster := &data.Watch{
+		Brand:     "Omega",
+		Model:     "Seamaster",
+		DialColor: "blue",
+		StrapType: "steel",
+		Diameter:  42,
+		Energy:    "mechanical",
+		Gender:    "male",
+		Price:     usd(520000),
+		ImageURL:  "https://example.com/seamaster.png",
+	}
+
+	tests := []struct {
+		name        string
+		body        string
+		wantErr     string
+		wantLines   []int
+		wantWatches []*data.Watch
+		wantErrors  []map[string]string
+	}{
+		{
+			name:        "one watch",
+			body:        header + "Omega,Seamaster,blue,steel,42,mechanical,male,5200.00,https://example.com/seamaster.png\n",
+			wantLines:   []int{2},
+			wantWatches: []*data.Watch{seamaster},
+			wantErrors:  []map[string]string{{}},
+		},
+		{
+			name:        "columns in any case and order, with a BOM",
+			body:        "\ufeffPrice, Model ,brand\n99.5,Seamaster,Omega\n",
+			wantLines:   []int{2},
+			wantWatches: []*data.Watch{{Brand: "Omega", Model: "Seamaster", Price: usd(9950)}},
+			wantErrors:  []map[string]string{{}},
+		},
+		{
+			name:        "price in another currency",
+			body:        "model,currency,price\nSeamaster,EUR,10.00\n",
+			wantLines:   []int{2},
+			wantWatches: []*data.Watch{{Model: "Seamaster", Price: data.Money{Amount: 1000, Currency: "EUR"}}},
+			wantErrors:  []map[string]string{{}},
+		},
+		{
+			name:        "read-only columns of an export are ignored",
+			body:        "id,model,stock_quantity,version\n7,Seamaster,3,12\n",
+			wantLines:   []int{2},
+			wantWatches: []*data.Watch{{Model: "Seamaster"}},
+			wantErrors:  []map[string]string{{}},
+		},
+		{
+			name:        "quoted field over several lines",
+			body:        "model,brand\n\"Sea\nmaster\",Omega\nSpeedmaster,Omega\n",
+			wantLines:   []int{2, 4},
+			wantWatches: []*data.Watch{{Brand: "Omega", Model: "Sea\nmaster"}, {Brand: "Omega", Model: "Speedmaster"}},
+			wantErrors:  []map[string]string{{}, {}},
+		},
+		{
+			name:        "values that cannot be used",
+			body:        "model,diameter,price,brand_id\nSeamaster,huge,cheap,-1\n",
+			wantLines:   []int{2},
+			wantWatches: []*data.Watch{{Model: "Seamaster"}},
+			wantErrors: []map[string]string{{
+				"diameter": "must be an integer no greater than 127",
+				"price":    "must be an amount of " + data.CatalogCurrency,
+				"brand_id": "must be a positive integer",
+			}},
+		},
+		{
+			name:        "wrong number of fields",
+			body:        "model,brand\nSeamaster\n",
+			wantLines:   []int{2},
+			wantWatches: []*data.Watch{{}},
+			wantErrors:  []map[string]string{{"row": "must have 2 fields"}},
+		},
+		{name: "empty", body: "", wantErr: "body must not be empty"},
+		{name: "unknown column", body: "model,colour\n", wantErr: `body contains unknown column "colour"`},
+		{name: "repeated column", body: "model,Model\n", wantErr: `body contains column "model" more than once`},
+		{name: "bad quoting", body: "model\n\"Sea\"master\n", wantErr: "body contains badly-formed CSV (line 2)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readImportCSV(strings.NewReader(tt.body))
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v; want %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(rows) != len(tt.wantWatches) {
+				t.Fatalf("got %d rows; want %d", len(rows), len(tt.wantWatches))
+			}
+
+			for i, row := range rows {
+				if row.line != tt.wantLines[i] {
+					t.Errorf("row %d: line %d; want %d", i, row.line, tt.wantLines[i])
+				}
+				if !reflect.DeepEqual(row.watch, tt.wantWatches[i]) {
+					t.Errorf("row %d: watch %+v; want %+v", i, row.watch, tt.wantWatches[i])
+				}
+				if !reflect.DeepEqual(row.v.Errors, tt.wantErrors[i]) {
+					t.Errorf("row %d: errors %v; want %v", i, row.v.Errors, tt.wantErrors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadImportNDJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		wantModel string
+		wantError string
+	}{
+		{name: "watch", line: `{"model":"Seamaster","price":"5200.00"}`, wantModel: "Seamaster"},
+		{name: "badly-formed", line: `{"model":"Seamaster"`, wantError: "contains badly-formed JSON"},
+		{name: "not an object", line: `["Seamaster"]`, wantError: "must be a JSON object"},
+		{name: "wrong type", line: `{"diameter":"large"}`, wantError: `contains incorrect JSON type for field "diameter"`},
+		{name: "unknown key", line: `{"colour":"blue"}`, wantError: `contains unknown key "colour"`},
+		{name: "invalid amount", line: `{"price":"5200.001"}`, wantError: "contains an invalid amount of money: "},
+		{name: "two objects", line: `{"model":"Seamaster"} {"model":"Speedmaster"}`, wantError: "must only contain a single JSON object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The blank line is skipped but still counted.
+			rows, err := readImportNDJSON(strings.NewReader("\n" + tt.line + "\n"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(rows) != 1 {
+				t.Fatalf("got %d rows; want 1", len(rows))
+			}
+
+			row := rows[0]
+
+			if row.line != 2 {
+				t.Errorf("line %d; want 2", row.line)
+			}
+
+			if tt.wantError == "" {
+				if !row.v.Valid() {
+					t.Errorf("unexpected errors: %v", row.v.Errors)
+				}
+				if row.watch.Model != tt.wantModel {
+					t.Errorf("model %q; want %q", row.watch.Model, tt.wantModel)
+				}
+				return
+			}
+
+			if got := row.v.Errors["row"]; !strings.HasPrefix(got, tt.wantError) {
+				t.Errorf("row error %q; want %q", got, tt.wantError)
+			}
+		})
+	}
+}
@@ -2,12 +2,17 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"flag"
+	"fmt"
 	_ "github.com/lib/pq"
+	"jewelry.abgdrv.com/internal/blob"
 	"jewelry.abgdrv.com/internal/data"
 	"jewelry.abgdrv.com/internal/jsonlog"
 	"jewelry.abgdrv.com/internal/mailer"
+	"jewelry.abgdrv.com/internal/payments"
 	"os"
 	"strings"
 	"sync"
@@ -26,6 +31,10 @@ type config struct {
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  string
+		readTimeout  time.Duration
+		writeTimeout time.Duration
+		bulkTimeout  time.Duration
+		mock         bool
 	}
 	limiter struct {
 		rps     float64
@@ -42,15 +51,42 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	facets struct {
+		materializedView bool
+		refreshInterval  time.Duration
+	}
+	images struct {
+		dir     string
+		baseURL string
+		maxSize int64
+	}
+	imports struct {
+		maxSize int64
+	}
+	prices struct {
+		dropWindow time.Duration
+	}
+	preconditions struct {
+		required bool
+	}
+	cart struct {
+		secret string
+	}
+	payments struct {
+		webhookSecret string
+		webhookURL    string
+	}
 }
 
 // Application struct to hold HTTP handlers, helpers, middleware
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config   config
+	logger   *jsonlog.Logger
+	models   data.Models
+	mailer   mailer.Mailer
+	blobs    blob.Store
+	payments payments.Provider
+	wg       sync.WaitGroup
 }
 
 func main() {
@@ -83,6 +119,22 @@ func main() {
 		"db-max-idle-time",
 		"15m",
 		"PostgreSQL max connection idle time")
+	flag.DurationVar(&cfg.db.readTimeout,
+		"db-read-timeout",
+		3*time.Second,
+		"PostgreSQL timeout for a single read operation")
+	flag.DurationVar(&cfg.db.writeTimeout,
+		"db-write-timeout",
+		3*time.Second,
+		"PostgreSQL timeout for a single write operation")
+	flag.DurationVar(&cfg.db.bulkTimeout,
+		"db-bulk-timeout",
+		time.Minute,
+		"PostgreSQL timeout for a bulk operation such as an import")
+	flag.BoolVar(&cfg.db.mock,
+		"db-mock",
+		false,
+		"Use the in-memory data models instead of PostgreSQL")
 
 	flag.Float64Var(&cfg.limiter.rps,
 		"limiter-rps",
@@ -125,30 +177,131 @@ func main() {
 			return nil
 		})
 
+	flag.BoolVar(&cfg.facets.materializedView,
+		"facets-materialized-view",
+		false,
+		"Serve unfiltered facet counts from the watch_facets materialized view")
+	flag.DurationVar(&cfg.facets.refreshInterval,
+		"facets-refresh-interval",
+		time.Minute,
+		"Refresh interval of the watch_facets materialized view")
+
+	flag.StringVar(&cfg.images.dir,
+		"images-dir",
+		"./uploads",
+		"Directory uploaded images are stored in")
+	flag.StringVar(&cfg.images.baseURL,
+		"images-base-url",
+		"/images",
+		"URL stored images are served under")
+	flag.Int64Var(&cfg.images.maxSize,
+		"images-max-size",
+		10<<20,
+		"Maximum size of an uploaded image in bytes")
+
+	flag.Int64Var(&cfg.imports.maxSize,
+		"import-max-size",
+		16<<20,
+		"Maximum size of a watch import file in bytes")
+
+	flag.DurationVar(&cfg.prices.dropWindow,
+		"price-drop-window",
+		30*24*time.Hour,
+		"How long a price drop is shown as the previous price and a discount (0 disables)")
+
+	flag.BoolVar(&cfg.preconditions.required,
+		"require-preconditions",
+		false,
+		"Require If-Match on every write to an existing watch")
+
+	flag.StringVar(&cfg.cart.secret,
+		"cart-secret",
+		"",
+		"Secret guest cart tokens are signed with (random for each run if empty)")
+
+	flag.StringVar(&cfg.payments.webhookSecret,
+		"payments-webhook-secret",
+		"",
+		"Secret payment webhook deliveries are signed with (random for each run if empty)")
+	flag.StringVar(&cfg.payments.webhookURL,
+		"payments-webhook-url",
+		"",
+		"URL the fake payment provider delivers webhook events to (this server if empty)")
+
 	flag.Parse()
 
 	// Initialization of logger (recording information about the execution of an application)
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
-	db, err := openDB(cfg)
-	if err != nil {
-		logger.PrintFatal(err, nil)
+	if cfg.cart.secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		cfg.cart.secret = string(secret)
+
+		logger.PrintInfo("no cart secret set, guest carts will be lost on restart", nil)
 	}
 
-	defer db.Close()
+	if cfg.payments.webhookSecret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		cfg.payments.webhookSecret = hex.EncodeToString(secret)
+	}
+
+	if cfg.payments.webhookURL == "" {
+		cfg.payments.webhookURL = fmt.Sprintf("http://localhost:%d/v1/payments/webhook", cfg.port)
+	}
+
+	var models data.Models
+
+	if cfg.db.mock {
+		models = data.NewMockModels()
 
-	logger.PrintInfo("database connection pool established", nil)
+		logger.PrintInfo("using in-memory data models", nil)
+	} else {
+		db, err := openDB(cfg)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		defer db.Close()
+
+		models = data.NewModels(db, data.Timeouts{
+			Read:  cfg.db.readTimeout,
+			Write: cfg.db.writeTimeout,
+			Bulk:  cfg.db.bulkTimeout,
+		})
+
+		logger.PrintInfo("database connection pool established", nil)
+	}
+
+	blobs, err := blob.NewLocalStore(cfg.images.dir, cfg.images.baseURL)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
 
 	// Declare instance of application
 	app := application{
 		config: cfg,
 		logger: logger,
-		models: data.NewModels(db),
+		models: models,
 		mailer: mailer.New(cfg.smtp.host,
 			cfg.smtp.port,
 			cfg.smtp.username,
 			cfg.smtp.password,
 			cfg.smtp.sender),
+		blobs: blobs,
+	}
+
+	// Only the in-process fake provider exists so far. It delivers its
+	// webhook events to this server.
+	app.payments = payments.NewFake(cfg.payments.webhookSecret, app.deliverPaymentEvent)
+
+	if cfg.facets.materializedView {
+		app.refreshFacets()
 	}
 
 	err = app.serve()
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/validator"
+	"net/http"
+)
+
+// POST "/v1/orders"
+//
+// Places an order for everything in the cart of the user, which is emptied,
+// discounted by the promotion with promotion_code if one is given.
+func (app *application) createOrderHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ShippingAddress string `json:"shipping_address"`
+		PromotionCode   string `json:"promotion_code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateShippingAddress(v, input.ShippingAddress); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	cart, err := app.models.Carts.GetForUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	order := &data.Order{
+		UserID:          user.ID,
+		Email:           user.Email,
+		ShippingAddress: input.ShippingAddress,
+	}
+
+	err = app.models.Orders.Create(r.Context(), order, cart.ID, input.PromotionCode)
+	if err != nil {
+		var stockErr *data.OutOfStockError
+		var unavailableErr *data.UnavailableWatchesError
+		var promotionErr *data.PromotionError
+		switch {
+		case errors.Is(err, data.ErrEmptyCart):
+			v.AddError("cart", "must not be empty")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.As(err, &unavailableErr):
+			app.unavailableWatchesResponse(w, r, unavailableErr.WatchIDs)
+		case errors.As(err, &promotionErr):
+			v.AddError("promotion_code", promotionErr.Reason)
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.As(err, &stockErr):
+			app.outOfStockResponse(w, r, stockErr.WatchID)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.sendOrderEmail(order, "order_confirmation.tmpl")
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/orders/%d", order.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"order": order}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GET "/v1/orders"
+//
+// Lists the orders of the user, or with orders:manage those of every user,
+// optionally narrowed to one user with user_id.
+func (app *application) listOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.OrderFilter
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.OrderFilter.Status = app.readString(qs, "status", "")
+	input.OrderFilter.UserID = int64(app.readInt(qs, "user_id", 0, v))
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"id", "created_at", "total", "-id", "-created_at", "-total"}
+
+	if input.OrderFilter.Status != "" {
+		v.Check(validator.In(input.OrderFilter.Status, data.OrderStatuses...), "status", "must be one of pending, paid, shipped, delivered, cancelled or refunded")
+	}
+	v.Check(input.OrderFilter.UserID >= 0, "user_id", "must be a positive integer")
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	manager, err := app.hasPermission(r, "orders:manage")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !manager {
+		input.OrderFilter.UserID = user.ID
+	}
+
+	orders, metadata, err := app.models.Orders.GetAll(r.Context(), input.OrderFilter, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"orders": orders, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GET "/v1/orders/:id"
+func (app *application) showOrderHandler(w http.ResponseWriter, r *http.Request) {
+	order, ok := app.requestOrder(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"order": order}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// POST "/v1/orders/:id/cancel"
+//
+// Lets the user who placed an order cancel it while it is pending.
+func (app *application) cancelOrderHandler(w http.ResponseWriter, r *http.Request) {
+	order, ok := app.requestOrder(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(order.Status == data.OrderPending, "status", fmt.Sprintf("cannot cancel an order that is %s", order.Status))
+	v.Check(order.PaymentStatus != data.PaymentProcessing, "payment_status", "cannot cancel an order while its payment is processing")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.transitionOrder(w, r, order, data.OrderCancelled, "")
+}
+
+// PUT "/v1/orders/:id/status"
+//
+// Moves an order to another status. Shipping it takes a tracking number, and
+// refunding it refunds its payment with the provider.
+func (app *application) updateOrderStatusHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Status         string `json:"status"`
+		TrackingNumber string `json:"tracking_number"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	order, err := app.models.Orders.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateOrderTransition(v, order, input.Status, input.TrackingNumber)
+	if input.Status == data.OrderCancelled {
+		v.Check(order.PaymentStatus != data.PaymentProcessing, "payment_status", "cannot cancel an order while its payment is processing")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The refund of a payment is reported to the webhook as well, which leaves
+	// an order already moved here as it is.
+	if input.Status == data.OrderRefunded && order.PaymentStatus == data.PaymentPaid {
+		_, err = app.payments.Refund(r.Context(), order.PaymentIntentID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.transitionOrder(w, r, order, input.Status, input.TrackingNumber)
+}
+
+// transitionOrder moves order to the status to, mails the customer when it
+// is shipped, and responds with the updated order.
+func (app *application) transitionOrder(w http.ResponseWriter, r *http.Request, order *data.Order, to, trackingNumber string) {
+	err := app.models.Orders.Transition(r.Context(), order, to, trackingNumber)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if to == data.OrderShipped {
+		app.sendOrderEmail(order, "order_shipped.tmpl")
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"order": order}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// requestOrder returns the order named by the :id of the request, responding
+// with 404 Not Found if there is none or it belongs to another user and the
+// user making the request lacks orders:manage.
+func (app *application) requestOrder(w http.ResponseWriter, r *http.Request) (*data.Order, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	order, err := app.models.Orders.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if order.UserID != app.contextGetUser(r).ID {
+		manager, err := app.hasPermission(r, "orders:manage")
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+
+		if !manager {
+			app.notFoundResponse(w, r)
+			return nil, false
+		}
+	}
+
+	return order, true
+}
+
+// sendOrderEmail mails an order to the address it was placed with, in the
+// background.
+func (app *application) sendOrderEmail(order *data.Order, templateFile string) {
+	app.background(func() {
+		err := app.mailer.Send(order.Email, templateFile, order)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"order_id": fmt.Sprint(order.ID)})
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"jewelry.abgdrv.com/internal/data"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// orderFixture is a server with a watch in stock, a customer and a manager
+// allowed to manage orders.
+type orderFixture struct {
+	*testServer
+	customer string
+	manager  string
+}
+
+func newOrderFixture(t *testing.T) *orderFixture {
+	ts := newTestServer(t)
+
+	f := &orderFixture{
+		testServer: ts,
+		customer:   ts.newUser("customer@example.com"),
+		manager:    ts.newUser("manager@example.com", "watches:write", "brands:write", "inventory:write", "orders:manage"),
+	}
+
+	f.mustDo(http.StatusCreated, http.MethodPost, "/v1/watches", f.manager, map[string]interface{}{
+		"brand":      "Omega",
+		"model":      "Seamaster",
+		"dial_color": "blue",
+		"strap_type": "steel",
+		"diameter":   42,
+		"energy":     "mechanical",
+		"gender":     "male",
+		"price":      "5200.00",
+		"image_url":  "https://example.com/seamaster.png",
+	})
+
+	f.mustDo(http.StatusCreated, http.MethodPost, "/v1/watches/1/stock", f.manager, map[string]interface{}{
+		"kind":     "receipt",
+		"quantity": 5,
+	})
+
+	return f
+}
+
+// addToCart puts quantity of a watch in the cart of the customer.
+func (f *orderFixture) addToCart(watchID int64, quantity int32) {
+	f.t.Helper()
+
+	f.mustDo(http.StatusOK, http.MethodPost, "/v1/cart/items", f.customer, map[string]interface{}{
+		"watch_id": watchID,
+		"quantity": quantity,
+	})
+}
+
+// placeOrder fills the cart of the customer and orders it, returning the id
+// of the order.
+func (f *orderFixture) placeOrder() int64 {
+	f.t.Helper()
+
+	f.addToCart(1, 1)
+
+	response := f.mustDo(http.StatusCreated, http.MethodPost, "/v1/orders", f.customer, map[string]interface{}{
+		"shipping_address": "1 Main Street, Springfield",
+	})
+
+	return int64(response["order"].(map[string]interface{})["id"].(float64))
+}
+
+func (f *orderFixture) order(id int64) *data.Order {
+	f.t.Helper()
+
+	order, err := f.app.models.Orders.Get(context.Background(), id)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return order
+}
+
+func (f *orderFixture) stock() int32 {
+	f.t.Helper()
+
+	watch, err := f.app.models.Watches.Get(context.Background(), 1)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return watch.StockQuantity
+}
+
+func TestCreateOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup fills the cart of the customer, and whatever else the case
+		// needs.
+		setup      func(f *orderFixture)
+		wantStatus int
+		wantStock  int32
+	}{
+		{
+			name:       "order",
+			setup:      func(f *orderFixture) { f.addToCart(1, 2) },
+			wantStatus: http.StatusCreated,
+			wantStock:  3,
+		},
+		{
+			name:       "empty cart",
+			setup:      func(f *orderFixture) {},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantStock:  5,
+		},
+		{
+			name: "stock taken since the watch was added",
+			setup: func(f *orderFixture) {
+				f.addToCart(1, 5)
+				f.mustDo(http.StatusCreated, http.MethodPost, "/v1/watches/1/stock", f.manager, map[string]interface{}{
+					"kind":     "adjustment",
+					"quantity": -1,
+				})
+			},
+			wantStatus: http.StatusConflict,
+			wantStock:  4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOrderFixture(t)
+
+			tt.setup(f)
+
+			status, response := f.do(http.MethodPost, "/v1/orders", f.customer, map[string]interface{}{
+				"shipping_address": "1 Main Street, Springfield",
+			})
+			if status != tt.wantStatus {
+				t.Fatalf("status %d; want %d: %v", status, tt.wantStatus, response)
+			}
+
+			if stock := f.stock(); stock != tt.wantStock {
+				t.Errorf("stock = %d; want %d", stock, tt.wantStock)
+			}
+		})
+	}
+}
+
+func TestCreateOrderWithTrashedWatch(t *testing.T) {
+	f := newOrderFixture(t)
+
+	f.addToCart(1, 1)
+	f.mustDo(http.StatusOK, http.MethodDelete, "/v1/watches/1", f.manager, nil)
+
+	address := map[string]interface{}{"shipping_address": "1 Main Street, Springfield"}
+
+	// The order is refused rather than placed without the watch.
+	response := f.mustDo(http.StatusConflict, http.MethodPost, "/v1/orders", f.customer, address)
+	if message, _ := response["error"].(string); !strings.Contains(message, "[1]") {
+		t.Errorf("error %q does not name watch 1", message)
+	}
+
+	f.mustDo(http.StatusOK, http.MethodDelete, "/v1/cart/items/1", f.customer, nil)
+	f.mustDo(http.StatusUnprocessableEntity, http.MethodPost, "/v1/orders", f.customer, address)
+}
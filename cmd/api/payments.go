@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/payments"
+	"jewelry.abgdrv.com/internal/validator"
+	"net/http"
+	"time"
+)
+
+// webhookTolerance is how far the signing time of a webhook delivery may be
+// from now.
+const webhookTolerance = 5 * time.Minute
+
+// POST "/v1/orders/:id/payment"
+//
+// Starts the payment of a pending order. The order is paid once the provider
+// reports the capture to the webhook, so the response is 202 Accepted.
+func (app *application) createOrderPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	order, ok := app.requestOrder(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(order.Status == data.OrderPending, "status", fmt.Sprintf("cannot pay for an order that is %s", order.Status))
+	v.Check(validator.In(order.PaymentStatus, data.PaymentUnpaid, data.PaymentFailed), "payment_status", fmt.Sprintf("cannot start a payment when it is %s", order.PaymentStatus))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	intent, err := app.payments.CreateIntent(r.Context(), order.Total.Amount, order.Total.Currency, fmt.Sprintf("order %d", order.ID))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Orders.SetPaymentIntent(r.Context(), order, intent.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	intentID := intent.ID
+
+	intent, err = app.payments.Capture(r.Context(), intentID)
+	if err != nil {
+		// No event will be delivered for a capture that failed, so the
+		// payment is marked failed here for the customer to try again, even
+		// if the request was cancelled.
+		failErr := app.models.Orders.FailPayment(context.WithoutCancel(r.Context()), order, intentID)
+		if failErr != nil {
+			app.logError(r, failErr)
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"order": order, "payment": intent}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// POST "/v1/payments/webhook"
+//
+// Receives the events of the payment provider, signed with the webhook
+// secret. The provider retries a delivery until it gets a 2xx response, so
+// an event that was already applied is acknowledged without applying it
+// again, and events the API has no use for are acknowledged too.
+func (app *application) paymentWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = payments.Verify(app.config.payments.webhookSecret, r.Header.Get(payments.SignatureHeader), payload, webhookTolerance, time.Now())
+	if err != nil {
+		app.invalidWebhookSignatureResponse(w, r)
+		return
+	}
+
+	var event payments.Event
+
+	err = json.Unmarshal(payload, &event)
+	if err != nil || event.ID == "" {
+		app.badRequestResponse(w, r, errors.New("body must be a payment event"))
+		return
+	}
+
+	var paymentStatus, to string
+
+	switch event.Type {
+	case payments.EventIntentSucceeded:
+		paymentStatus, to = data.PaymentPaid, data.OrderPaid
+	case payments.EventIntentFailed:
+		paymentStatus = data.PaymentFailed
+	case payments.EventIntentRefunded:
+		paymentStatus, to = data.PaymentRefunded, data.OrderRefunded
+	default:
+		app.acknowledgePaymentEvent(w, r, "event ignored")
+		return
+	}
+
+	order, err := app.models.Orders.GetForPaymentIntent(r.Context(), event.Intent.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.acknowledgePaymentEvent(w, r, "event ignored")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	message := "event processed"
+
+	err = app.models.Orders.ApplyPaymentEvent(r.Context(), order, event.ID, event.Type, paymentStatus, to)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicatePaymentEvent):
+			// The refund below may have failed on the earlier delivery, so it
+			// is tried again.
+			message = "event already processed"
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.refundCancelledOrder(r, order)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.acknowledgePaymentEvent(w, r, message)
+}
+
+// refundCancelledOrder refunds the payment of order if it was captured after
+// the order was cancelled, which leaves the order paid for but never moved to
+// paid. The refund is reported to the webhook like any other.
+func (app *application) refundCancelledOrder(r *http.Request, order *data.Order) error {
+	if order.Status != data.OrderCancelled || order.PaymentStatus != data.PaymentPaid {
+		return nil
+	}
+
+	_, err := app.payments.Refund(r.Context(), order.PaymentIntentID)
+	if errors.Is(err, payments.ErrInvalidState) {
+		// The payment was refunded already and the event is on its way.
+		return nil
+	}
+
+	return err
+}
+
+func (app *application) acknowledgePaymentEvent(w http.ResponseWriter, r *http.Request, message string) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deliverPaymentEvent posts an event of the fake payment provider to the
+// webhook in the background, retrying a few times the way a real provider
+// would.
+func (app *application) deliverPaymentEvent(payload []byte, signature string) {
+	app.background(func() {
+		for attempt := 1; ; attempt++ {
+			err := app.postPaymentEvent(payload, signature)
+			if err == nil {
+				return
+			}
+
+			if attempt == 3 {
+				app.logger.PrintError(err, map[string]string{"payload": string(payload)})
+				return
+			}
+
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	})
+}
+
+func (app *application) postPaymentEvent(payload []byte, signature string) error {
+	req, err := http.NewRequest(http.MethodPost, app.config.payments.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(payments.SignatureHeader, signature)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("payment webhook responded with %s", res.Status)
+	}
+
+	return nil
+}
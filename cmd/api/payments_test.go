@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/payments"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// startPayment starts the payment of an order and returns the webhook
+// delivery of its capture.
+func (f *orderFixture) startPayment(id int64) delivery {
+	f.t.Helper()
+
+	f.mustDo(http.StatusAccepted, http.MethodPost, fmt.Sprintf("/v1/orders/%d/payment", id), f.customer, nil)
+
+	deliveries := f.takeDeliveries()
+	if len(deliveries) != 1 {
+		f.t.Fatalf("got %d deliveries; want the capture only", len(deliveries))
+	}
+	return deliveries[0]
+}
+
+func TestOrderPayment(t *testing.T) {
+	f := newOrderFixture(t)
+
+	id := f.placeOrder()
+
+	if stock := f.stock(); stock != 4 {
+		t.Errorf("stock after ordering = %d; want 4", stock)
+	}
+
+	status, _ := f.do(http.MethodGet, "/v1/cart", f.customer, nil)
+	if status != http.StatusOK {
+		t.Fatalf("GET /v1/cart: status %d", status)
+	}
+
+	capture := f.startPayment(id)
+
+	if order := f.order(id); order.Status != data.OrderPending || order.PaymentStatus != data.PaymentProcessing {
+		t.Fatalf("order is %s with a %s payment; want pending and processing", order.Status, order.PaymentStatus)
+	}
+
+	tests := []struct {
+		name        string
+		signature   string
+		wantStatus  int
+		wantMessage string
+	}{
+		{"unsigned", "", http.StatusUnauthorized, ""},
+		{"signed with another secret", payments.Sign("whsec_other", time.Now(), capture.payload), http.StatusUnauthorized, ""},
+		{"signed too long ago", payments.Sign(testWebhookSecret, time.Now().Add(-time.Hour), capture.payload), http.StatusUnauthorized, ""},
+		{"delivered", capture.signature, http.StatusOK, "event processed"},
+		{"redelivered", capture.signature, http.StatusOK, "event already processed"},
+		{"replayed with a fresh signature", payments.Sign(testWebhookSecret, time.Now(), capture.payload), http.StatusOK, "event already processed"},
+	}
+
+	var version int32
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, response := f.deliver(capture.payload, tt.signature)
+			if status != tt.wantStatus {
+				t.Fatalf("status %d; want %d: %v", status, tt.wantStatus, response)
+			}
+			if tt.wantMessage != "" && response["message"] != tt.wantMessage {
+				t.Errorf("message %q; want %q", response["message"], tt.wantMessage)
+			}
+
+			order := f.order(id)
+
+			if tt.wantStatus != http.StatusOK {
+				if order.PaymentStatus != data.PaymentProcessing {
+					t.Errorf("payment is %s; want it still processing", order.PaymentStatus)
+				}
+				return
+			}
+
+			if order.Status != data.OrderPaid || order.PaymentStatus != data.PaymentPaid {
+				t.Errorf("order is %s with a %s payment; want paid and paid", order.Status, order.PaymentStatus)
+			}
+
+			// Applying the event again must not change the order.
+			if version != 0 && order.Version != version {
+				t.Errorf("version %d; want %d", order.Version, version)
+			}
+			version = order.Version
+		})
+	}
+
+	if deliveries := f.takeDeliveries(); len(deliveries) != 0 {
+		t.Errorf("got %d more deliveries; want none, as nothing was refunded", len(deliveries))
+	}
+}
+
+func TestCancelOrderWithPaymentProcessing(t *testing.T) {
+	tests := []struct {
+		name string
+		// cancel cancels the order through the API, as the customer or the
+		// manager, and returns the status code.
+		cancel func(f *orderFixture, id int64) int
+	}{
+		{
+			name: "by the customer",
+			cancel: func(f *orderFixture, id int64) int {
+				status, _ := f.do(http.MethodPost, fmt.Sprintf("/v1/orders/%d/cancel", id), f.customer, nil)
+				return status
+			},
+		},
+		{
+			name: "by a manager",
+			cancel: func(f *orderFixture, id int64) int {
+				status, _ := f.do(http.MethodPut, fmt.Sprintf("/v1/orders/%d/status", id), f.manager, map[string]interface{}{
+					"status": data.OrderCancelled,
+				})
+				return status
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOrderFixture(t)
+
+			id := f.placeOrder()
+			capture := f.startPayment(id)
+
+			if status := tt.cancel(f, id); status != http.StatusUnprocessableEntity {
+				t.Fatalf("cancelling with the payment processing: status %d; want %d", status, http.StatusUnprocessableEntity)
+			}
+
+			if stock := f.stock(); stock != 4 {
+				t.Errorf("stock = %d; want 4, as the order still holds its watch", stock)
+			}
+
+			// The capture lands on an order that was left alone.
+			f.deliver(capture.payload, capture.signature)
+
+			if order := f.order(id); order.Status != data.OrderPaid || order.PaymentStatus != data.PaymentPaid {
+				t.Errorf("order is %s with a %s payment; want paid and paid", order.Status, order.PaymentStatus)
+			}
+
+			if deliveries := f.takeDeliveries(); len(deliveries) != 0 {
+				t.Errorf("got %d deliveries; want none, as nothing was refunded", len(deliveries))
+			}
+		})
+	}
+}
+
+func TestCaptureOfCancelledOrder(t *testing.T) {
+	f := newOrderFixture(t)
+
+	id := f.placeOrder()
+	capture := f.startPayment(id)
+
+	// The order is cancelled behind the API's back, as a race between the
+	// check of the cancel handlers and the capture would leave it.
+	order := f.order(id)
+
+	err := f.app.models.Orders.Transition(context.Background(), order, data.OrderCancelled, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, response := f.deliver(capture.payload, capture.signature)
+	if status != http.StatusOK {
+		t.Fatalf("delivering the capture: status %d: %v", status, response)
+	}
+
+	if order := f.order(id); order.Status != data.OrderCancelled || order.PaymentStatus != data.PaymentPaid {
+		t.Fatalf("order is %s with a %s payment; want cancelled and paid", order.Status, order.PaymentStatus)
+	}
+
+	deliveries := f.takeDeliveries()
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries; want the refund only", len(deliveries))
+	}
+
+	refund := deliveries[0]
+
+	var event payments.Event
+
+	err = json.Unmarshal(refund.payload, &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != payments.EventIntentRefunded {
+		t.Fatalf("event type %q; want %q", event.Type, payments.EventIntentRefunded)
+	}
+
+	tests := []struct {
+		name        string
+		delivery    delivery
+		wantMessage string
+	}{
+		{"refund", refund, "event processed"},
+		{"capture redelivered", capture, "event already processed"},
+		{"refund redelivered", refund, "event already processed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, response := f.deliver(tt.delivery.payload, tt.delivery.signature)
+			if status != http.StatusOK {
+				t.Fatalf("status %d; want %d: %v", status, http.StatusOK, response)
+			}
+			if response["message"] != tt.wantMessage {
+				t.Errorf("message %q; want %q", response["message"], tt.wantMessage)
+			}
+
+			if order := f.order(id); order.Status != data.OrderCancelled || order.PaymentStatus != data.PaymentRefunded {
+				t.Errorf("order is %s with a %s payment; want cancelled and refunded", order.Status, order.PaymentStatus)
+			}
+		})
+	}
+
+	if deliveries := f.takeDeliveries(); len(deliveries) != 0 {
+		t.Errorf("got %d more deliveries; want none, as the payment was refunded once", len(deliveries))
+	}
+}
+
+// failingCapture is a payment provider whose captures fail before the
+// provider takes them on.
+type failingCapture struct {
+	payments.Provider
+}
+
+func (failingCapture) Capture(ctx context.Context, intentID string) (*payments.Intent, error) {
+	return nil, errors.New("payment provider unavailable")
+}
+
+func TestFailedCapture(t *testing.T) {
+	f := newOrderFixture(t)
+
+	id := f.placeOrder()
+
+	provider := f.app.payments
+	f.app.payments = failingCapture{provider}
+
+	path := fmt.Sprintf("/v1/orders/%d/payment", id)
+
+	f.mustDo(http.StatusInternalServerError, http.MethodPost, path, f.customer, nil)
+
+	// No event comes for the capture, so the payment is failed at once
+	// rather than left processing for good.
+	if order := f.order(id); order.Status != data.OrderPending || order.PaymentStatus != data.PaymentFailed {
+		t.Fatalf("order is %s with a %s payment; want pending and failed", order.Status, order.PaymentStatus)
+	}
+
+	if deliveries := f.takeDeliveries(); len(deliveries) != 0 {
+		t.Errorf("got %d deliveries; want none", len(deliveries))
+	}
+
+	// The customer can cancel the order, or try again.
+	f.app.payments = provider
+
+	capture := f.startPayment(id)
+
+	status, response := f.deliver(capture.payload, capture.signature)
+	if status != http.StatusOK {
+		t.Fatalf("delivering the capture: status %d: %v", status, response)
+	}
+
+	if order := f.order(id); order.Status != data.OrderPaid || order.PaymentStatus != data.PaymentPaid {
+		t.Errorf("order is %s with a %s payment; want paid and paid", order.Status, order.PaymentStatus)
+	}
+}
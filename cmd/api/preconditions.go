@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"jewelry.abgdrv.com/internal/data"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// watchETag returns the strong entity tag of a response holding one watch.
+// It starts with the version of the watch, which is what write preconditions
+// are checked against. The hash of the body covers what changes without a new
+// version: the stock level, a price drop leaving its window, converted prices
+// and the fields and related resources the response was shaped with.
+func watchETag(version int32, body []byte) string {
+	hash := fnv.New64a()
+	hash.Write(body)
+	return fmt.Sprintf(`"%d-%016x"`, version, hash.Sum64())
+}
+
+// etagVersion returns the watch version a strong entity tag was made for.
+// Weak tags never match a write precondition, so they are rejected.
+func etagVersion(tag string) (int32, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+
+	digits, _, _ := strings.Cut(tag[1:len(tag)-1], "-")
+
+	version, err := strconv.ParseInt(digits, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	return int32(version), true
+}
+
+// splitETags splits the values of an If-Match or If-None-Match header into
+// entity tags. Tags are opaque quoted strings, which may not contain commas.
+func splitETags(values []string) []string {
+	var tags []string
+
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return tags
+}
+
+// notModified reports whether etag is in the If-None-Match header of the
+// request. The comparison is weak, as it is for every If-None-Match.
+func notModified(r *http.Request, etag string) bool {
+	for _, tag := range splitETags(r.Header.Values("If-None-Match")) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeWatchJSON writes a response holding one watch at the given version
+// together with its ETag, or an empty 304 if the client already has it.
+func (app *application) writeWatchJSON(w http.ResponseWriter, r *http.Request, status int, data envelope, version int32) error {
+	js, err := app.encodeJSON(data)
+	if err != nil {
+		return err
+	}
+
+	etag := watchETag(version, js)
+	w.Header().Set("ETag", etag)
+
+	if (r.Method == http.MethodGet || r.Method == http.MethodHead) && notModified(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	app.writeEncodedJSON(w, status, js, nil)
+
+	return nil
+}
+
+// hasWritePrecondition reports whether a write carries a precondition on the
+// version of the watch it changes.
+func hasWritePrecondition(r *http.Request) bool {
+	return len(r.Header.Values("If-Match")) > 0 || r.Header.Get("X-Expected-Version") != ""
+}
+
+// checkWritePreconditions checks the If-Match header of a write against the
+// current version of the watch, writing a 412 response if none of its tags
+// was made for that version. X-Expected-Version, the bare decimal version, is
+// still accepted in its place and answered with a 409 as before. When
+// preconditions are required, a write without either gets a 428.
+//
+// It returns false if a response has been written.
+func (app *application) checkWritePreconditions(w http.ResponseWriter, r *http.Request, version int32) bool {
+	if values := r.Header.Values("If-Match"); len(values) > 0 {
+		for _, tag := range splitETags(values) {
+			if tag == "*" {
+				return true
+			}
+			if tagged, ok := etagVersion(tag); ok && tagged == version {
+				return true
+			}
+		}
+
+		app.preconditionFailedResponse(w, r)
+		return false
+	}
+
+	if expected := r.Header.Get("X-Expected-Version"); expected != "" {
+		if expected != strconv.FormatInt(int64(version), 10) {
+			app.editConflictResponse(w, r)
+			return false
+		}
+		return true
+	}
+
+	if app.config.preconditions.required {
+		app.preconditionRequiredResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// writeVersion checks the write preconditions of a request changing the
+// watch id, read with get, and returns the version the write has to be made
+// at. Unconditional writes skip reading the watch and go through whatever
+// its version, which is zero.
+//
+// It returns false if a response has been written.
+func (app *application) writeVersion(w http.ResponseWriter, r *http.Request, id int64, get func(ctx context.Context, id int64) (*data.Watch, error)) (int32, bool) {
+	if !hasWritePrecondition(r) && !app.config.preconditions.required {
+		return 0, true
+	}
+
+	watch, err := get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return 0, false
+	}
+
+	if !app.checkWritePreconditions(w, r, watch.Version) {
+		return 0, false
+	}
+
+	return watch.Version, true
+}
+
+// writeConflictResponse answers a write that lost the race against another
+// one, with a 412 if it was conditional on an ETag and a 409 otherwise.
+func (app *application) writeConflictResponse(w http.ResponseWriter, r *http.Request) {
+	if len(r.Header.Values("If-Match")) > 0 {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	app.editConflictResponse(w, r)
+}
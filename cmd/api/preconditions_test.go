@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io"
+	"jewelry.abgdrv.com/internal/jsonlog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestETagVersion(t *testing.T) {
+	tests := []struct {
+		tag         string
+		wantVersion int32
+		wantOK      bool
+	}{
+		{tag: watchETag(7, []byte(`{"watch":{}}`)), wantVersion: 7, wantOK: true},
+		{tag: `"12-00000000000000ff"`, wantVersion: 12, wantOK: true},
+		{tag: `"12"`, wantVersion: 12, wantOK: true},
+		{tag: `W/"12-00000000000000ff"`},
+		{tag: `12-00000000000000ff`},
+		{tag: `"12-00000000000000ff`},
+		{tag: `"`},
+		{tag: `""`},
+		{tag: `"v12-00000000000000ff"`},
+		{tag: `"99999999999-00000000000000ff"`},
+		{tag: `*`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			version, ok := etagVersion(tt.tag)
+			if version != tt.wantVersion || ok != tt.wantOK {
+				t.Errorf("got %d, %t; want %d, %t", version, ok, tt.wantVersion, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSplitETags(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{name: "none"},
+		{name: "one", values: []string{`"1-a"`}, want: []string{`"1-a"`}},
+		{name: "list", values: []string{` "1-a" ,W/"2-b",, "3-c"`}, want: []string{`"1-a"`, `W/"2-b"`, `"3-c"`}},
+		{name: "several headers", values: []string{`"1-a"`, `*`}, want: []string{`"1-a"`, `*`}},
+		{name: "blank", values: []string{" , "}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitETags(tt.values)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckWritePreconditions(t *testing.T) {
+	const version = 5
+
+	current := watchETag(version, []byte("body"))
+
+	tests := []struct {
+		name       string
+		required   bool
+		ifMatch    []string
+		expected   string
+		wantOK     bool
+		wantStatus int
+	}{
+		{name: "unconditional", wantOK: true},
+		{name: "unconditional when required", required: true, wantStatus: http.StatusPreconditionRequired},
+		{name: "current tag", ifMatch: []string{current}, wantOK: true},
+		{name: "current tag when required", required: true, ifMatch: []string{current}, wantOK: true},
+		{name: "tag of the version with another body", ifMatch: []string{watchETag(version, []byte("other"))}, wantOK: true},
+		{name: "any tag", ifMatch: []string{"*"}, wantOK: true},
+		{name: "one of several tags", ifMatch: []string{`"3-a", ` + current}, wantOK: true},
+		{name: "stale tag", ifMatch: []string{watchETag(version-1, []byte("body"))}, wantStatus: http.StatusPreconditionFailed},
+		{name: "weak tag", ifMatch: []string{"W/" + current}, wantStatus: http.StatusPreconditionFailed},
+		{name: "empty If-Match", ifMatch: []string{""}, wantStatus: http.StatusPreconditionFailed},
+		{name: "If-Match wins over the version", ifMatch: []string{`"4-a"`}, expected: "5", wantStatus: http.StatusPreconditionFailed},
+		{name: "current version", expected: "5", wantOK: true},
+		{name: "current version when required", required: true, expected: "5", wantOK: true},
+		{name: "stale version", expected: "4", wantStatus: http.StatusConflict},
+		{name: "version that is no number", expected: "five", wantStatus: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{logger: jsonlog.New(io.Discard, jsonlog.LevelFatal)}
+			app.config.preconditions.required = tt.required
+
+			r := httptest.NewRequest(http.MethodPatch, "/v1/watches/1", nil)
+			for _, value := range tt.ifMatch {
+				r.Header.Add("If-Match", value)
+			}
+			if tt.expected != "" {
+				r.Header.Set("X-Expected-Version", tt.expected)
+			}
+
+			w := httptest.NewRecorder()
+
+			ok := app.checkWritePreconditions(w, r, version)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %t; want %t", ok, tt.wantOK)
+			}
+
+			if tt.wantOK {
+				if w.Body.Len() != 0 {
+					t.Errorf("a response was written: %d %s", w.Code, w.Body)
+				}
+				return
+			}
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d; want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
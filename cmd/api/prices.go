@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/validator"
+	"math"
+	"net/http"
+	"time"
+)
+
+// GET "/v1/watches/:id/prices"
+func (app *application) listWatchPricesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-changed_at,-id")
+	input.Filters.SortSafelist = []string{"id", "changed_at", "-id", "-changed_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Unlike the revisions, the price history is public, so it is hidden
+	// along with watches in the trash.
+	_, err = app.models.Watches.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	prices, metadata, err := app.models.Prices.GetAll(r.Context(), id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"prices": prices, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// annotatePriceDrops sets the previous price and the discount of the watches
+// whose price was lowered within the configured window.
+func (app *application) annotatePriceDrops(ctx context.Context, watches ...*data.Watch) error {
+	if app.config.prices.dropWindow <= 0 || len(watches) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(watches))
+	for i, watch := range watches {
+		ids[i] = watch.ID
+	}
+
+	drops, err := app.models.Prices.GetDrops(ctx, ids, time.Now().Add(-app.config.prices.dropWindow))
+	if err != nil {
+		return err
+	}
+
+	for _, watch := range watches {
+		drop, ok := drops[watch.ID]
+		if !ok {
+			continue
+		}
+
+		previous := drop.PreviousPrice.Amount
+		watch.PreviousPrice = drop.PreviousPrice
+		watch.DiscountPercent = math.Round(float64(previous-drop.Price.Amount)/float64(previous)*1000) / 10
+	}
+
+	return nil
+}
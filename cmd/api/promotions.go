@@ -0,0 +1,378 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/validator"
+	"net/http"
+	"time"
+)
+
+// POST "/v1/promotions"
+func (app *application) createPromotionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code                  string      `json:"code"`
+		Description           string      `json:"description"`
+		Kind                  string      `json:"kind"`
+		PercentOff            int32       `json:"percent_off"`
+		AmountOff             *data.Money `json:"amount_off"`
+		MinOrder              *data.Money `json:"min_order"`
+		BrandID               int64       `json:"brand_id"`
+		WatchID               int64       `json:"watch_id"`
+		MaxRedemptions        int32       `json:"max_redemptions"`
+		MaxRedemptionsPerUser int32       `json:"max_redemptions_per_user"`
+		StartsAt              *time.Time  `json:"starts_at"`
+		EndsAt                *time.Time  `json:"ends_at"`
+		Active                *bool       `json:"active"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	promotion := &data.Promotion{
+		Code:                  input.Code,
+		Description:           input.Description,
+		Kind:                  input.Kind,
+		PercentOff:            input.PercentOff,
+		AmountOff:             data.Money{Currency: data.CatalogCurrency},
+		MinOrder:              data.Money{Currency: data.CatalogCurrency},
+		BrandID:               input.BrandID,
+		WatchID:               input.WatchID,
+		MaxRedemptions:        input.MaxRedemptions,
+		MaxRedemptionsPerUser: input.MaxRedemptionsPerUser,
+		StartsAt:              input.StartsAt,
+		EndsAt:                input.EndsAt,
+		Active:                true,
+	}
+	if input.AmountOff != nil {
+		promotion.AmountOff = *input.AmountOff
+	}
+	if input.MinOrder != nil {
+		promotion.MinOrder = *input.MinOrder
+	}
+	if input.Active != nil {
+		promotion.Active = *input.Active
+	}
+
+	v := validator.New()
+
+	ok, err := app.validatePromotion(r, v, promotion)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Promotions.Insert(r.Context(), promotion)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicatePromotion):
+			v.AddError("code", "a promotion with this code already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/promotions/%d", promotion.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"promotion": promotion}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GET "/v1/promotions/:id"
+func (app *application) showPromotionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	promotion, err := app.models.Promotions.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"promotion": promotion}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// PATCH "/v1/promotions/:id"
+//
+// Changes a promotion. A brand_id or watch_id of 0 makes it apply to every
+// watch again; the redemption count cannot be changed.
+func (app *application) updatePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	promotion, err := app.models.Promotions.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Code                  *string     `json:"code"`
+		Description           *string     `json:"description"`
+		Kind                  *string     `json:"kind"`
+		PercentOff            *int32      `json:"percent_off"`
+		AmountOff             *data.Money `json:"amount_off"`
+		MinOrder              *data.Money `json:"min_order"`
+		BrandID               *int64      `json:"brand_id"`
+		WatchID               *int64      `json:"watch_id"`
+		MaxRedemptions        *int32      `json:"max_redemptions"`
+		MaxRedemptionsPerUser *int32      `json:"max_redemptions_per_user"`
+		StartsAt              *time.Time  `json:"starts_at"`
+		EndsAt                *time.Time  `json:"ends_at"`
+		Active                *bool       `json:"active"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Code != nil {
+		promotion.Code = *input.Code
+	}
+	if input.Description != nil {
+		promotion.Description = *input.Description
+	}
+	if input.Kind != nil {
+		promotion.Kind = *input.Kind
+	}
+	if input.PercentOff != nil {
+		promotion.PercentOff = *input.PercentOff
+	}
+	if input.AmountOff != nil {
+		promotion.AmountOff = *input.AmountOff
+	}
+	if input.MinOrder != nil {
+		promotion.MinOrder = *input.MinOrder
+	}
+	if input.BrandID != nil {
+		promotion.BrandID = *input.BrandID
+	}
+	if input.WatchID != nil {
+		promotion.WatchID = *input.WatchID
+	}
+	if input.MaxRedemptions != nil {
+		promotion.MaxRedemptions = *input.MaxRedemptions
+	}
+	if input.MaxRedemptionsPerUser != nil {
+		promotion.MaxRedemptionsPerUser = *input.MaxRedemptionsPerUser
+	}
+	if input.StartsAt != nil {
+		promotion.StartsAt = input.StartsAt
+	}
+	if input.EndsAt != nil {
+		promotion.EndsAt = input.EndsAt
+	}
+	if input.Active != nil {
+		promotion.Active = *input.Active
+	}
+
+	v := validator.New()
+
+	v.Check(promotion.MaxRedemptions <= 0 || promotion.MaxRedemptions >= promotion.RedemptionCount, "max_redemptions",
+		fmt.Sprintf("must not be less than the %d redemptions already made", promotion.RedemptionCount))
+
+	ok, err := app.validatePromotion(r, v, promotion)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Promotions.Update(r.Context(), promotion)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicatePromotion):
+			v.AddError("code", "a promotion with this code already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrPromotionOverRedeemed):
+			v.AddError("max_redemptions", "must not be less than the redemptions already made")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"promotion": promotion}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// DELETE "/v1/promotions/:id"
+//
+// Deletes a promotion, or deactivates it if orders were placed with it, so
+// that their redemptions are kept and can be given back if the orders are
+// cancelled.
+func (app *application) deletePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	message := "promotion successfully deleted"
+
+	err = app.models.Promotions.Delete(r.Context(), id)
+	if errors.Is(err, data.ErrPromotionRedeemed) {
+		message = "promotion deactivated, as orders were placed with it"
+		err = app.models.Promotions.Deactivate(r.Context(), id)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GET "/v1/promotions"
+func (app *application) listPromotionsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.PromotionFilter
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.PromotionFilter.Code = app.readString(qs, "code", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"id", "code", "created_at", "redemption_count", "-id", "-code", "-created_at", "-redemption_count"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	promotions, metadata, err := app.models.Promotions.GetAll(r.Context(), input.PromotionFilter, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"promotions": promotions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// validatePromotion validates promotion, checking through the brand and
+// watch models that the brand or watch it targets exists. It reports whether
+// the promotion is valid.
+func (app *application) validatePromotion(r *http.Request, v *validator.Validator, promotion *data.Promotion) (bool, error) {
+	if data.ValidatePromotion(v, promotion); !v.Valid() {
+		return false, nil
+	}
+
+	if promotion.BrandID != 0 {
+		_, err := app.models.Brands.Get(r.Context(), promotion.BrandID)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("brand_id", "must reference an existing brand")
+		case err != nil:
+			return false, err
+		}
+	}
+
+	if promotion.WatchID != 0 {
+		_, err := app.models.Watches.Get(r.Context(), promotion.WatchID)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("watch_id", "must reference an existing watch")
+		case err != nil:
+			return false, err
+		}
+	}
+
+	return v.Valid(), nil
+}
+
+// applyPromotion takes the discount of the promotion with the given code off
+// cart, for the user making the request. If the promotion does not apply,
+// the reason is added to v and the cart is left as it is.
+func (app *application) applyPromotion(r *http.Request, cart *data.Cart, code string, v *validator.Validator) error {
+	promotion, err := app.models.Promotions.GetByCode(r.Context(), code)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("promotion_code", "does not exist")
+			return nil
+		}
+		return err
+	}
+
+	var used int32
+
+	user := app.contextGetUser(r)
+	if !user.IsAnonymous() {
+		used, err = app.models.Promotions.CountRedemptions(r.Context(), promotion.ID, user.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	discount, err := promotion.Price(cart.PricedLines(), used, time.Now())
+	if err != nil {
+		var promotionErr *data.PromotionError
+		if errors.As(err, &promotionErr) {
+			v.AddError("promotion_code", promotionErr.Reason)
+			return nil
+		}
+		return err
+	}
+
+	cart.ApplyDiscount(discount)
+
+	return nil
+}
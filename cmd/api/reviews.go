@@ -0,0 +1,364 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/validator"
+	"net/http"
+	"net/url"
+)
+
+// GET "/v1/watches/:id/reviews"
+//
+// Lists the approved reviews of a watch. Users with reviews:moderate may ask
+// for the reviews in another status.
+func (app *application) listWatchReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	moderator, err := app.hasPermission(r, "reviews:moderate")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	filter := data.ReviewFilter{WatchID: id, Status: data.ReviewApproved}
+	if moderator {
+		filter.Status = app.readString(qs, "status", data.ReviewApproved)
+		data.ValidateReviewStatus(v, filter.Status)
+	}
+
+	filters := app.readReviewFilters(qs, "-created_at", v)
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	watch, err := app.models.Watches.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	reviews, metadata, err := app.models.Reviews.GetAll(r.Context(), filter, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	rating := envelope{"average_rating": watch.AverageRating, "review_count": watch.ReviewCount}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reviews": reviews, "rating": rating, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GET "/v1/reviews"
+//
+// Lists the reviews of every watch for moderation, by default the ones
+// waiting for it.
+func (app *application) listReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	filter := data.ReviewFilter{
+		WatchID: int64(app.readInt(qs, "watch_id", 0, v)),
+		Status:  app.readString(qs, "status", data.ReviewPending),
+	}
+
+	v.Check(filter.WatchID >= 0, "watch_id", "must be a positive integer")
+	data.ValidateReviewStatus(v, filter.Status)
+
+	// The queue is oldest first, so reviews are moderated in the order
+	// they were written.
+	filters := app.readReviewFilters(qs, "created_at", v)
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	reviews, metadata, err := app.models.Reviews.GetAll(r.Context(), filter, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reviews": reviews, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// POST "/v1/watches/:id/reviews"
+//
+// Adds the review of the user to a watch. It waits for moderation before it
+// is published.
+func (app *application) createReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Rating int8   `json:"rating"`
+		Title  string `json:"title"`
+		Body   string `json:"body"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	review := &data.Review{
+		WatchID: id,
+		UserID:  app.contextGetUser(r).ID,
+		Rating:  input.Rating,
+		Title:   input.Title,
+		Body:    input.Body,
+		Status:  data.ReviewPending,
+	}
+
+	v := validator.New()
+
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Reviews.Insert(r.Context(), review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateReview):
+			v.AddError("watch_id", "you have already reviewed this watch")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/watches/%d/reviews/%d", id, review.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"review": review}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// GET "/v1/watches/:id/reviews/:review_id"
+func (app *application) showReviewHandler(w http.ResponseWriter, r *http.Request) {
+	review, _, ok := app.requestReview(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// PATCH "/v1/watches/:id/reviews/:review_id"
+//
+// Lets the author of a review change it, which sends it back to moderation.
+func (app *application) updateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	review, _, ok := app.requestReview(w, r)
+	if !ok {
+		return
+	}
+
+	if review.UserID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Rating *int8   `json:"rating"`
+		Title  *string `json:"title"`
+		Body   *string `json:"body"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Rating != nil {
+		review.Rating = *input.Rating
+	}
+	if input.Title != nil {
+		review.Title = *input.Title
+	}
+	if input.Body != nil {
+		review.Body = *input.Body
+	}
+	review.Status = data.ReviewPending
+
+	v := validator.New()
+
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.updateReview(w, r, review)
+}
+
+// PUT "/v1/watches/:id/reviews/:review_id/status"
+//
+// Approves or rejects a review, or sends it back to moderation.
+func (app *application) updateReviewStatusHandler(w http.ResponseWriter, r *http.Request) {
+	review, _, ok := app.requestReview(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateReviewStatus(v, input.Status); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	review.Status = input.Status
+
+	app.updateReview(w, r, review)
+}
+
+// DELETE "/v1/watches/:id/reviews/:review_id"
+//
+// Removes a review, which its author and moderators may do.
+func (app *application) deleteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	review, moderator, ok := app.requestReview(w, r)
+	if !ok {
+		return
+	}
+
+	if review.UserID != app.contextGetUser(r).ID && !moderator {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err := app.models.Reviews.Delete(r.Context(), review.WatchID, review.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "review successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateReview writes the changes to review and responds with it.
+func (app *application) updateReview(w http.ResponseWriter, r *http.Request, review *data.Review) {
+	err := app.models.Reviews.Update(r.Context(), review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// requestReview returns the review named by the :id and :review_id of the
+// request, and whether the user making the request holds reviews:moderate.
+// It responds with 404 Not Found if there is no such review, or if it is not
+// approved and the user neither wrote it nor moderates reviews.
+func (app *application) requestReview(w http.ResponseWriter, r *http.Request) (*data.Review, bool, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false, false
+	}
+
+	reviewID, err := app.readNamedIDParam(r, "review_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false, false
+	}
+
+	review, err := app.models.Reviews.Get(r.Context(), id, reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false, false
+	}
+
+	moderator, err := app.hasPermission(r, "reviews:moderate")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false, false
+	}
+
+	if review.Status != data.ReviewApproved && review.UserID != app.contextGetUser(r).ID && !moderator {
+		app.notFoundResponse(w, r)
+		return nil, false, false
+	}
+
+	return review, moderator, true
+}
+
+// readReviewFilters reads the page and sort parameters of a list of reviews.
+func (app *application) readReviewFilters(qs url.Values, defaultSort string, v *validator.Validator) data.Filters {
+	return data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         app.readString(qs, "sort", defaultSort),
+		SortSafelist: []string{"id", "created_at", "rating", "-id", "-created_at", "-rating"},
+	}
+}
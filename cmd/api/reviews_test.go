@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"jewelry.abgdrv.com/internal/data"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReviews(t *testing.T) {
+	ts := newTestServer(t)
+
+	manager := ts.newUser("manager@example.com", "watches:read", "watches:write", "brands:write")
+	moderator := ts.newUser("moderator@example.com", "watches:read", "reviews:moderate")
+	alice := ts.newUser("alice@example.com", "watches:read")
+	bob := ts.newUser("bob@example.com", "watches:read")
+	carol := ts.newUser("carol@example.com", "watches:read")
+
+	// A user who has not activated their account yet.
+	inactive := &data.User{Name: "Dave", Email: "dave@example.com"}
+
+	err := ts.app.models.Users.Insert(context.Background(), inactive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ts.app.models.Permissions.AddForUser(context.Background(), inactive.ID, "watches:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := ts.app.models.Tokens.New(context.Background(), inactive.ID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dave := token.Plaintext
+
+	ts.mustDo(http.StatusCreated, http.MethodPost, "/v1/watches", manager, map[string]interface{}{
+		"brand":      "Omega",
+		"model":      "Seamaster",
+		"dial_color": "blue",
+		"strap_type": "steel",
+		"diameter":   42,
+		"energy":     "mechanical",
+		"gender":     "male",
+		"price":      "5200.00",
+		"image_url":  "https://example.com/seamaster.png",
+	})
+
+	review := func(rating int) map[string]interface{} {
+		return map[string]interface{}{"rating": rating, "title": "My watch", "body": "Keeps good time."}
+	}
+	status := func(status string) map[string]interface{} {
+		return map[string]interface{}{"status": status}
+	}
+
+	// The steps run in order on the same watch. Reviews 1, 2 and 3 are those
+	// of Alice, Bob and Carol. wantCount < 0 skips checking the rating.
+	tests := []struct {
+		name       string
+		token      string
+		method     string
+		path       string
+		body       interface{}
+		wantStatus int
+		wantRating float64
+		wantCount  int
+	}{
+		{"anonymous review", "", http.MethodPost, "/v1/watches/1/reviews", review(5), http.StatusUnauthorized, 0, -1},
+		{"review before activation", dave, http.MethodPost, "/v1/watches/1/reviews", review(5), http.StatusForbidden, 0, -1},
+		{"rating out of range", alice, http.MethodPost, "/v1/watches/1/reviews", review(6), http.StatusUnprocessableEntity, 0, -1},
+		{"review of a missing watch", alice, http.MethodPost, "/v1/watches/2/reviews", review(5), http.StatusNotFound, 0, -1},
+		{"review by Alice", alice, http.MethodPost, "/v1/watches/1/reviews", review(5), http.StatusCreated, 0, 0},
+		{"second review by Alice", alice, http.MethodPost, "/v1/watches/1/reviews", review(4), http.StatusUnprocessableEntity, 0, -1},
+		{"review by Bob", bob, http.MethodPost, "/v1/watches/1/reviews", review(2), http.StatusCreated, 0, -1},
+		{"review by Carol", carol, http.MethodPost, "/v1/watches/1/reviews", review(4), http.StatusCreated, 0, 0},
+
+		{"pending review seen by its author", alice, http.MethodGet, "/v1/watches/1/reviews/1", nil, http.StatusOK, 0, -1},
+		{"pending review seen by a moderator", moderator, http.MethodGet, "/v1/watches/1/reviews/1", nil, http.StatusOK, 0, -1},
+		{"pending review seen by another user", bob, http.MethodGet, "/v1/watches/1/reviews/1", nil, http.StatusNotFound, 0, -1},
+		{"approval by the author", alice, http.MethodPut, "/v1/watches/1/reviews/1/status", status(data.ReviewApproved), http.StatusForbidden, 0, -1},
+
+		{"approval of Alice's review", moderator, http.MethodPut, "/v1/watches/1/reviews/1/status", status(data.ReviewApproved), http.StatusOK, 5, 1},
+		{"approved review seen by another user", bob, http.MethodGet, "/v1/watches/1/reviews/1", nil, http.StatusOK, 0, -1},
+		{"change by another user", bob, http.MethodPatch, "/v1/watches/1/reviews/1", review(1), http.StatusForbidden, 0, -1},
+		{"deletion by another user", bob, http.MethodDelete, "/v1/watches/1/reviews/1", nil, http.StatusForbidden, 0, -1},
+		{"approval of Bob's review", moderator, http.MethodPut, "/v1/watches/1/reviews/2/status", status(data.ReviewApproved), http.StatusOK, 3.5, 2},
+		{"rejection of Carol's review", moderator, http.MethodPut, "/v1/watches/1/reviews/3/status", status(data.ReviewRejected), http.StatusOK, 3.5, 2},
+		{"unknown status", moderator, http.MethodPut, "/v1/watches/1/reviews/3/status", status("hidden"), http.StatusUnprocessableEntity, 3.5, 2},
+
+		// Changing a review sends it back to moderation, so it stops counting.
+		{"change by Alice", alice, http.MethodPatch, "/v1/watches/1/reviews/1", review(1), http.StatusOK, 2, 1},
+		{"approval of the change", moderator, http.MethodPut, "/v1/watches/1/reviews/1/status", status(data.ReviewApproved), http.StatusOK, 1.5, 2},
+		{"deletion by a moderator", moderator, http.MethodDelete, "/v1/watches/1/reviews/2", nil, http.StatusOK, 1, 1},
+		{"deletion by the author", alice, http.MethodDelete, "/v1/watches/1/reviews/1", nil, http.StatusOK, 0, 0},
+		{"review by Bob after the deletion", bob, http.MethodPost, "/v1/watches/1/reviews", review(3), http.StatusCreated, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, response := ts.do(tt.method, tt.path, tt.token, tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("status %d; want %d: %v", status, tt.wantStatus, response)
+			}
+
+			if tt.wantCount < 0 {
+				return
+			}
+
+			watch := ts.mustDo(http.StatusOK, http.MethodGet, "/v1/watches/1", manager, nil)["watch"].(map[string]interface{})
+
+			if rating := watch["average_rating"].(float64); rating != tt.wantRating {
+				t.Errorf("average rating %v; want %v", rating, tt.wantRating)
+			}
+			if count := int(watch["review_count"].(float64)); count != tt.wantCount {
+				t.Errorf("review count %d; want %d", count, tt.wantCount)
+			}
+		})
+	}
+
+	// Only approved reviews are listed, unless a moderator asks for others.
+	listings := []struct {
+		name      string
+		token     string
+		path      string
+		wantCount int
+	}{
+		{"approved", carol, "/v1/watches/1/reviews", 0},
+		{"pending asked by a user", carol, "/v1/watches/1/reviews?status=pending", 0},
+		{"pending asked by a moderator", moderator, "/v1/watches/1/reviews?status=pending", 1},
+		{"rejected asked by a moderator", moderator, "/v1/watches/1/reviews?status=rejected", 1},
+	}
+
+	for _, tt := range listings {
+		t.Run("listing "+tt.name, func(t *testing.T) {
+			response := ts.mustDo(http.StatusOK, http.MethodGet, tt.path, tt.token, nil)
+			if reviews := response["reviews"].([]interface{}); len(reviews) != tt.wantCount {
+				t.Errorf("listed %d reviews; want %d", len(reviews), tt.wantCount)
+			}
+		})
+	}
+}
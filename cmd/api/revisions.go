@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/validator"
+	"math"
+	"net/http"
+)
+
+// GET "/v1/watches/:id/revisions"
+func (app *application) listWatchRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-version")
+	input.Filters.SortSafelist = []string{"version", "-version"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revisions, metadata, err := app.models.Revisions.GetAll(r.Context(), id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The history of a watch in the trash stays readable, but a watch with no
+	// revisions at all has to exist.
+	if len(revisions) == 0 {
+		_, err = app.models.Watches.Get(r.Context(), id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revisions": revisions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// POST "/v1/watches/:id/revisions/:version/revert"
+//
+// The reverted fields are written on top of the current version of the watch,
+// so the revert fails with an edit conflict if the watch changes meanwhile.
+// The stock level and the image gallery are not part of the history.
+func (app *application) revertWatchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	version, err := app.readNamedIDParam(r, "version")
+	if err != nil || version > math.MaxInt32 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	revision, err := app.models.Revisions.Get(r.Context(), id, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	watch, err := app.models.Watches.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.checkWritePreconditions(w, r, watch.Version) {
+		return
+	}
+
+	snapshot := revision.Snapshot
+
+	watch.Brand = snapshot.Brand
+	watch.BrandID = snapshot.BrandID
+	watch.Model = snapshot.Model
+	watch.DialColor = snapshot.DialColor
+	watch.StrapType = snapshot.StrapType
+	watch.Diameter = snapshot.Diameter
+	watch.Energy = snapshot.Energy
+	watch.Gender = snapshot.Gender
+	watch.Price = snapshot.Price
+	watch.SKU = snapshot.SKU
+
+	// image_url follows the primary image of the gallery, if there is one.
+	images, err := app.models.Images.GetAllForWatches(r.Context(), []int64{watch.ID})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if len(images[watch.ID]) == 0 {
+		watch.ImageURL = snapshot.ImageURL
+	}
+
+	v := validator.New()
+
+	err = app.resolveBrand(r, watch, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidateWatch(v, watch); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Watches.Revert(r.Context(), watch)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateSKU):
+			v.AddError("sku", "a watch with this sku already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.writeConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.annotatePriceDrops(r.Context(), watch)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeWatchJSON(w, r, http.StatusOK, envelope{"watch": watch}, watch.Version)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -19,16 +19,148 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodPost, "/v1/watches",
 		app.requirePermission("watches:write", app.createWatchHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/watches/:id",
-		app.requirePermission("watches:read", app.showWatchHandler))
+		app.staticOrID(map[string]http.HandlerFunc{
+			"facets": app.requirePermission("watches:read", app.watchFacetsHandler),
+			"trash":  app.requirePermission("watches:write", app.listTrashedWatchesHandler),
+			"export": app.requirePermission("watches:read", app.exportWatchesHandler),
+		}, app.requirePermission("watches:read", app.showWatchHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/watches/:id",
+		app.staticOrID(map[string]http.HandlerFunc{
+			"import": app.requirePermission("watches:write", app.importWatchesHandler),
+		}, app.methodNotAllowedResponse))
 	router.HandlerFunc(http.MethodPatch, "/v1/watches/:id",
 		app.requirePermission("watches:write", app.updateWatchHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/watches/:id",
 		app.requirePermission("watches:write", app.deleteWatchHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/watches/:id/restore",
+		app.requirePermission("watches:write", app.restoreWatchHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/watches/:id/purge",
+		app.requirePermission("watches:purge", app.purgeWatchHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/watches/:id/revisions",
+		app.requirePermission("watches:write", app.listWatchRevisionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/watches/:id/revisions/:version/revert",
+		app.requirePermission("watches:write", app.revertWatchHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/watches/:id/prices",
+		app.requirePermission("watches:read", app.listWatchPricesHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/watches/:id/images",
+		app.requirePermission("watches:read", app.listWatchImagesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/watches/:id/images",
+		app.requirePermission("watches:write", app.uploadWatchImageHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/watches/:id/images/:image_id",
+		app.requirePermission("watches:write", app.updateWatchImageHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/watches/:id/images/:image_id",
+		app.requirePermission("watches:write", app.deleteWatchImageHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/watches/:id/reviews",
+		app.requirePermission("watches:read", app.listWatchReviewsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/watches/:id/reviews", app.requireActivatedUser(app.createReviewHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/watches/:id/reviews/:review_id",
+		app.requirePermission("watches:read", app.showReviewHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/watches/:id/reviews/:review_id", app.requireActivatedUser(app.updateReviewHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/watches/:id/reviews/:review_id", app.requireActivatedUser(app.deleteReviewHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/watches/:id/reviews/:review_id/status",
+		app.requirePermission("reviews:moderate", app.updateReviewStatusHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/reviews",
+		app.requirePermission("reviews:moderate", app.listReviewsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/watches/:id/stock",
+		app.requirePermission("inventory:write", app.listStockMovementsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/watches/:id/stock",
+		app.requirePermission("inventory:write", app.recordStockMovementHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/brands",
+		app.requirePermission("watches:read", app.listBrandsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/brands",
+		app.requirePermission("brands:write", app.createBrandHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/brands/:id",
+		app.requirePermission("watches:read", app.showBrandHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/brands/:id",
+		app.requirePermission("brands:write", app.updateBrandHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/brands/:id",
+		app.requirePermission("brands:write", app.deleteBrandHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/promotions",
+		app.requirePermission("promotions:write", app.listPromotionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/promotions",
+		app.requirePermission("promotions:write", app.createPromotionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/promotions/:id",
+		app.requirePermission("promotions:write", app.showPromotionHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/promotions/:id",
+		app.requirePermission("promotions:write", app.updatePromotionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/promotions/:id",
+		app.requirePermission("promotions:write", app.deletePromotionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/currencies",
+		app.requirePermission("watches:read", app.listCurrencyRatesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/currencies/:code",
+		app.requirePermission("currencies:write", app.setCurrencyRateHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/currencies/:code",
+		app.requirePermission("currencies:write", app.deleteCurrencyRateHandler))
+
+	// Carts are open to guests, who are told apart by their cart token.
+	router.HandlerFunc(http.MethodGet, "/v1/cart", app.showCartHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/cart", app.clearCartHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/cart/items", app.addCartItemHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/cart/items/:id", app.updateCartItemHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/cart/items/:id", app.removeCartItemHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/orders", app.requireActivatedUser(app.listOrdersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/orders", app.requireActivatedUser(app.createOrderHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/orders/:id", app.requireActivatedUser(app.showOrderHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/orders/:id/cancel", app.requireActivatedUser(app.cancelOrderHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/orders/:id/payment", app.requireActivatedUser(app.createOrderPaymentHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/orders/:id/status",
+		app.requirePermission("orders:manage", app.updateOrderStatusHandler))
+
+	// The payment provider authenticates with the signature of its events.
+	router.HandlerFunc(http.MethodPost, "/v1/payments/webhook", app.paymentWebhookHandler)
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
 
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/wishlist",
+		app.requirePermission("wishlist:write", app.listWishlistHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/wishlist",
+		app.requirePermission("wishlist:write", app.addWishlistItemHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/wishlist/:id",
+		app.staticOrID(map[string]http.HandlerFunc{
+			"share": app.requirePermission("wishlist:write", app.shareWishlistHandler),
+		}, app.methodNotAllowedResponse))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/wishlist/:id",
+		app.requirePermission("wishlist:write", app.updateWishlistItemHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/wishlist/:id",
+		app.staticOrID(map[string]http.HandlerFunc{
+			"share": app.requirePermission("wishlist:write", app.unshareWishlistHandler),
+		}, app.requirePermission("wishlist:write", app.removeWishlistItemHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/wishlists/:token", app.showSharedWishlistHandler)
+
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
 
+	// Stores that keep files on this server also serve them.
+	if handler, ok := app.blobs.(http.Handler); ok {
+		router.Handler(http.MethodGet, "/images/*filepath", http.StripPrefix("/images", handler))
+	}
+
 	return app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router))))
 }
+
+// staticOrID serves requests whose :id segment is one of the static names in
+// routes with that name's handler, and all others with next. httprouter
+// rejects a static segment next to a wildcard, so routes such as
+// /v1/watches/facets have to be reached through /v1/watches/:id.
+func (app *application) staticOrID(routes map[string]http.HandlerFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if handler, ok := routes[params.ByName("id")]; ok {
+			handler(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
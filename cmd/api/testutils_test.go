@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/jsonlog"
+	"jewelry.abgdrv.com/internal/payments"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// testServer runs the API on the in-memory models. Its fake payment provider
+// keeps the webhook deliveries it makes, for the test to post when it likes.
+type testServer struct {
+	*httptest.Server
+	t   *testing.T
+	app *application
+
+	mu         sync.Mutex
+	deliveries []delivery
+}
+
+// delivery is a webhook event as the payment provider would post it.
+type delivery struct {
+	payload   []byte
+	signature string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	var cfg config
+	cfg.env = "development"
+	cfg.cart.secret = "test-cart-secret"
+	cfg.payments.webhookSecret = testWebhookSecret
+
+	// The mailer is left unconfigured: the background sends fail and are
+	// logged to nowhere.
+	app := &application{
+		config: cfg,
+		logger: jsonlog.New(io.Discard, jsonlog.LevelFatal),
+		models: data.NewMockModels(),
+	}
+
+	ts := &testServer{t: t, app: app}
+
+	app.payments = payments.NewFake(testWebhookSecret, func(payload []byte, signature string) {
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		ts.deliveries = append(ts.deliveries, delivery{payload, signature})
+	})
+
+	ts.Server = httptest.NewServer(app.routes())
+
+	t.Cleanup(func() {
+		ts.Close()
+		app.wg.Wait()
+	})
+
+	return ts
+}
+
+// newUser adds an activated user with the given permissions and returns an
+// authentication token for them.
+func (ts *testServer) newUser(email string, permissions ...string) string {
+	ts.t.Helper()
+
+	ctx := context.Background()
+
+	user := &data.User{Name: "Test User", Email: email, Activated: true}
+
+	err := user.Password.Set("pa55word1234")
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	err = ts.app.models.Users.Insert(ctx, user)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	if len(permissions) > 0 {
+		err = ts.app.models.Permissions.AddForUser(ctx, user.ID, permissions...)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+
+	token, err := ts.app.models.Tokens.New(ctx, user.ID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	return token.Plaintext
+}
+
+// do sends a request with body encoded as JSON, authenticated with token if
+// it is not empty, and returns the status code and the decoded response.
+func (ts *testServer) do(method, path, token string, body interface{}) (int, map[string]interface{}) {
+	ts.t.Helper()
+
+	return ts.send(ts.newRequest(method, path, token, body))
+}
+
+// newRequest is the request do sends, for tests to add headers to.
+func (ts *testServer) newRequest(method, path, token string, body interface{}) *http.Request {
+	ts.t.Helper()
+
+	var rd io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		rd = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(method, ts.URL+path, rd)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return req
+}
+
+// deliver posts a webhook delivery with the given signature header.
+func (ts *testServer) deliver(payload []byte, signature string) (int, map[string]interface{}) {
+	ts.t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/payments/webhook", bytes.NewReader(payload))
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(payments.SignatureHeader, signature)
+
+	return ts.send(req)
+}
+
+// send sends req and returns the status code and the decoded response.
+func (ts *testServer) send(req *http.Request) (int, map[string]interface{}) {
+	ts.t.Helper()
+
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var body map[string]interface{}
+
+	dec := json.NewDecoder(res.Body)
+
+	err = dec.Decode(&body)
+	if err != nil && err != io.EOF {
+		ts.t.Fatalf("%s %s: decoding the response: %v", req.Method, req.URL.Path, err)
+	}
+	if dec.More() {
+		ts.t.Fatalf("%s %s: the response holds more than one JSON value", req.Method, req.URL.Path)
+	}
+
+	return res.StatusCode, body
+}
+
+// takeDeliveries returns the webhook deliveries made since the last call.
+func (ts *testServer) takeDeliveries() []delivery {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	deliveries := ts.deliveries
+	ts.deliveries = nil
+	return deliveries
+}
+
+// mustDo is do for requests that have to succeed with the status want.
+func (ts *testServer) mustDo(want int, method, path, token string, body interface{}) map[string]interface{} {
+	ts.t.Helper()
+
+	status, response := ts.do(method, path, token, body)
+	if status != want {
+		ts.t.Fatalf("%s %s: status %d; want %d: %v", method, path, status, want, response)
+	}
+	return response
+}
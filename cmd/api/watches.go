@@ -1,28 +1,34 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/patch"
 	"jewelry.abgdrv.com/internal/validator"
-	"math"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // POST "/v1/watches"
 func (app *application) createWatchHandler(w http.ResponseWriter, r *http.Request) {
 
 	var input struct {
-		Brand     string  `json:"brand"`
-		Model     string  `json:"model,omitempty"`
-		DialColor string  `json:"dial_color"`
-		StrapType string  `json:"strap_type"`
-		Diameter  int8    `json:"diameter"`
-		Energy    string  `json:"energy"`
-		Gender    string  `json:"gender"`
-		Price     float64 `json:"price"`
-		ImageURL  string  `json:"image_url"`
+		Brand     string     `json:"brand"`
+		BrandID   int64      `json:"brand_id"`
+		Model     string     `json:"model,omitempty"`
+		DialColor string     `json:"dial_color"`
+		StrapType string     `json:"strap_type"`
+		Diameter  int8       `json:"diameter"`
+		Energy    string     `json:"energy"`
+		Gender    string     `json:"gender"`
+		Price     data.Money `json:"price"`
+		ImageURL  string     `json:"image_url"`
+		SKU       string     `json:"sku"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -33,6 +39,7 @@ func (app *application) createWatchHandler(w http.ResponseWriter, r *http.Reques
 
 	watch := &data.Watch{
 		Brand:     input.Brand,
+		BrandID:   input.BrandID,
 		Model:     input.Model,
 		DialColor: input.DialColor,
 		StrapType: input.StrapType,
@@ -41,17 +48,31 @@ func (app *application) createWatchHandler(w http.ResponseWriter, r *http.Reques
 		Gender:    input.Gender,
 		Price:     input.Price,
 		ImageURL:  input.ImageURL,
+		SKU:       input.SKU,
 	}
 
 	v := validator.New()
+
+	err = app.resolveBrand(r, watch, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	if data.ValidateWatch(v, watch); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Watches.Insert(watch)
+	err = app.models.Watches.Insert(r.Context(), watch)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateSKU):
+			v.AddError("sku", "a watch with this sku already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -62,8 +83,6 @@ func (app *application) createWatchHandler(w http.ResponseWriter, r *http.Reques
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
-
-	fmt.Fprintf(w, "%+v\n", input)
 }
 
 // GET "/v1/watches/:id"
@@ -74,7 +93,22 @@ func (app *application) showWatchHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	watch, err := app.models.Watches.Get(id)
+	v := validator.New()
+
+	shape := app.readShape(r.URL.Query(), data.Watch{}, app.watchIncluders(), v)
+
+	rate, err := app.readCurrencyRate(r.Context(), r.URL.Query(), v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	watch, err := app.models.Watches.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -85,12 +119,37 @@ func (app *application) showWatchHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"watch": watch}, nil)
+	err = app.annotatePriceDrops(r.Context(), watch)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
+
+	app.convertPrices(rate, watch)
+
+	shaped, err := app.shapeWatches(r.Context(), shape, []*data.Watch{watch})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeWatchJSON(w, r, http.StatusOK, envelope{"watch": shaped[0]}, watch.Version)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readOnlyWatchFields are the members of a watch that a patch may test but
+// not change.
+var readOnlyWatchFields = []string{
+	"id", "stock_quantity", "version", "deleted_at", "relevance", "previous_price", "discount_percent",
+	"average_rating", "review_count",
 }
 
+// PATCH "/v1/watches/:id"
+//
+// The body is a JSON Merge Patch or, sent as application/json-patch+json, a
+// JSON Patch, applied to the watch as GET returns it without shaping.
 func (app *application) updateWatchHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
@@ -98,7 +157,7 @@ func (app *application) updateWatchHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	watch, err := app.models.Watches.Get(id)
+	watch, err := app.models.Watches.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -109,174 +168,412 @@ func (app *application) updateWatchHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if r.Header.Get("X-Expected-Version") != "" {
-		if strconv.FormatInt(int64(watch.Version), 32) != r.Header.Get("X-Expected-Version") {
-			app.editConflictResponse(w, r)
-			return
-		}
+	if !app.checkWritePreconditions(w, r, watch.Version) {
+		return
 	}
 
-	var input struct {
-		Brand     *string  `json:"brand"`
-		Model     *string  `json:"model,omitempty"`
-		DialColor *string  `json:"dial_color"`
-		StrapType *string  `json:"strap_type"`
-		Diameter  *int8    `json:"diameter"`
-		Energy    *string  `json:"energy"`
-		Gender    *string  `json:"gender"`
-		Price     *float64 `json:"price"`
-		ImageURL  *string  `json:"image_url"`
+	p, err := app.readPatch(w, r)
+	if err != nil {
+		switch {
+		case errors.Is(err, patch.ErrUnsupportedMediaType):
+			app.unsupportedPatchTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
 	}
 
-	err = app.readJSON(w, r, &input)
+	var patched data.Watch
+
+	v := validator.New()
+
+	err = patch.Apply(p, watch, &patched, readOnlyWatchFields...)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		var readOnlyError *patch.ReadOnlyError
+
+		switch {
+		case errors.Is(err, patch.ErrTestFailed):
+			app.patchTestFailedResponse(w, r, err)
+		case errors.As(err, &readOnlyError):
+			v.AddError(readOnlyError.Member, "cannot be changed")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.unprocessablePatchResponse(w, r, err)
+		}
 		return
 	}
 
-	if input.Brand != nil {
-		watch.Brand = *input.Brand
+	// The fields outside the JSON encoding are not patched.
+	patched.CreatedAt = watch.CreatedAt
+
+	if patched.ImageURL != watch.ImageURL {
+		images, err := app.models.Images.GetAllForWatches(r.Context(), []int64{watch.ID})
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if len(images[watch.ID]) > 0 {
+			v.AddError("image_url", "is set from the primary image of the watch")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
 	}
-	if input.Model != nil {
-		watch.Model = *input.Model
+
+	// A new brand_id takes precedence over a new brand name, which is
+	// looked up or created. Removing brand_id alone leaves the brand as it
+	// was.
+	resolve := true
+
+	switch {
+	case patched.BrandID != watch.BrandID && patched.BrandID != 0:
+	case patched.Brand != watch.Brand:
+		patched.BrandID = 0
+	default:
+		patched.BrandID = watch.BrandID
+		resolve = false
 	}
-	if input.DialColor != nil {
-		watch.DialColor = *input.DialColor
+
+	watch = &patched
+
+	if resolve {
+		err = app.resolveBrand(r, watch, v)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 	}
-	if input.StrapType != nil {
-		watch.StrapType = *input.StrapType
+
+	if data.ValidateWatch(v, watch); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
 	}
-	if input.Diameter != nil {
-		watch.Diameter = *input.Diameter
+
+	err = app.models.Watches.Update(r.Context(), watch)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateSKU):
+			v.AddError("sku", "a watch with this sku already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.writeConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
 	}
-	if input.Energy != nil {
-		watch.Energy = *input.Energy
+
+	err = app.annotatePriceDrops(r.Context(), watch)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
-	if input.Gender != nil {
-		watch.Gender = *input.Gender
+
+	err = app.writeWatchJSON(w, r, http.StatusOK, envelope{"watch": watch}, watch.Version)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 	}
-	if input.Price != nil {
-		watch.Price = *input.Price
+}
+
+func (app *application) deleteWatchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
 	}
-	if input.ImageURL != nil {
-		watch.ImageURL = *input.ImageURL
+
+	version, ok := app.writeVersion(w, r, id, app.models.Watches.Get)
+	if !ok {
+		return
 	}
 
-	v := validator.New()
-	if data.ValidateWatch(v, watch); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	err = app.models.Watches.Delete(r.Context(), id, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.writeConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "watch moved to the trash"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// POST "/v1/watches/:id/restore"
+func (app *application) restoreWatchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	version, ok := app.writeVersion(w, r, id, app.models.Watches.GetTrashed)
+	if !ok {
 		return
 	}
 
-	err = app.models.Watches.Update(watch)
+	err = app.models.Watches.Restore(r.Context(), id, version)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
-			app.editConflictResponse(w, r)
+			app.writeConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"watch": watch}, nil)
+	watch, err := app.models.Watches.Get(r.Context(), id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.annotatePriceDrops(r.Context(), watch)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeWatchJSON(w, r, http.StatusOK, envelope{"watch": watch}, watch.Version)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) deleteWatchHandler(w http.ResponseWriter, r *http.Request) {
+// DELETE "/v1/watches/:id/purge"
+func (app *application) purgeWatchHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
 
-	err = app.models.Watches.Delete(id)
+	version, ok := app.writeVersion(w, r, id, app.models.Watches.GetTrashed)
+	if !ok {
+		return
+	}
+
+	images, err := app.models.Images.GetAllForWatches(r.Context(), []int64{id})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Watches.Purge(r.Context(), id, version)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.writeConflictResponse(w, r)
+		case errors.Is(err, data.ErrWatchInUse):
+			app.watchInUseResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "watch successfully deleted"}, nil)
+	app.deleteImageBlobs(images[id]...)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "watch permanently deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
 func (app *application) listWatchesHandler(w http.ResponseWriter, r *http.Request) {
+	app.listWatches(w, r, false)
+}
+
+// GET "/v1/watches/trash"
+func (app *application) listTrashedWatchesHandler(w http.ResponseWriter, r *http.Request) {
+	app.listWatches(w, r, true)
+}
+
+// listWatches serves a listing of the watches in the trash or, when deleted
+// is false, of all others.
+func (app *application) listWatches(w http.ResponseWriter, r *http.Request, deleted bool) {
 	var input struct {
-		Brand      string
-		DialColor  string
-		StrapType  string
-		Diameter   int8
-		Energy     string
-		Gender     string
-		PriceRange []int
-		Filters    data.Filters
+		Filter  data.WatchFilter
+		Filters data.Filters
+		Shape   shape
+		Rate    *data.CurrencyRate
 	}
 
 	v := validator.New()
 
 	qs := r.URL.Query()
 
-	input.Brand = app.readString(qs, "brand", "")
-	input.DialColor = app.readString(qs, "dial_color", "")
-	input.StrapType = app.readString(qs, "strap_type", "")
-	input.Diameter = int8(app.readInt(qs, "diameter", 0, v))
-	input.Energy = app.readString(qs, "energy", "")
-	input.Gender = app.readString(qs, "gender", "")
-	stringSlice := app.readCSV(qs, "price_range", []string{})
-	intSlice := make([]int, len(stringSlice))
-	for i, str := range stringSlice {
-		num, err := strconv.Atoi(str)
-		if err != nil {
-			fmt.Printf("Error converting string to int: %v\n", err)
-			return
-		}
-		intSlice[i] = num
+	input.Filter = app.readWatchFilters(qs, v)
+	input.Filter.Deleted = deleted
+	input.Shape = app.readShape(qs, data.Watch{}, app.watchIncluders(), v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	defaultSort := "id"
+	if deleted {
+		defaultSort = "-deleted_at"
 	}
+	input.Filters.Sort, input.Filters.SortSafelist = app.readWatchSort(qs, input.Filter, defaultSort, v)
+	input.Filters.After = app.readString(qs, "after", "")
+	input.Filters.Before = app.readString(qs, "before", "")
 
-	if len(intSlice) == 2 {
-		input.PriceRange = intSlice
-	} else {
-		input.PriceRange = []int{0, math.MaxInt}
+	if input.Filters.After != "" || input.Filters.Before != "" {
+		v.Check(!qs.Has("page"), "page", "cannot be used together with a cursor")
 	}
 
-	input.Filters.Page = app.readInt(qs, "page", 1, v)
-	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
-	input.Filters.Sort = app.readString(qs, "sort", "id")
+	var err error
 
-	input.Filters.SortSafelist = []string{"id", "brand", "dial_color", "-id", "-brand", "-dial_color"}
+	input.Rate, err = app.readCurrencyRate(r.Context(), qs, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	watches, metadata, err := app.models.Watches.GetAll(
-		input.Brand,
-		input.DialColor,
-		input.StrapType,
-		input.Diameter,
-		input.Energy,
-		input.Gender,
-		input.PriceRange,
-		input.Filters)
+	watches, metadata, err := app.models.Watches.GetAll(r.Context(), input.Filter, input.Filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			v.AddError("cursor", "must be a cursor returned by a previous request")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.annotatePriceDrops(r.Context(), watches...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.convertPrices(input.Rate, watches...)
+
+	shaped, err := app.shapeWatches(r.Context(), input.Shape, watches)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
 	err = app.writeJSON(w, http.StatusOK,
-		envelope{"watches": watches, "metadata": metadata},
+		envelope{"watches": shaped, "metadata": metadata},
 		nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// readWatchSort reads the sort parameter of a watch listing, returning it
+// with the sort keys allowed for the watches selected by filter.
+func (app *application) readWatchSort(qs url.Values, filter data.WatchFilter, defaultSort string, v *validator.Validator) (string, []string) {
+	sort := app.readString(qs, "sort", defaultSort)
+
+	columns := []string{"id", "brand", "model", "dial_color", "energy", "diameter", "price", "created_at", "relevance", "average_rating", "review_count"}
+	if filter.Deleted {
+		columns = append(columns, "deleted_at")
+	}
+
+	var safelist []string
+	for _, column := range columns {
+		safelist = append(safelist, column, "-"+column)
+	}
+
+	for _, key := range strings.Split(sort, ",") {
+		if strings.TrimPrefix(key, "-") == "relevance" {
+			v.Check(filter.Search != "", "sort", "relevance requires a search query (q)")
+		}
+	}
+
+	return sort, safelist
+}
+
+// watchIncluders lists the relations that can be embedded in watch responses
+// with include=.
+func (app *application) watchIncluders() map[string]includer {
+	return map[string]includer{
+		"brand":  app.brandIncluder,
+		"images": app.imagesIncluder,
+	}
+}
+
+// shapeWatches applies the fields= and include= options of a request to
+// watches, returning one value to encode per watch.
+func (app *application) shapeWatches(ctx context.Context, s shape, watches []*data.Watch) ([]interface{}, error) {
+	items := make([]interface{}, len(watches))
+	ids := make([]int64, len(watches))
+	for i, watch := range watches {
+		items[i] = watch
+		ids[i] = watch.ID
+	}
+
+	if s.empty() {
+		return items, nil
+	}
+
+	objects, err := s.apply(ctx, items, ids, app.watchIncluders())
+	if err != nil {
+		return nil, err
+	}
+
+	for i, object := range objects {
+		items[i] = object
+	}
+	return items, nil
+}
+
+// readWatchFilters parses the attribute filters shared by the handlers that
+// list or aggregate watches. Attributes accept comma-separated values, any of
+// which may match.
+func (app *application) readWatchFilters(qs url.Values, v *validator.Validator) data.WatchFilter {
+	var f data.WatchFilter
+
+	f.Search = app.readString(qs, "q", "")
+	f.Brands = app.readCSV(qs, "brand", nil)
+	f.DialColors = app.readCSV(qs, "dial_color", nil)
+	f.StrapTypes = app.readCSV(qs, "strap_type", nil)
+	f.Energies = app.readCSV(qs, "energy", nil)
+	f.Genders = app.readCSV(qs, "gender", nil)
+	f.Diameters = app.readIntCSV(qs, "diameter", nil, v)
+	f.DiameterMin = app.readInt(qs, "diameter_min", 0, v)
+	f.DiameterMax = app.readInt(qs, "diameter_max", 0, v)
+	f.PriceMin = app.readMoney(qs, "price_min", data.CatalogCurrency, v).Amount
+	f.PriceMax = app.readMoney(qs, "price_max", data.CatalogCurrency, v).Amount
+	f.InStock = app.readBool(qs, "in_stock", nil, v)
+	f.PriceDroppedSince = app.readTime(qs, "price_dropped_since", time.Time{}, v)
+	f.RatingMin = app.readFloat(qs, "rating_min", 0, v)
+
+	// price_range=min,max predates price_min and price_max and is kept for
+	// the clients that still send it. Its bounds are whole units.
+	if priceRange := app.readIntCSV(qs, "price_range", nil, v); priceRange != nil {
+		if len(priceRange) != 2 {
+			v.AddError("price_range", "must contain a minimum and a maximum price")
+		} else if !qs.Has("price_min") && !qs.Has("price_max") {
+			min, minErr := data.ParseMoney(strconv.Itoa(priceRange[0]), data.CatalogCurrency)
+			max, maxErr := data.ParseMoney(strconv.Itoa(priceRange[1]), data.CatalogCurrency)
+			if minErr != nil || maxErr != nil {
+				v.AddError("price_range", "must contain amounts of "+data.CatalogCurrency)
+			}
+			f.PriceMin, f.PriceMax = min.Amount, max.Amount
+		}
+	}
+
+	data.ValidateWatchFilter(v, f)
+
+	return f
+}
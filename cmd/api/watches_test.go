@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTrashPreconditions(t *testing.T) {
+	ts := newTestServer(t)
+	ts.app.config.preconditions.required = true
+
+	token := ts.newUser("manager@example.com", "watches:write", "watches:purge", "brands:write")
+
+	ts.mustDo(http.StatusCreated, http.MethodPost, "/v1/watches", token, map[string]interface{}{
+		"brand":      "Omega",
+		"model":      "Seamaster",
+		"dial_color": "blue",
+		"strap_type": "steel",
+		"diameter":   42,
+		"energy":     "mechanical",
+		"gender":     "male",
+		"price":      "5200.00",
+		"image_url":  "https://example.com/seamaster.png",
+	})
+
+	// Each step runs on the watch as the steps before left it: moving it to
+	// the trash, restoring it and deleting it again take it to version 4.
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{"delete without a precondition", http.MethodDelete, "/v1/watches/1", "", "", http.StatusPreconditionRequired},
+		{"delete", http.MethodDelete, "/v1/watches/1", "If-Match", `"1"`, http.StatusOK},
+		{"restore without a precondition", http.MethodPost, "/v1/watches/1/restore", "", "", http.StatusPreconditionRequired},
+		{"restore with a stale tag", http.MethodPost, "/v1/watches/1/restore", "If-Match", `"1"`, http.StatusPreconditionFailed},
+		{"restore with a stale version", http.MethodPost, "/v1/watches/1/restore", "X-Expected-Version", "1", http.StatusConflict},
+		{"restore", http.MethodPost, "/v1/watches/1/restore", "If-Match", `"2"`, http.StatusOK},
+		{"restore outside the trash", http.MethodPost, "/v1/watches/1/restore", "If-Match", "*", http.StatusNotFound},
+		{"delete again", http.MethodDelete, "/v1/watches/1", "X-Expected-Version", "3", http.StatusOK},
+		{"purge without a precondition", http.MethodDelete, "/v1/watches/1/purge", "", "", http.StatusPreconditionRequired},
+		{"purge with a stale tag", http.MethodDelete, "/v1/watches/1/purge", "If-Match", `"3"`, http.StatusPreconditionFailed},
+		{"purge", http.MethodDelete, "/v1/watches/1/purge", "If-Match", `"4"`, http.StatusOK},
+		{"purge of a purged watch", http.MethodDelete, "/v1/watches/1/purge", "If-Match", "*", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ts.newRequest(tt.method, tt.path, token, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+
+			status, response := ts.send(req)
+			if status != tt.wantStatus {
+				t.Errorf("status %d; want %d: %v", status, tt.wantStatus, response)
+			}
+		})
+	}
+}
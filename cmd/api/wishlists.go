@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"jewelry.abgdrv.com/internal/data"
+	"jewelry.abgdrv.com/internal/validator"
+	"net/http"
+)
+
+// GET "/v1/users/me/wishlist"
+func (app *application) listWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	shared, err := app.models.Wishlists.IsShared(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.listWishlist(w, r, user.ID, envelope{"shared": shared})
+}
+
+// GET "/v1/wishlists/:token"
+//
+// Anyone with the share token of a wishlist can read it, without logging in.
+func (app *application) showSharedWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	// Share tokens are as long as authentication tokens.
+	if len(token) != 26 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	owner, err := app.models.Wishlists.GetOwnerForShareToken(r.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.listWishlist(w, r, owner.ID, envelope{"owner": owner.Name})
+}
+
+// listWishlist serves a page of the wishlist of a user, with the prices of
+// the watches shown the way watch listings show them, and the members of
+// extra added to the response.
+func (app *application) listWishlist(w http.ResponseWriter, r *http.Request, userID int64, extra envelope) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-added_at")
+	input.Filters.SortSafelist = []string{"added_at", "price", "-added_at", "-price"}
+
+	rate, err := app.readCurrencyRate(r.Context(), qs, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	items, metadata, err := app.models.Wishlists.GetAll(r.Context(), userID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	watches := make([]*data.Watch, len(items))
+	for i, item := range items {
+		watches[i] = item.Watch
+	}
+
+	err = app.annotatePriceDrops(r.Context(), watches...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.convertPrices(rate, watches...)
+
+	env := envelope{"items": items, "metadata": metadata}
+	for key, value := range extra {
+		env[key] = value
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// POST "/v1/users/me/wishlist"
+func (app *application) addWishlistItemHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		WatchID int64  `json:"watch_id"`
+		Note    string `json:"note"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.WatchID > 0, "watch_id", "must be provided")
+	if data.ValidateWishlistNote(v, input.Note); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Wishlists.Add(r.Context(), user.ID, input.WatchID, input.Note)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("watch_id", "must reference an existing watch")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateWishlistItem):
+			v.AddError("watch_id", "is already in the wishlist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeWishlistItem(w, r, user.ID, input.WatchID, http.StatusCreated)
+}
+
+// PATCH "/v1/users/me/wishlist/:id"
+//
+// The :id is that of the watch on the wishlist.
+func (app *application) updateWishlistItemHandler(w http.ResponseWriter, r *http.Request) {
+	watchID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Note *string `json:"note"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Note != nil, "note", "must be provided")
+	if input.Note != nil {
+		data.ValidateWishlistNote(v, *input.Note)
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Wishlists.UpdateNote(r.Context(), user.ID, watchID, *input.Note)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeWishlistItem(w, r, user.ID, watchID, http.StatusOK)
+}
+
+// writeWishlistItem responds with an item of the wishlist of a user.
+func (app *application) writeWishlistItem(w http.ResponseWriter, r *http.Request, userID, watchID int64, status int) {
+	item, err := app.models.Wishlists.Get(r.Context(), userID, watchID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.annotatePriceDrops(r.Context(), item.Watch)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, status, envelope{"item": item}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// DELETE "/v1/users/me/wishlist/:id"
+func (app *application) removeWishlistItemHandler(w http.ResponseWriter, r *http.Request) {
+	watchID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Wishlists.Remove(r.Context(), app.contextGetUser(r).ID, watchID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "watch removed from the wishlist"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// POST "/v1/users/me/wishlist/share"
+//
+// Shares the wishlist under a new token, which stops the one it was shared
+// with before from working. The token is only shown in this response.
+func (app *application) shareWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := app.models.Wishlists.Share(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"share_token": token, "path": "/v1/wishlists/" + token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// DELETE "/v1/users/me/wishlist/share"
+func (app *application) unshareWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Wishlists.Unshare(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "wishlist no longer shared"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
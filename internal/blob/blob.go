@@ -0,0 +1,30 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+var (
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Store keeps uploaded files under slash-separated keys such as
+// "watches/1/3f2a.jpg" and tells where clients can download them from.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Delete removes the file stored under key. Deleting a key that holds no
+	// file is not an error.
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// validKey rejects keys that are not clean relative paths, so no key can
+// reach outside of the store.
+func validKey(key string) bool {
+	return key != "" && path.Clean(key) == key && !path.IsAbs(key) &&
+		key != ".." && !strings.HasPrefix(key, "../")
+}
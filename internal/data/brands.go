@@ -0,0 +1,416 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"jewelry.abgdrv.com/internal/validator"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDuplicateBrand = errors.New("duplicate brand")
+	ErrBrandInUse     = errors.New("brand in use")
+)
+
+// SlugRX is the format of brand slugs: lowercase words of letters and digits
+// joined by single dashes.
+var SlugRX = regexp.MustCompile("^[a-z0-9]+(-[a-z0-9]+)*$")
+
+type Brand struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"-"`
+	Name        string    `json:"name"`
+	Slug        string    `json:"slug"`
+	Country     string    `json:"country,omitempty"`
+	Description string    `json:"description,omitempty"`
+	LogoURL     string    `json:"logo_url,omitempty"`
+	Version     int32     `json:"version"`
+}
+
+func ValidateBrand(v *validator.Validator, brand *Brand) {
+	v.Check(brand.Name != "", "name", "must be provided")
+	v.Check(len(brand.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(brand.Name == strings.TrimSpace(brand.Name), "name", "must not start or end with spaces")
+
+	v.Check(brand.Slug != "", "slug", "must be provided")
+	v.Check(len(brand.Slug) <= 100, "slug", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(brand.Slug, SlugRX), "slug", "must only contain lowercase letters, digits and single dashes")
+
+	v.Check(len(brand.Country) <= 100, "country", "must not be more than 100 bytes long")
+	v.Check(len(brand.Description) <= 5000, "description", "must not be more than 5000 bytes long")
+	v.Check(len(brand.LogoURL) <= 2000, "logo_url", "must not be more than 2000 bytes long")
+}
+
+// Slugify derives a slug from a brand name, the same way migration 000011
+// did for the brands it created: lowercase letters and digits, with every
+// other run of characters turned into a single dash.
+func Slugify(name string) string {
+	var b strings.Builder
+
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	if b.Len() == 0 {
+		return "brand"
+	}
+	return b.String()
+}
+
+type BrandModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+func (m BrandModel) Insert(ctx context.Context, brand *Brand) error {
+	query := `
+	INSERT INTO brands (name, slug, country, description, logo_url)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at, version`
+
+	args := []interface{}{brand.Name, brand.Slug, brand.Country, brand.Description, brand.LogoURL}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&brand.ID, &brand.CreatedAt, &brand.Version)
+	if err != nil {
+		return brandError(ctx, err)
+	}
+	return nil
+}
+
+func (m BrandModel) Get(ctx context.Context, id int64) (*Brand, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	return m.getWhere(ctx, "id = $1", id)
+}
+
+// GetByName finds a brand by name, ignoring case and surrounding spaces.
+func (m BrandModel) GetByName(ctx context.Context, name string) (*Brand, error) {
+	return m.getWhere(ctx, "lower(name) = lower(btrim($1))", name)
+}
+
+func (m BrandModel) getWhere(ctx context.Context, condition string, arg interface{}) (*Brand, error) {
+	query := `
+	SELECT id, created_at, name, slug, country, description, logo_url, version
+	FROM brands
+	WHERE ` + condition
+
+	var brand Brand
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, arg).Scan(
+		&brand.ID,
+		&brand.CreatedAt,
+		&brand.Name,
+		&brand.Slug,
+		&brand.Country,
+		&brand.Description,
+		&brand.LogoURL,
+		&brand.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return &brand, nil
+}
+
+// Update also renames the brand on its watches, whose brand column keeps a
+// copy of the name for searching and faceting, recording a revision of each.
+func (m BrandModel) Update(ctx context.Context, brand *Brand) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		query := `
+		UPDATE brands
+		SET name = $1, slug = $2, country = $3, description = $4, logo_url = $5, version = version + 1
+		WHERE id = $6 AND version = $7
+		RETURNING version`
+
+		args := []interface{}{
+			brand.Name,
+			brand.Slug,
+			brand.Country,
+			brand.Description,
+			brand.LogoURL,
+			brand.ID,
+			brand.Version,
+		}
+
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&brand.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return brandError(ctx, err)
+			}
+		}
+
+		query = `
+		UPDATE watches
+		SET brand = $1, version = version + 1
+		WHERE brand_id = $2 AND brand IS DISTINCT FROM $1
+		RETURNING id`
+
+		rows, err := tx.QueryContext(ctx, query, brand.Name, brand.ID)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+		defer rows.Close()
+
+		var watchIDs []int64
+
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return contextError(ctx, err)
+			}
+			watchIDs = append(watchIDs, id)
+		}
+
+		if err = rows.Err(); err != nil {
+			return contextError(ctx, err)
+		}
+
+		for _, id := range watchIDs {
+			err = recordWatchRevision(ctx, tx, id, RevisionUpdate)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (m BrandModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM brands WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return brandError(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll lists brands whose name contains the words of name, if given.
+func (m BrandModel) GetAll(ctx context.Context, name string, filters Filters) ([]*Brand, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, name, slug, country, description, logo_url, version
+	FROM brands
+	WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+	ORDER BY %s
+	LIMIT $2 OFFSET $3`, orderBy(filters.sortClauses(), false))
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	brands := []*Brand{}
+
+	for rows.Next() {
+		var brand Brand
+
+		err := rows.Scan(
+			&totalRecords,
+			&brand.ID,
+			&brand.CreatedAt,
+			&brand.Name,
+			&brand.Slug,
+			&brand.Country,
+			&brand.Description,
+			&brand.LogoURL,
+			&brand.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, contextError(ctx, err)
+		}
+
+		brands = append(brands, &brand)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return brands, metadata, nil
+}
+
+// GetForWatches returns the brand of each of the given watches, keyed by
+// watch id. Watches without a brand are left out.
+func (m BrandModel) GetForWatches(ctx context.Context, watchIDs []int64) (map[int64]*Brand, error) {
+	query := `
+	SELECT watches.id, brands.id, brands.created_at, brands.name, brands.slug, brands.country,
+	       brands.description, brands.logo_url, brands.version
+	FROM watches
+	INNER JOIN brands ON brands.id = watches.brand_id
+	WHERE watches.id = ANY($1)`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(watchIDs))
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	brands := make(map[int64]*Brand)
+
+	for rows.Next() {
+		var watchID int64
+		var brand Brand
+
+		err := rows.Scan(
+			&watchID,
+			&brand.ID,
+			&brand.CreatedAt,
+			&brand.Name,
+			&brand.Slug,
+			&brand.Country,
+			&brand.Description,
+			&brand.LogoURL,
+			&brand.Version,
+		)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		brands[watchID] = &brand
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return brands, nil
+}
+
+// linkBrand links watch to the brand named by its Brand when it has no
+// BrandID, inserting the brand in tx if there is none yet, so that a brand
+// named by a watch is only created along with the watch.
+func linkBrand(ctx context.Context, tx *sql.Tx, watch *Watch) error {
+	if watch.BrandID != 0 || watch.Brand == "" {
+		return nil
+	}
+
+	brand, err := upsertBrand(ctx, tx, watch.Brand)
+	if err != nil {
+		return err
+	}
+
+	watch.BrandID = brand.ID
+	watch.Brand = brand.Name
+	return nil
+}
+
+// upsertBrand returns the brand called name, ignoring case and surrounding
+// spaces, inserting it in tx if there is none. The insert does nothing on a
+// conflict with either unique index, which leaves the transaction usable: a
+// conflict on the name means the brand exists, possibly inserted by a
+// concurrent transaction, and one on the slug that the slug of another brand
+// needs a numeric suffix.
+func upsertBrand(ctx context.Context, tx *sql.Tx, name string) (*Brand, error) {
+	name = strings.TrimSpace(name)
+	slug := Slugify(name)
+
+	for n := 1; n <= 10; n++ {
+		brand := &Brand{Name: name, Slug: slug}
+		if n > 1 {
+			brand.Slug = fmt.Sprintf("%s-%d", slug, n)
+		}
+
+		query := `
+		INSERT INTO brands (name, slug)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+		RETURNING id, created_at, version`
+
+		err := tx.QueryRowContext(ctx, query, brand.Name, brand.Slug).Scan(&brand.ID, &brand.CreatedAt, &brand.Version)
+		if !errors.Is(err, sql.ErrNoRows) {
+			if err != nil {
+				return nil, contextError(ctx, err)
+			}
+			return brand, nil
+		}
+
+		query = `
+		SELECT id, created_at, name, slug, version
+		FROM brands
+		WHERE lower(name) = lower($1)`
+
+		err = tx.QueryRowContext(ctx, query, name).Scan(&brand.ID, &brand.CreatedAt, &brand.Name, &brand.Slug, &brand.Version)
+		if !errors.Is(err, sql.ErrNoRows) {
+			if err != nil {
+				return nil, contextError(ctx, err)
+			}
+			return brand, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no free slug for brand %q", name)
+}
+
+func brandError(ctx context.Context, err error) error {
+	switch err.Error() {
+	case `pq: duplicate key value violates unique constraint "brands_slug_key"`,
+		`pq: duplicate key value violates unique constraint "brands_name_idx"`:
+		return ErrDuplicateBrand
+	case `pq: update or delete on table "brands" violates foreign key constraint "watches_brand_id_fkey" on table "watches"`,
+		`pq: update or delete on table "brands" violates foreign key constraint "promotions_brand_id_fkey" on table "promotions"`:
+		return ErrBrandInUse
+	}
+	return contextError(ctx, err)
+}
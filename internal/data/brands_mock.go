@@ -0,0 +1,270 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type MockBrandModel struct {
+	db *mockDB
+}
+
+func (m MockBrandModel) Insert(ctx context.Context, brand *Brand) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if m.db.brandTaken(brand, 0) {
+		return ErrDuplicateBrand
+	}
+
+	m.db.lastBrandID++
+
+	brand.ID = m.db.lastBrandID
+	brand.CreatedAt = time.Now().Truncate(time.Second)
+	brand.Version = 1
+
+	stored := *brand
+	m.db.brands[brand.ID] = &stored
+
+	return nil
+}
+
+func (m MockBrandModel) Get(ctx context.Context, id int64) (*Brand, error) {
+	return m.getWhere(ctx, func(brand *Brand) bool {
+		return brand.ID == id
+	})
+}
+
+func (m MockBrandModel) GetByName(ctx context.Context, name string) (*Brand, error) {
+	return m.getWhere(ctx, func(brand *Brand) bool {
+		return strings.EqualFold(brand.Name, strings.TrimSpace(name))
+	})
+}
+
+func (m MockBrandModel) getWhere(ctx context.Context, match func(brand *Brand) bool) (*Brand, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for _, stored := range m.db.brands {
+		if match(stored) {
+			brand := *stored
+			return &brand, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m MockBrandModel) Update(ctx context.Context, brand *Brand) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if m.db.brandTaken(brand, brand.ID) {
+		return ErrDuplicateBrand
+	}
+
+	stored, ok := m.db.brands[brand.ID]
+	if !ok || stored.Version != brand.Version {
+		return ErrEditConflict
+	}
+
+	brand.Version++
+
+	updated := *brand
+	m.db.brands[brand.ID] = &updated
+
+	for _, watch := range m.db.watches {
+		if watch.BrandID == brand.ID && watch.Brand != brand.Name {
+			watch.Brand = brand.Name
+			watch.Version++
+
+			err := m.db.recordWatchRevision(ctx, watch.ID, RevisionUpdate)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m MockBrandModel) Delete(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.brands[id]; !ok {
+		return ErrRecordNotFound
+	}
+
+	for _, watch := range m.db.watches {
+		if watch.BrandID == id {
+			return ErrBrandInUse
+		}
+	}
+
+	if m.db.promoted(func(promotion *Promotion) bool { return promotion.BrandID == id }) {
+		return ErrBrandInUse
+	}
+
+	delete(m.db.brands, id)
+
+	return nil
+}
+
+func (m MockBrandModel) GetAll(ctx context.Context, name string, filters Filters) ([]*Brand, Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	matched := []*Brand{}
+
+	for _, stored := range m.db.brands {
+		if mockMatchText(stored.Name, name) {
+			brand := *stored
+			matched = append(matched, &brand)
+		}
+	}
+
+	clauses := filters.sortClauses()
+
+	sort.Slice(matched, func(i, j int) bool {
+		for _, clause := range clauses {
+			var cmp int
+			switch clause.column {
+			case "name":
+				cmp = strings.Compare(matched[i].Name, matched[j].Name)
+			case "slug":
+				cmp = strings.Compare(matched[i].Slug, matched[j].Slug)
+			default:
+				cmp = compareInt64(matched[i].ID, matched[j].ID)
+			}
+			if clause.descending {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+
+	totalRecords := len(matched)
+
+	start := filters.offset()
+	if start > totalRecords {
+		start = totalRecords
+	}
+	end := start + filters.limit()
+	if end > totalRecords {
+		end = totalRecords
+	}
+
+	if start == end {
+		totalRecords = 0
+	}
+
+	return matched[start:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m MockBrandModel) GetForWatches(ctx context.Context, watchIDs []int64) (map[int64]*Brand, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	brands := make(map[int64]*Brand)
+
+	for _, watchID := range watchIDs {
+		watch, ok := m.db.watches[watchID]
+		if !ok {
+			continue
+		}
+
+		if stored, ok := m.db.brands[watch.BrandID]; ok {
+			brand := *stored
+			brands[watchID] = &brand
+		}
+	}
+
+	return brands, nil
+}
+
+// brandTaken reports whether another brand already has the name, ignoring
+// case, or the slug, mirroring brands_name_idx and brands_slug_key.
+func (db *mockDB) brandTaken(brand *Brand, exceptID int64) bool {
+	for id, stored := range db.brands {
+		if id != exceptID && (strings.EqualFold(stored.Name, brand.Name) || stored.Slug == brand.Slug) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkBrand is the in-memory counterpart of linkBrand. The caller holds
+// db.mu.
+func (db *mockDB) linkBrand(watch *Watch) error {
+	if watch.BrandID != 0 || watch.Brand == "" {
+		return nil
+	}
+
+	name := strings.TrimSpace(watch.Brand)
+
+	for _, stored := range db.brands {
+		if strings.EqualFold(stored.Name, name) {
+			watch.BrandID = stored.ID
+			watch.Brand = stored.Name
+			return nil
+		}
+	}
+
+	slug := Slugify(name)
+
+	for n := 1; n <= 10; n++ {
+		brand := &Brand{Name: name, Slug: slug}
+		if n > 1 {
+			brand.Slug = fmt.Sprintf("%s-%d", slug, n)
+		}
+
+		if db.brandTaken(brand, 0) {
+			continue
+		}
+
+		db.lastBrandID++
+
+		brand.ID = db.lastBrandID
+		brand.CreatedAt = time.Now().Truncate(time.Second)
+		brand.Version = 1
+
+		db.brands[brand.ID] = brand
+
+		watch.BrandID = brand.ID
+		watch.Brand = brand.Name
+		return nil
+	}
+
+	return fmt.Errorf("no free slug for brand %q", name)
+}
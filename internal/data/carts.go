@@ -0,0 +1,292 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"jewelry.abgdrv.com/internal/validator"
+	"time"
+)
+
+// Cart is the shopping cart of a user or of a guest. Watches in the trash
+// stay in carts but are left out of them until they are restored.
+type Cart struct {
+	ID int64 `json:"-"`
+	// UserID is zero for the cart of a guest.
+	UserID int64       `json:"-"`
+	Items  []*CartItem `json:"items"`
+	// Discount is set once a promotion is applied to the cart, and is taken
+	// off Total.
+	Discount  *Discount `json:"discount,omitempty"`
+	Total     Money     `json:"total"`
+	ItemCount int32     `json:"item_count"`
+}
+
+// CartItem is a quantity of one watch in a cart. UnitPrice is a snapshot of
+// the price of the watch, which follows every change of that price.
+type CartItem struct {
+	WatchID int64 `json:"watch_id"`
+	// BrandID is that of the watch, for the promotions applied to the cart.
+	BrandID   int64     `json:"-"`
+	Quantity  int32     `json:"quantity"`
+	UnitPrice Money     `json:"unit_price"`
+	Subtotal  Money     `json:"subtotal"`
+	AddedAt   time.Time `json:"added_at"`
+}
+
+// MaxCartQuantity bounds the quantity of a watch in a cart.
+const MaxCartQuantity = 100
+
+func ValidateCartQuantity(v *validator.Validator, quantity int32) {
+	v.Check(quantity > 0, "quantity", "must be greater than zero")
+	v.Check(quantity <= MaxCartQuantity, "quantity", "must not be more than 100")
+}
+
+// Quantity returns the quantity of a watch in the cart.
+func (cart *Cart) Quantity(watchID int64) int32 {
+	for _, item := range cart.Items {
+		if item.WatchID == watchID {
+			return item.Quantity
+		}
+	}
+	return 0
+}
+
+// total fills in the subtotals of the items and the total of the cart.
+func (cart *Cart) total() {
+	cart.Total = Money{Currency: CatalogCurrency}
+	cart.ItemCount = 0
+
+	for _, item := range cart.Items {
+		item.Subtotal = Money{Amount: item.UnitPrice.Amount * int64(item.Quantity), Currency: item.UnitPrice.Currency}
+		cart.Total.Amount += item.Subtotal.Amount
+		cart.ItemCount += item.Quantity
+	}
+}
+
+// PricedLines returns the items of the cart as promotions see them.
+func (cart *Cart) PricedLines() []PricedLine {
+	lines := make([]PricedLine, len(cart.Items))
+	for i, item := range cart.Items {
+		lines[i] = PricedLine{WatchID: item.WatchID, BrandID: item.BrandID, Subtotal: item.Subtotal}
+	}
+	return lines
+}
+
+// ApplyDiscount takes the discount of a promotion off the total of the cart.
+func (cart *Cart) ApplyDiscount(discount *Discount) {
+	cart.Discount = discount
+	cart.Total.Amount -= discount.Amount.Amount
+}
+
+type CartModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// NewGuest creates an empty cart for a guest.
+func (m CartModel) NewGuest(ctx context.Context) (*Cart, error) {
+	query := `INSERT INTO carts DEFAULT VALUES RETURNING id`
+
+	cart := &Cart{Items: []*CartItem{}, Total: Money{Currency: CatalogCurrency}}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query).Scan(&cart.ID)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return cart, nil
+}
+
+// ForUser returns the id of the cart of a user, creating the cart if the
+// user has none yet.
+func (m CartModel) ForUser(ctx context.Context, userID int64) (int64, error) {
+	query := `
+	INSERT INTO carts (user_id)
+	VALUES ($1)
+	ON CONFLICT (user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+	RETURNING id`
+
+	var id int64
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&id)
+	return id, contextError(ctx, err)
+}
+
+// Get returns a cart with its items.
+func (m CartModel) Get(ctx context.Context, id int64) (*Cart, error) {
+	return m.get(ctx, `WHERE carts.id = $1`, id)
+}
+
+// GetForUser returns the cart of a user, or an empty one without an id if
+// the user has none yet.
+func (m CartModel) GetForUser(ctx context.Context, userID int64) (*Cart, error) {
+	cart, err := m.get(ctx, `WHERE carts.user_id = $1`, userID)
+	if errors.Is(err, ErrRecordNotFound) {
+		return &Cart{UserID: userID, Items: []*CartItem{}, Total: Money{Currency: CatalogCurrency}}, nil
+	}
+	return cart, err
+}
+
+func (m CartModel) get(ctx context.Context, where string, arg interface{}) (*Cart, error) {
+	query := `
+	SELECT carts.id, COALESCE(carts.user_id, 0), cart_items.watch_id, watches.brand_id, cart_items.quantity,
+	       cart_items.unit_price, cart_items.currency, cart_items.added_at
+	FROM carts
+	LEFT JOIN (
+		cart_items INNER JOIN watches ON watches.id = cart_items.watch_id AND watches.deleted_at IS NULL
+	) ON cart_items.cart_id = carts.id
+	` + where + `
+	ORDER BY cart_items.added_at, cart_items.watch_id`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	var cart *Cart
+
+	for rows.Next() {
+		var id, userID int64
+		var watchID, brandID, unitPrice sql.NullInt64
+		var quantity sql.NullInt32
+		var currency sql.NullString
+		var addedAt sql.NullTime
+
+		err := rows.Scan(&id, &userID, &watchID, &brandID, &quantity, &unitPrice, &currency, &addedAt)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		if cart == nil {
+			cart = &Cart{ID: id, UserID: userID, Items: []*CartItem{}}
+		}
+
+		// An empty cart comes back as one row without an item.
+		if watchID.Valid {
+			cart.Items = append(cart.Items, &CartItem{
+				WatchID:   watchID.Int64,
+				BrandID:   brandID.Int64,
+				Quantity:  quantity.Int32,
+				UnitPrice: Money{Amount: unitPrice.Int64, Currency: currency.String},
+				AddedAt:   addedAt.Time,
+			})
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	if cart == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	cart.total()
+
+	return cart, nil
+}
+
+// SetItem puts a quantity of a watch in a cart, taking a snapshot of its
+// price if it was not there yet. It returns ErrRecordNotFound if there is no
+// such watch outside the trash.
+func (m CartModel) SetItem(ctx context.Context, cartID, watchID int64, quantity int32) error {
+	query := `
+	INSERT INTO cart_items (cart_id, watch_id, quantity, unit_price, currency)
+	SELECT $1, id, $3, price, currency FROM watches WHERE id = $2 AND deleted_at IS NULL
+	ON CONFLICT (cart_id, watch_id) DO UPDATE SET quantity = EXCLUDED.quantity`
+
+	return m.execOne(ctx, query, cartID, watchID, quantity)
+}
+
+func (m CartModel) RemoveItem(ctx context.Context, cartID, watchID int64) error {
+	query := `DELETE FROM cart_items WHERE cart_id = $1 AND watch_id = $2`
+
+	return m.execOne(ctx, query, cartID, watchID)
+}
+
+// Clear empties a cart.
+func (m CartModel) Clear(ctx context.Context, cartID int64) error {
+	query := `DELETE FROM cart_items WHERE cart_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, cartID)
+	return contextError(ctx, err)
+}
+
+// Merge moves the items of the guest cart fromID into the cart toID, adding
+// up the quantities of watches in both, and deletes the guest cart.
+func (m CartModel) Merge(ctx context.Context, fromID, toID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		query := `
+		INSERT INTO cart_items (cart_id, watch_id, quantity, unit_price, currency, added_at)
+		SELECT $2, watch_id, quantity, unit_price, currency, added_at
+		FROM cart_items
+		WHERE cart_id = $1
+		ON CONFLICT (cart_id, watch_id) DO UPDATE
+		SET quantity = LEAST(cart_items.quantity + EXCLUDED.quantity, $3)`
+
+		_, err := tx.ExecContext(ctx, query, fromID, toID, MaxCartQuantity)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM carts WHERE id = $1 AND user_id IS NULL`, fromID)
+		return contextError(ctx, err)
+	})
+}
+
+// execOne runs a statement that changes the items of a cart, returning
+// ErrRecordNotFound if no row was affected.
+func (m CartModel) execOne(ctx context.Context, query string, cartID int64, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, append([]interface{}{cartID}, args...)...)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE carts SET updated_at = NOW() WHERE id = $1`, cartID)
+		return contextError(ctx, err)
+	})
+}
+
+// refreshCartPrices updates the price snapshots of the cart items of a watch
+// to the price written by tx.
+func refreshCartPrices(ctx context.Context, tx *sql.Tx, watchID int64) error {
+	query := `
+	UPDATE cart_items
+	SET unit_price = watches.price, currency = watches.currency
+	FROM watches
+	WHERE watches.id = $1 AND cart_items.watch_id = watches.id
+	AND (cart_items.unit_price, cart_items.currency) IS DISTINCT FROM (watches.price, watches.currency)`
+
+	_, err := tx.ExecContext(ctx, query, watchID)
+	return contextError(ctx, err)
+}
@@ -0,0 +1,251 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type MockCartModel struct {
+	db *mockDB
+}
+
+// mockCart is a row of carts together with its rows of cart_items.
+type mockCart struct {
+	ID     int64
+	UserID int64
+	Items  []*CartItem
+}
+
+func (m MockCartModel) NewGuest(ctx context.Context) (*Cart, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	m.db.lastCartID++
+	m.db.carts[m.db.lastCartID] = &mockCart{ID: m.db.lastCartID}
+
+	return &Cart{ID: m.db.lastCartID, Items: []*CartItem{}, Total: Money{Currency: CatalogCurrency}}, nil
+}
+
+func (m MockCartModel) ForUser(ctx context.Context, userID int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if cart := m.db.userCart(userID); cart != nil {
+		return cart.ID, nil
+	}
+
+	if _, ok := m.db.users[userID]; !ok {
+		return 0, errMockForeignKey
+	}
+
+	m.db.lastCartID++
+	m.db.carts[m.db.lastCartID] = &mockCart{ID: m.db.lastCartID, UserID: userID}
+
+	return m.db.lastCartID, nil
+}
+
+func (m MockCartModel) Get(ctx context.Context, id int64) (*Cart, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.carts[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	return m.db.copyCart(stored), nil
+}
+
+func (m MockCartModel) GetForUser(ctx context.Context, userID int64) (*Cart, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored := m.db.userCart(userID)
+	if stored == nil {
+		return &Cart{UserID: userID, Items: []*CartItem{}, Total: Money{Currency: CatalogCurrency}}, nil
+	}
+
+	return m.db.copyCart(stored), nil
+}
+
+func (m MockCartModel) SetItem(ctx context.Context, cartID, watchID int64, quantity int32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	watch, ok := m.db.watches[watchID]
+	if !ok || watch.DeletedAt != nil {
+		return ErrRecordNotFound
+	}
+
+	cart, ok := m.db.carts[cartID]
+	if !ok {
+		return errMockForeignKey
+	}
+
+	for _, item := range cart.Items {
+		if item.WatchID == watchID {
+			item.Quantity = quantity
+			return nil
+		}
+	}
+
+	cart.Items = append(cart.Items, &CartItem{
+		WatchID:   watchID,
+		Quantity:  quantity,
+		UnitPrice: watch.Price,
+		AddedAt:   time.Now().Truncate(time.Second),
+	})
+
+	return nil
+}
+
+func (m MockCartModel) RemoveItem(ctx context.Context, cartID, watchID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	cart, ok := m.db.carts[cartID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	for i, item := range cart.Items {
+		if item.WatchID == watchID {
+			cart.Items = append(cart.Items[:i], cart.Items[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrRecordNotFound
+}
+
+func (m MockCartModel) Clear(ctx context.Context, cartID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if cart, ok := m.db.carts[cartID]; ok {
+		cart.Items = nil
+	}
+
+	return nil
+}
+
+func (m MockCartModel) Merge(ctx context.Context, fromID, toID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	from, ok := m.db.carts[fromID]
+	if !ok {
+		return nil
+	}
+
+	to, ok := m.db.carts[toID]
+	if !ok {
+		return errMockForeignKey
+	}
+
+	for _, item := range from.Items {
+		merged := false
+		for _, existing := range to.Items {
+			if existing.WatchID == item.WatchID {
+				existing.Quantity += item.Quantity
+				if existing.Quantity > MaxCartQuantity {
+					existing.Quantity = MaxCartQuantity
+				}
+				merged = true
+			}
+		}
+		if !merged {
+			to.Items = append(to.Items, item)
+		}
+	}
+
+	if from.UserID == 0 {
+		delete(m.db.carts, fromID)
+	}
+
+	return nil
+}
+
+// userCart returns the cart of a user, or nil.
+func (db *mockDB) userCart(userID int64) *mockCart {
+	for _, cart := range db.carts {
+		if cart.UserID == userID {
+			return cart
+		}
+	}
+	return nil
+}
+
+// copyCart returns a copy of a stored cart, leaving out the watches in the
+// trash.
+func (db *mockDB) copyCart(stored *mockCart) *Cart {
+	cart := &Cart{ID: stored.ID, UserID: stored.UserID, Items: []*CartItem{}}
+
+	for _, item := range stored.Items {
+		watch, ok := db.watches[item.WatchID]
+		if !ok || watch.DeletedAt != nil {
+			continue
+		}
+		copied := *item
+		copied.BrandID = watch.BrandID
+		cart.Items = append(cart.Items, &copied)
+	}
+
+	sort.SliceStable(cart.Items, func(i, j int) bool {
+		if !cart.Items[i].AddedAt.Equal(cart.Items[j].AddedAt) {
+			return cart.Items[i].AddedAt.Before(cart.Items[j].AddedAt)
+		}
+		return cart.Items[i].WatchID < cart.Items[j].WatchID
+	})
+
+	cart.total()
+
+	return cart
+}
+
+// refreshCartPrices is the in-memory counterpart of refreshCartPrices. The
+// caller holds db.mu.
+func (db *mockDB) refreshCartPrices(watchID int64) {
+	watch := db.watches[watchID]
+
+	for _, cart := range db.carts {
+		for _, item := range cart.Items {
+			if item.WatchID == watchID {
+				item.UnitPrice = watch.Price
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"jewelry.abgdrv.com/internal/validator"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// RateRX is the format of exchange rates: a positive decimal with up to ten
+// digits on either side of the point, as the rate column stores them.
+var RateRX = regexp.MustCompile(`^[0-9]{1,10}(\.[0-9]{1,10})?$`)
+
+// CurrencyRate is the exchange rate prices are converted to a currency with.
+type CurrencyRate struct {
+	Currency string `json:"currency"`
+	// Rate is the number of units of Currency that one unit of the catalog
+	// currency is worth, as a decimal string.
+	Rate      string    `json:"rate"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Ratio returns the rate as an exact fraction.
+func (rate *CurrencyRate) Ratio() *big.Rat {
+	ratio, ok := new(big.Rat).SetString(rate.Rate)
+	if !ok {
+		panic("invalid currency rate: " + rate.Rate)
+	}
+	return ratio
+}
+
+func ValidateCurrencyRate(v *validator.Validator, rate *CurrencyRate) {
+	v.Check(ValidCurrency(rate.Currency), "currency", "must be a supported ISO 4217 currency code")
+	v.Check(rate.Currency != CatalogCurrency, "currency", "must not be the catalog currency")
+
+	v.Check(rate.Rate != "", "rate", "must be provided")
+	switch {
+	case rate.Rate == "":
+	case !validator.Matches(rate.Rate, RateRX):
+		v.AddError("rate", "must be a decimal with at most 10 digits before and after the point")
+	default:
+		v.Check(rate.Ratio().Sign() > 0, "rate", "must be greater than zero")
+	}
+}
+
+// trimDecimal drops the trailing zeros numeric columns pad decimals with.
+func trimDecimal(s string) string {
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+type CurrencyModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+func (m CurrencyModel) Get(ctx context.Context, currency string) (*CurrencyRate, error) {
+	query := `SELECT currency, rate::text, updated_at FROM currency_rates WHERE currency = $1`
+
+	var rate CurrencyRate
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, currency).Scan(&rate.Currency, &rate.Rate, &rate.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	rate.Rate = trimDecimal(rate.Rate)
+
+	return &rate, nil
+}
+
+func (m CurrencyModel) GetAll(ctx context.Context) ([]*CurrencyRate, error) {
+	query := `SELECT currency, rate::text, updated_at FROM currency_rates ORDER BY currency`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	rates := []*CurrencyRate{}
+
+	for rows.Next() {
+		var rate CurrencyRate
+
+		err := rows.Scan(&rate.Currency, &rate.Rate, &rate.UpdatedAt)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		rate.Rate = trimDecimal(rate.Rate)
+		rates = append(rates, &rate)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return rates, nil
+}
+
+// Set adds the rate of a currency or replaces the one it has. The rate is
+// read back as stored, along with UpdatedAt.
+func (m CurrencyModel) Set(ctx context.Context, rate *CurrencyRate) error {
+	query := `
+	INSERT INTO currency_rates (currency, rate)
+	VALUES ($1, $2)
+	ON CONFLICT (currency) DO UPDATE SET rate = EXCLUDED.rate, updated_at = NOW()
+	RETURNING rate::text, updated_at`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, rate.Currency, rate.Rate).Scan(&rate.Rate, &rate.UpdatedAt)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rate.Rate = trimDecimal(rate.Rate)
+
+	return nil
+}
+
+func (m CurrencyModel) Delete(ctx context.Context, currency string) error {
+	query := `DELETE FROM currency_rates WHERE currency = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, currency)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
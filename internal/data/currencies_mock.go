@@ -0,0 +1,89 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+type MockCurrencyModel struct {
+	db *mockDB
+}
+
+func (m MockCurrencyModel) Get(ctx context.Context, currency string) (*CurrencyRate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.currencyRates[currency]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	rate := *stored
+	return &rate, nil
+}
+
+func (m MockCurrencyModel) GetAll(ctx context.Context) ([]*CurrencyRate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	rates := []*CurrencyRate{}
+
+	for _, stored := range m.db.currencyRates {
+		rate := *stored
+		rates = append(rates, &rate)
+	}
+
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].Currency < rates[j].Currency
+	})
+
+	return rates, nil
+}
+
+func (m MockCurrencyModel) Set(ctx context.Context, rate *CurrencyRate) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	// The numeric column drops the insignificant zeros of the rate.
+	rate.Rate = trimDecimal(strings.TrimLeft(rate.Rate, "0"))
+	if strings.HasPrefix(rate.Rate, ".") || rate.Rate == "" {
+		rate.Rate = "0" + rate.Rate
+	}
+	rate.UpdatedAt = time.Now().Truncate(time.Second)
+
+	stored := *rate
+	m.db.currencyRates[rate.Currency] = &stored
+
+	return nil
+}
+
+func (m MockCurrencyModel) Delete(ctx context.Context, currency string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.currencyRates[currency]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.db.currencyRates, currency)
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// exportBatchSize is the number of rows fetched from the export cursor at a
+// time.
+const exportBatchSize = 500
+
+// Export calls fn with every watch matching filter, in the order given by
+// filters.Sort, and stops at the first error fn returns. The rows are read in
+// batches from a server-side cursor, so the result never has to fit in
+// memory. Paging in filters is ignored.
+func (w WatchModel) Export(ctx context.Context, filter WatchFilter, filters Filters, fn func(watch *Watch) error) error {
+	args := queryArgs{}
+
+	where := watchFilterCondition(filter, &args)
+
+	relevance, clauses := watchSort(filter, filters, &args)
+
+	query := fmt.Sprintf(`
+	DECLARE watch_export NO SCROLL CURSOR FOR
+	SELECT %s, %s
+	FROM watches
+	WHERE %s
+	ORDER BY %s`, watchListColumns, relevance, where, orderBy(clauses, false))
+
+	ctx, cancel := context.WithTimeout(ctx, w.Timeouts.Bulk)
+	defer cancel()
+
+	// A cursor only lives as long as the transaction it was declared in.
+	return withTx(ctx, w.DB, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		for {
+			n, err := fetchWatches(ctx, tx, fn)
+			if err != nil {
+				return err
+			}
+			if n < exportBatchSize {
+				return nil
+			}
+		}
+	})
+}
+
+// fetchWatches passes the next batch of rows of the export cursor to fn,
+// returning the number of rows read.
+func fetchWatches(ctx context.Context, tx *sql.Tx, fn func(watch *Watch) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("FETCH FORWARD %d FROM watch_export", exportBatchSize))
+	if err != nil {
+		return 0, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	n := 0
+
+	for rows.Next() {
+		var watch Watch
+
+		err := rows.Scan(watch.listScanDest()...)
+		if err != nil {
+			return n, contextError(ctx, err)
+		}
+		n++
+
+		err = fn(&watch)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return n, contextError(ctx, err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,48 @@
+package data
+
+import (
+	"context"
+	"sort"
+)
+
+func (m MockWatchModel) Export(ctx context.Context, filter WatchFilter, filters Filters, fn func(watch *Watch) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+
+	matched := []*Watch{}
+
+	for _, stored := range m.db.watches {
+		if !m.db.watchMatches(stored, filter) {
+			continue
+		}
+
+		watch := *stored
+		watch.Relevance = mockSearchRank(&watch, filter.Search)
+		matched = append(matched, &watch)
+	}
+
+	m.db.mu.Unlock()
+
+	clauses := filters.sortClauses()
+
+	sort.Slice(matched, func(i, j int) bool {
+		return compareWatches(matched[i], matched[j], clauses) < 0
+	})
+
+	// fn is called without holding the lock, as it may be slow to return.
+	for _, watch := range matched {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := fn(watch)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
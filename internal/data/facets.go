@@ -0,0 +1,182 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FacetNames lists the watch attributes that facet counts are reported for.
+var FacetNames = []string{"brand", "dial_color", "strap_type", "energy", "gender", "diameter", "price"}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets maps every facet name to the number of watches per value.
+type Facets map[string][]FacetCount
+
+// priceBucket bounds are in minor units of the catalog currency, while the
+// labels are in whole units.
+type priceBucket struct {
+	label string
+	min   int64
+	max   int64 // zero means no upper bound
+}
+
+// priceBuckets are the ranges counted for the price facet. The watch_facets
+// materialized view (migrations 000007, 000012 and 000015) uses the same
+// ranges, so keep both in sync.
+var priceBuckets = []priceBucket{
+	{label: "0-500", min: 0, max: 500_00},
+	{label: "500-1000", min: 500_00, max: 1000_00},
+	{label: "1000-5000", min: 1000_00, max: 5000_00},
+	{label: "5000-10000", min: 5000_00, max: 10000_00},
+	{label: "10000+", min: 10000_00},
+}
+
+func priceBucketLabel(price int64) string {
+	for _, bucket := range priceBuckets {
+		if price >= bucket.min && (bucket.max == 0 || price < bucket.max) {
+			return bucket.label
+		}
+	}
+	return priceBuckets[0].label
+}
+
+// priceBucketExpression renders priceBuckets as a CASE expression over the
+// price column.
+func priceBucketExpression() string {
+	var b strings.Builder
+
+	b.WriteString("CASE")
+	for _, bucket := range priceBuckets {
+		if bucket.max == 0 {
+			break
+		}
+		fmt.Fprintf(&b, " WHEN price < %d THEN '%s'", bucket.max, bucket.label)
+	}
+	fmt.Fprintf(&b, " ELSE '%s' END", priceBuckets[len(priceBuckets)-1].label)
+
+	return b.String()
+}
+
+// Facets counts the watches matching filter per value of every facet. Watches
+// without a brand, which only legacy rows lack, are left out of the brand
+// facet.
+func (w WatchModel) Facets(ctx context.Context, filter WatchFilter) (Facets, error) {
+	args := queryArgs{}
+
+	where := watchFilterCondition(filter, &args)
+
+	query := fmt.Sprintf(`
+		WITH filtered AS (
+			SELECT brand, dial_color, strap_type, energy, gender, diameter, price
+			FROM watches
+			WHERE %s
+		)
+		SELECT 'brand', brand, count(*) FROM filtered WHERE brand IS NOT NULL GROUP BY brand
+		UNION ALL
+		SELECT 'dial_color', dial_color, count(*) FROM filtered GROUP BY dial_color
+		UNION ALL
+		SELECT 'strap_type', strap_type, count(*) FROM filtered GROUP BY strap_type
+		UNION ALL
+		SELECT 'energy', energy, count(*) FROM filtered GROUP BY energy
+		UNION ALL
+		SELECT 'gender', gender, count(*) FROM filtered GROUP BY gender
+		UNION ALL
+		SELECT 'diameter', diameter::text, count(*) FROM filtered GROUP BY diameter
+		UNION ALL
+		SELECT 'price', %s, count(*) FROM filtered GROUP BY 2`, where, priceBucketExpression())
+
+	ctx, cancel := context.WithTimeout(ctx, w.Timeouts.Read)
+	defer cancel()
+
+	return w.queryFacets(ctx, query, args...)
+}
+
+// CachedFacets reads the facet counts of the whole catalog from the
+// watch_facets materialized view, which is only as fresh as its last refresh.
+func (w WatchModel) CachedFacets(ctx context.Context) (Facets, error) {
+	query := `SELECT facet, value, count FROM watch_facets`
+
+	ctx, cancel := context.WithTimeout(ctx, w.Timeouts.Read)
+	defer cancel()
+
+	return w.queryFacets(ctx, query)
+}
+
+// RefreshFacets recomputes the watch_facets materialized view without
+// blocking the reads of CachedFacets.
+func (w WatchModel) RefreshFacets(ctx context.Context) error {
+	query := `REFRESH MATERIALIZED VIEW CONCURRENTLY watch_facets`
+
+	ctx, cancel := context.WithTimeout(ctx, w.Timeouts.Write)
+	defer cancel()
+
+	_, err := w.DB.ExecContext(ctx, query)
+	return contextError(ctx, err)
+}
+
+// queryFacets runs a query returning facet name, value and count rows and
+// collects them into sorted Facets, with every facet present.
+func (w WatchModel) queryFacets(ctx context.Context, query string, args ...interface{}) (Facets, error) {
+	rows, err := w.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	facets := newFacets()
+
+	for rows.Next() {
+		var name string
+		var count FacetCount
+
+		err := rows.Scan(&name, &count.Value, &count.Count)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		facets[name] = append(facets[name], count)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	facets.sort()
+
+	return facets, nil
+}
+
+func newFacets() Facets {
+	facets := make(Facets, len(FacetNames))
+	for _, name := range FacetNames {
+		facets[name] = []FacetCount{}
+	}
+	return facets
+}
+
+// sort orders price buckets from cheapest to most expensive and every other
+// facet by descending count.
+func (f Facets) sort() {
+	bucketIndex := make(map[string]int, len(priceBuckets))
+	for i, bucket := range priceBuckets {
+		bucketIndex[bucket.label] = i
+	}
+
+	for name, counts := range f {
+		sort.Slice(counts, func(i, j int) bool {
+			if name == "price" {
+				return bucketIndex[counts[i].Value] < bucketIndex[counts[j].Value]
+			}
+			if counts[i].Count != counts[j].Count {
+				return counts[i].Count > counts[j].Count
+			}
+			return counts[i].Value < counts[j].Value
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package data
+
+import (
+	"context"
+	"strconv"
+)
+
+func (m MockWatchModel) Facets(ctx context.Context, filter WatchFilter) (Facets, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	counts := make(map[string]map[string]int, len(FacetNames))
+	for _, name := range FacetNames {
+		counts[name] = make(map[string]int)
+	}
+
+	for _, watch := range m.db.watches {
+		if !m.db.watchMatches(watch, filter) {
+			continue
+		}
+
+		counts["brand"][watch.Brand]++
+		counts["dial_color"][watch.DialColor]++
+		counts["strap_type"][watch.StrapType]++
+		counts["energy"][watch.Energy]++
+		counts["gender"][watch.Gender]++
+		counts["diameter"][strconv.Itoa(int(watch.Diameter))]++
+		counts["price"][priceBucketLabel(watch.Price.Amount)]++
+	}
+
+	facets := newFacets()
+	for name, values := range counts {
+		for value, count := range values {
+			facets[name] = append(facets[name], FacetCount{Value: value, Count: count})
+		}
+	}
+
+	facets.sort()
+
+	return facets, nil
+}
+
+// CachedFacets has no view to read from, so it counts the whole catalog on
+// every call.
+func (m MockWatchModel) CachedFacets(ctx context.Context) (Facets, error) {
+	return m.Facets(ctx, WatchFilter{})
+}
+
+func (m MockWatchModel) RefreshFacets(ctx context.Context) error {
+	return ctx.Err()
+}
@@ -1,24 +1,38 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"jewelry.abgdrv.com/internal/validator"
 	"math"
 	"strings"
 )
 
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
 type Filters struct {
 	Page         int
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	// After and Before hold opaque cursors taken from the metadata of a
+	// previous response. Setting either one switches to keyset pagination.
+	After  string
+	Before string
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -26,23 +40,29 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
-	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
-}
 
-func (f Filters) sortColumn() string {
-	for _, safeValue := range f.SortSafelist {
-		if f.Sort == safeValue {
-			return strings.TrimPrefix(f.Sort, "-")
-		}
+	keys := strings.Split(f.Sort, ",")
+	columns := make([]string, len(keys))
+	for i, key := range keys {
+		v.Check(validator.In(key, f.SortSafelist...), "sort", "invalid sort value")
+		columns[i] = strings.TrimPrefix(key, "-")
 	}
-	panic("unsafe sort parameter: " + f.Sort)
-}
+	v.Check(validator.Unique(columns), "sort", "must not contain the same sort key twice")
+
+	v.Check(f.After == "" || f.Before == "", "before", "cannot be used together with after")
 
-func (f Filters) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
-		return "DESC"
+	for key, value := range map[string]string{"after": f.After, "before": f.Before} {
+		if value == "" {
+			continue
+		}
+
+		c, err := decodeCursor(value)
+		if err != nil {
+			v.AddError(key, "must be a cursor returned by a previous request")
+			continue
+		}
+		v.Check(c.Sort == f.Sort, key, "was issued for a different sort value")
 	}
-	return "ASC"
 }
 
 func (f Filters) limit() int {
@@ -53,6 +73,137 @@ func (f Filters) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
+// keyset reports whether the filters ask for cursor pagination rather than
+// page numbers.
+func (f Filters) keyset() bool {
+	return f.After != "" || f.Before != ""
+}
+
+// backward reports whether a keyset page is read towards the start of the
+// result set.
+func (f Filters) backward() bool {
+	return f.Before != ""
+}
+
+// sortClause is one key of the sort parameter. column names the sort value
+// and expr is the SQL it is computed with, which is the column itself unless
+// a model replaces it with an expression.
+type sortClause struct {
+	column     string
+	expr       string
+	descending bool
+}
+
+// sortClauses parses the comma-separated sort parameter. Every key has to be
+// in the safelist, so no raw input ever reaches the SQL. The list always ends
+// with id, which gives every row a unique position to resume from.
+func (f Filters) sortClauses() []sortClause {
+	var clauses []sortClause
+	hasID := false
+
+	for _, key := range strings.Split(f.Sort, ",") {
+		if !validator.In(key, f.SortSafelist...) {
+			panic("unsafe sort parameter: " + key)
+		}
+
+		column := strings.TrimPrefix(key, "-")
+		clauses = append(clauses, sortClause{
+			column:     column,
+			expr:       column,
+			descending: strings.HasPrefix(key, "-"),
+		})
+		hasID = hasID || column == "id"
+	}
+
+	if !hasID {
+		clauses = append(clauses, sortClause{column: "id", expr: "id"})
+	}
+	return clauses
+}
+
+// orderBy renders clauses as an ORDER BY list, flipping every direction when
+// reverse is set so a backward keyset page can be read with LIMIT.
+func orderBy(clauses []sortClause, reverse bool) string {
+	list := make([]string, len(clauses))
+	for i, clause := range clauses {
+		direction := "ASC"
+		if clause.descending != reverse {
+			direction = "DESC"
+		}
+		list[i] = clause.expr + " " + direction
+	}
+	return strings.Join(list, ", ")
+}
+
+// keysetCondition matches the rows positioned after values in the order given
+// by clauses, or before them when backward is set:
+// (a > $1) OR (a = $1 AND b > $2) OR ...
+func keysetCondition(clauses []sortClause, values []interface{}, backward bool, args *queryArgs) string {
+	disjuncts := make([]string, len(clauses))
+
+	for i, clause := range clauses {
+		conjuncts := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			conjuncts = append(conjuncts, fmt.Sprintf("%s = %s", clauses[j].expr, args.add(values[j])))
+		}
+
+		operator := ">"
+		if clause.descending != backward {
+			operator = "<"
+		}
+		conjuncts = append(conjuncts, fmt.Sprintf("%s %s %s", clause.expr, operator, args.add(values[i])))
+
+		disjuncts[i] = "(" + strings.Join(conjuncts, " AND ") + ")"
+	}
+
+	return "(" + strings.Join(disjuncts, " OR ") + ")"
+}
+
+// queryArgs collects the positional arguments of a query that is assembled at
+// runtime and hands out their $n placeholders.
+type queryArgs []interface{}
+
+func (a *queryArgs) add(value interface{}) string {
+	*a = append(*a, value)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// cursor is the decoded form of the after/before tokens: the sort it was
+// issued for and the sort key values of the row it points at.
+type cursor struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+}
+
+func encodeCursor(sort string, values []interface{}) string {
+	c := struct {
+		Sort   string        `json:"s"`
+		Values []interface{} `json:"v"`
+	}{sort, values}
+
+	js, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	err = json.Unmarshal(js, &c)
+	if err != nil || len(c.Values) == 0 {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 	if totalRecords == 0 {
 		return Metadata{}
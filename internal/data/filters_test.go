@@ -0,0 +1,134 @@
+package data
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		sort   string
+		values []interface{}
+		want   []string
+	}{
+		{"id", "id", []interface{}{int64(42)}, []string{"42"}},
+		{"text and id", "-brand,id", []interface{}{"Omega", int64(7)}, []string{`"Omega"`, "7"}},
+		{"float", "price", []interface{}{199.99, int64(3)}, []string{"199.99", "3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := decodeCursor(encodeCursor(tt.sort, tt.values))
+			if err != nil {
+				t.Fatalf("decodeCursor: %v", err)
+			}
+
+			if c.Sort != tt.sort {
+				t.Errorf("sort = %q; want %q", c.Sort, tt.sort)
+			}
+
+			got := make([]string, len(c.Values))
+			for i, value := range c.Values {
+				got[i] = string(value)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("values = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"not base64", "!!!"},
+		{"truncated", encodeCursor("id", []interface{}{1})[:8]},
+		{"not JSON", base64.RawURLEncoding.EncodeToString([]byte("id:1"))},
+		{"no values", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"id","v":[]}`))},
+		{"values not an array", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"id","v":1}`))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCursor(tt.cursor)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("err = %v; want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	tests := []struct {
+		name     string
+		sort     string
+		backward bool
+		values   []interface{}
+		want     string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "ascending",
+			sort:     "id",
+			values:   []interface{}{int64(5)},
+			want:     "((id > $1))",
+			wantArgs: []interface{}{int64(5)},
+		},
+		{
+			name:     "ascending backward",
+			sort:     "id",
+			backward: true,
+			values:   []interface{}{int64(5)},
+			want:     "((id < $1))",
+			wantArgs: []interface{}{int64(5)},
+		},
+		{
+			name:     "descending with id appended",
+			sort:     "-price",
+			values:   []interface{}{int64(100), int64(5)},
+			want:     "((price < $1) OR (price = $2 AND id > $3))",
+			wantArgs: []interface{}{int64(100), int64(100), int64(5)},
+		},
+		{
+			name:     "descending backward",
+			sort:     "-price",
+			backward: true,
+			values:   []interface{}{int64(100), int64(5)},
+			want:     "((price > $1) OR (price = $2 AND id < $3))",
+			wantArgs: []interface{}{int64(100), int64(100), int64(5)},
+		},
+		{
+			name:     "three keys",
+			sort:     "brand,-diameter",
+			values:   []interface{}{"Omega", 40, int64(9)},
+			want:     "((brand > $1) OR (brand = $2 AND diameter < $3) OR (brand = $4 AND diameter = $5 AND id > $6))",
+			wantArgs: []interface{}{"Omega", "Omega", 40, "Omega", 40, int64(9)},
+		},
+	}
+
+	safelist := []string{"id", "brand", "price", "diameter", "-id", "-brand", "-price", "-diameter"}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clauses := Filters{Sort: tt.sort, SortSafelist: safelist}.sortClauses()
+
+			var args queryArgs
+
+			got := keysetCondition(clauses, tt.values, tt.backward, &args)
+			if got != tt.want {
+				t.Errorf("condition = %s; want %s", got, tt.want)
+			}
+
+			if !reflect.DeepEqual([]interface{}(args), tt.wantArgs) {
+				t.Errorf("args = %v; want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// WatchImage is one uploaded image in the gallery of a watch. Images are
+// ordered by Position, starting at 1, and a watch with images always has
+// exactly one primary image, whose URL is mirrored in Watch.ImageURL.
+type WatchImage struct {
+	ID           int64     `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	WatchID      int64     `json:"watch_id"`
+	Position     int32     `json:"position"`
+	Primary      bool      `json:"primary"`
+	ContentType  string    `json:"content_type"`
+	Width        int32     `json:"width"`
+	Height       int32     `json:"height"`
+	Size         int64     `json:"size"`
+	Key          string    `json:"-"`
+	URL          string    `json:"url"`
+	ThumbnailKey string    `json:"-"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+}
+
+const watchImageColumns = `id, created_at, watch_id, position, is_primary, content_type,
+	width, height, size, image_key, url, thumbnail_key, thumbnail_url`
+
+func (image *WatchImage) scanDest() []interface{} {
+	return []interface{}{
+		&image.ID,
+		&image.CreatedAt,
+		&image.WatchID,
+		&image.Position,
+		&image.Primary,
+		&image.ContentType,
+		&image.Width,
+		&image.Height,
+		&image.Size,
+		&image.Key,
+		&image.URL,
+		&image.ThumbnailKey,
+		&image.ThumbnailURL,
+	}
+}
+
+type ImageModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// Insert appends the image to the gallery of its watch. It becomes the
+// primary image if Primary is set or if it is the watch's first image.
+func (m ImageModel) Insert(ctx context.Context, image *WatchImage) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		err := lockWatch(ctx, tx, image.WatchID)
+		if err != nil {
+			return err
+		}
+
+		if image.Primary {
+			_, err = tx.ExecContext(ctx, `UPDATE watch_images SET is_primary = false WHERE watch_id = $1 AND is_primary`, image.WatchID)
+			if err != nil {
+				return contextError(ctx, err)
+			}
+		}
+
+		query := `
+		INSERT INTO watch_images (watch_id, position, is_primary, content_type, width, height, size,
+		                          image_key, url, thumbnail_key, thumbnail_url)
+		VALUES ($1,
+		        (SELECT COALESCE(max(position), 0) + 1 FROM watch_images WHERE watch_id = $1),
+		        $2 OR NOT EXISTS (SELECT 1 FROM watch_images WHERE watch_id = $1),
+		        $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at, position, is_primary`
+
+		args := []interface{}{
+			image.WatchID,
+			image.Primary,
+			image.ContentType,
+			image.Width,
+			image.Height,
+			image.Size,
+			image.Key,
+			image.URL,
+			image.ThumbnailKey,
+			image.ThumbnailURL,
+		}
+
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&image.ID, &image.CreatedAt, &image.Position, &image.Primary)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		return syncWatchImageURL(ctx, tx, image.WatchID)
+	})
+}
+
+func (m ImageModel) Get(ctx context.Context, watchID, id int64) (*WatchImage, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `SELECT ` + watchImageColumns + ` FROM watch_images WHERE id = $1 AND watch_id = $2`
+
+	var image WatchImage
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, watchID).Scan(image.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return &image, nil
+}
+
+// GetAllForWatches returns the galleries of the given watches in order,
+// keyed by watch id. Watches without images are left out.
+func (m ImageModel) GetAllForWatches(ctx context.Context, watchIDs []int64) (map[int64][]*WatchImage, error) {
+	query := `SELECT ` + watchImageColumns + `
+	FROM watch_images
+	WHERE watch_id = ANY($1)
+	ORDER BY watch_id, position`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(watchIDs))
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	images := make(map[int64][]*WatchImage)
+
+	for rows.Next() {
+		var image WatchImage
+
+		err := rows.Scan(image.scanDest()...)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		images[image.WatchID] = append(images[image.WatchID], &image)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return images, nil
+}
+
+// Update moves the image to its Position, shifting the images in between,
+// and makes it the primary image if Primary is set. Positions past the end
+// of the gallery move the image to the end. The image is reloaded afterwards.
+func (m ImageModel) Update(ctx context.Context, image *WatchImage) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		err := lockWatch(ctx, tx, image.WatchID)
+		if err != nil {
+			return err
+		}
+
+		var current, count int32
+
+		query := `
+		SELECT position, (SELECT count(*) FROM watch_images WHERE watch_id = $2)
+		FROM watch_images
+		WHERE id = $1 AND watch_id = $2`
+
+		err = tx.QueryRowContext(ctx, query, image.ID, image.WatchID).Scan(&current, &count)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return contextError(ctx, err)
+			}
+		}
+
+		position := min(max(image.Position, 1), count)
+
+		switch {
+		case position < current:
+			query = `UPDATE watch_images SET position = position + 1
+			WHERE watch_id = $1 AND position >= $2 AND position < $3`
+		case position > current:
+			query = `UPDATE watch_images SET position = position - 1
+			WHERE watch_id = $1 AND position <= $2 AND position > $3`
+		default:
+			query = ""
+		}
+		if query != "" {
+			_, err = tx.ExecContext(ctx, query, image.WatchID, position, current)
+			if err != nil {
+				return contextError(ctx, err)
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE watch_images SET position = $1 WHERE id = $2`, position, image.ID)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		if image.Primary {
+			query = `UPDATE watch_images SET is_primary = (id = $2) WHERE watch_id = $1`
+
+			_, err = tx.ExecContext(ctx, query, image.WatchID, image.ID)
+			if err != nil {
+				return contextError(ctx, err)
+			}
+		}
+
+		err = syncWatchImageURL(ctx, tx, image.WatchID)
+		if err != nil {
+			return err
+		}
+
+		query = `SELECT ` + watchImageColumns + ` FROM watch_images WHERE id = $1`
+
+		err = tx.QueryRowContext(ctx, query, image.ID).Scan(image.scanDest()...)
+		return contextError(ctx, err)
+	})
+}
+
+// Delete removes the image and closes the gap it leaves in the gallery. If it
+// was the primary image, the first remaining image takes its place.
+func (m ImageModel) Delete(ctx context.Context, watchID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		err := lockWatch(ctx, tx, watchID)
+		if err != nil {
+			return err
+		}
+
+		var position int32
+		var primary bool
+
+		query := `DELETE FROM watch_images WHERE id = $1 AND watch_id = $2 RETURNING position, is_primary`
+
+		err = tx.QueryRowContext(ctx, query, id, watchID).Scan(&position, &primary)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return contextError(ctx, err)
+			}
+		}
+
+		query = `UPDATE watch_images SET position = position - 1 WHERE watch_id = $1 AND position > $2`
+
+		_, err = tx.ExecContext(ctx, query, watchID, position)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		if primary {
+			query = `
+			UPDATE watch_images SET is_primary = true
+			WHERE id = (SELECT id FROM watch_images WHERE watch_id = $1 ORDER BY position LIMIT 1)`
+
+			_, err = tx.ExecContext(ctx, query, watchID)
+			if err != nil {
+				return contextError(ctx, err)
+			}
+		}
+
+		return syncWatchImageURL(ctx, tx, watchID)
+	})
+}
+
+// lockWatch takes the row lock of a watch for the rest of tx, which
+// serializes changes to the watch's gallery. Watches in the trash are
+// reported as not found.
+func lockWatch(ctx context.Context, tx *sql.Tx, watchID int64) error {
+	var id int64
+
+	err := tx.QueryRowContext(ctx, `SELECT id FROM watches WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, watchID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return contextError(ctx, err)
+		}
+	}
+	return nil
+}
+
+// syncWatchImageURL copies the URL of the watch's primary image, or an empty
+// string once the gallery is empty, to watches.image_url. The version is
+// bumped and a revision recorded when the URL changes, so that an update
+// based on an earlier read cannot write the old URL back.
+func syncWatchImageURL(ctx context.Context, tx *sql.Tx, watchID int64) error {
+	query := `
+	UPDATE watches
+	SET image_url = primary_image.url, version = version + 1
+	FROM (SELECT COALESCE((SELECT url FROM watch_images WHERE watch_id = $1 AND is_primary), '') AS url) AS primary_image
+	WHERE watches.id = $1 AND watches.image_url <> primary_image.url`
+
+	result, err := tx.ExecContext(ctx, query, watchID)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return nil
+	}
+	return recordWatchRevision(ctx, tx, watchID, RevisionUpdate)
+}
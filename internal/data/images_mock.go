@@ -0,0 +1,203 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type MockImageModel struct {
+	db *mockDB
+}
+
+func (m MockImageModel) Insert(ctx context.Context, image *WatchImage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if !m.db.liveWatch(image.WatchID) {
+		return ErrRecordNotFound
+	}
+
+	gallery := m.db.gallery(image.WatchID)
+
+	if image.Primary {
+		for _, stored := range gallery {
+			stored.Primary = false
+		}
+	}
+
+	m.db.lastWatchImageID++
+
+	image.ID = m.db.lastWatchImageID
+	image.CreatedAt = time.Now().Truncate(time.Second)
+	image.Position = int32(len(gallery) + 1)
+	image.Primary = image.Primary || len(gallery) == 0
+
+	stored := *image
+	m.db.watchImages[image.ID] = &stored
+
+	return m.db.syncWatchImageURL(ctx, image.WatchID)
+}
+
+func (m MockImageModel) Get(ctx context.Context, watchID, id int64) (*WatchImage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.watchImages[id]
+	if !ok || stored.WatchID != watchID {
+		return nil, ErrRecordNotFound
+	}
+
+	image := *stored
+	return &image, nil
+}
+
+func (m MockImageModel) GetAllForWatches(ctx context.Context, watchIDs []int64) (map[int64][]*WatchImage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	images := make(map[int64][]*WatchImage)
+
+	for _, watchID := range watchIDs {
+		for _, stored := range m.db.gallery(watchID) {
+			image := *stored
+			images[watchID] = append(images[watchID], &image)
+		}
+	}
+
+	return images, nil
+}
+
+func (m MockImageModel) Update(ctx context.Context, image *WatchImage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if !m.db.liveWatch(image.WatchID) {
+		return ErrRecordNotFound
+	}
+
+	stored, ok := m.db.watchImages[image.ID]
+	if !ok || stored.WatchID != image.WatchID {
+		return ErrRecordNotFound
+	}
+
+	gallery := m.db.gallery(image.WatchID)
+	current := stored.Position
+	position := min(max(image.Position, 1), int32(len(gallery)))
+
+	for _, other := range gallery {
+		switch {
+		case position < current && other.Position >= position && other.Position < current:
+			other.Position++
+		case position > current && other.Position <= position && other.Position > current:
+			other.Position--
+		}
+	}
+	stored.Position = position
+
+	if image.Primary {
+		for _, other := range gallery {
+			other.Primary = other.ID == image.ID
+		}
+	}
+
+	err := m.db.syncWatchImageURL(ctx, image.WatchID)
+	if err != nil {
+		return err
+	}
+
+	*image = *stored
+
+	return nil
+}
+
+func (m MockImageModel) Delete(ctx context.Context, watchID, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if !m.db.liveWatch(watchID) {
+		return ErrRecordNotFound
+	}
+
+	stored, ok := m.db.watchImages[id]
+	if !ok || stored.WatchID != watchID {
+		return ErrRecordNotFound
+	}
+
+	delete(m.db.watchImages, id)
+
+	gallery := m.db.gallery(watchID)
+	for _, other := range gallery {
+		if other.Position > stored.Position {
+			other.Position--
+		}
+	}
+	if stored.Primary && len(gallery) > 0 {
+		gallery[0].Primary = true
+	}
+
+	return m.db.syncWatchImageURL(ctx, watchID)
+}
+
+// liveWatch is the in-memory counterpart of lockWatch: it reports whether
+// the watch exists and is not in the trash.
+func (db *mockDB) liveWatch(watchID int64) bool {
+	watch, ok := db.watches[watchID]
+	return ok && watch.DeletedAt == nil
+}
+
+// gallery returns the stored images of a watch ordered by position.
+func (db *mockDB) gallery(watchID int64) []*WatchImage {
+	var images []*WatchImage
+	for _, image := range db.watchImages {
+		if image.WatchID == watchID {
+			images = append(images, image)
+		}
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Position < images[j].Position
+	})
+
+	return images
+}
+
+// syncWatchImageURL is the in-memory counterpart of syncWatchImageURL.
+func (db *mockDB) syncWatchImageURL(ctx context.Context, watchID int64) error {
+	url := ""
+	for _, image := range db.gallery(watchID) {
+		if image.Primary {
+			url = image.URL
+		}
+	}
+
+	watch, ok := db.watches[watchID]
+	if !ok || watch.ImageURL == url {
+		return nil
+	}
+
+	watch.ImageURL = url
+	watch.Version++
+
+	return db.recordWatchRevision(ctx, watchID, RevisionUpdate)
+}
@@ -0,0 +1,229 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+// Import inserts the watches in a single transaction, so either all of them
+// are added or none is. The rows are streamed to the server with COPY, with
+// ids taken from the sequence beforehand since COPY cannot return them. The
+// ids, creation times and versions of the watches are filled in, and a
+// revision and the first price history entry are recorded for each. Brands
+// named by watches without a BrandID are created in the same transaction, as
+// Insert does.
+func (w WatchModel) Import(ctx context.Context, watches []*Watch) error {
+	if len(watches) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.Timeouts.Bulk)
+	defer cancel()
+
+	return withTx(ctx, w.DB, func(tx *sql.Tx) error {
+		err := linkBrands(ctx, tx, watches)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, `SELECT nextval('watches_id_seq') FROM generate_series(1, $1)`, len(watches))
+		if err != nil {
+			return contextError(ctx, err)
+		}
+		defer rows.Close()
+
+		for i := 0; rows.Next(); i++ {
+			if err := rows.Scan(&watches[i].ID); err != nil {
+				return contextError(ctx, err)
+			}
+		}
+
+		if err = rows.Err(); err != nil {
+			return contextError(ctx, err)
+		}
+
+		stmt, err := tx.PrepareContext(ctx, pq.CopyIn("watches",
+			"id", "brand", "brand_id", "model", "dial_color", "strap_type", "diameter",
+			"energy", "gender", "price", "currency", "image_url", "sku"))
+		if err != nil {
+			return contextError(ctx, err)
+		}
+		defer stmt.Close()
+
+		for _, watch := range watches {
+			_, err = stmt.ExecContext(ctx,
+				watch.ID,
+				watch.Brand,
+				nullInt64(watch.BrandID),
+				watch.Model,
+				watch.DialColor,
+				watch.StrapType,
+				watch.Diameter,
+				watch.Energy,
+				watch.Gender,
+				watch.Price.Amount,
+				watch.Price.Currency,
+				watch.ImageURL,
+				nullString(watch.SKU),
+			)
+			if err != nil {
+				return contextError(ctx, err)
+			}
+		}
+
+		// The buffered rows are only sent, and constraints checked, once
+		// the statement is flushed.
+		_, err = stmt.ExecContext(ctx)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "watches_sku_idx"`:
+				return ErrDuplicateSKU
+			default:
+				return contextError(ctx, err)
+			}
+		}
+
+		// Every row was written in this transaction, so they share its
+		// creation time and the column defaults.
+		var createdAt time.Time
+
+		err = tx.QueryRowContext(ctx, `SELECT created_at FROM watches WHERE id = $1`, watches[0].ID).Scan(&createdAt)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		for _, watch := range watches {
+			watch.CreatedAt = createdAt
+			watch.Version = 1
+			watch.StockQuantity = 0
+		}
+
+		ids := make([]int64, len(watches))
+		for i, watch := range watches {
+			ids[i] = watch.ID
+		}
+
+		err = recordInitialPrices(ctx, tx, ids)
+		if err != nil {
+			return err
+		}
+
+		return copyInsertRevisions(ctx, tx, watches)
+	})
+}
+
+// linkBrands links the watches to their brands as linkBrand does, upserting
+// every distinct brand name only once.
+func linkBrands(ctx context.Context, tx *sql.Tx, watches []*Watch) error {
+	byName := make(map[string]*Brand)
+
+	for _, watch := range watches {
+		if watch.BrandID != 0 || watch.Brand == "" {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(watch.Brand))
+
+		brand, ok := byName[key]
+		if !ok {
+			var err error
+			brand, err = upsertBrand(ctx, tx, watch.Brand)
+			if err != nil {
+				return err
+			}
+			byName[key] = brand
+		}
+
+		watch.BrandID = brand.ID
+		watch.Brand = brand.Name
+	}
+
+	return nil
+}
+
+// copyInsertRevisions records the first revision of each of the freshly
+// inserted watches with COPY.
+func copyInsertRevisions(ctx context.Context, tx *sql.Tx, watches []*Watch) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("watch_revisions",
+		"watch_id", "version", "action", "user_id", "snapshot", "changes"))
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer stmt.Close()
+
+	userID := nullInt64(actor(ctx))
+
+	for _, watch := range watches {
+		snapshot, err := json.Marshal(watch)
+		if err != nil {
+			return err
+		}
+
+		changes, err := diffSnapshots(nil, snapshot)
+		if err != nil {
+			return err
+		}
+
+		changesJSON, err := json.Marshal(changes)
+		if err != nil {
+			return err
+		}
+
+		_, err = stmt.ExecContext(ctx, watch.ID, watch.Version, RevisionInsert, userID, string(snapshot), string(changesJSON))
+		if err != nil {
+			return contextError(ctx, err)
+		}
+	}
+
+	_, err = stmt.ExecContext(ctx)
+	return contextError(ctx, err)
+}
+
+// ExistingSKUs returns those of the given SKUs that already belong to a
+// watch, including watches in the trash.
+func (w WatchModel) ExistingSKUs(ctx context.Context, skus []string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, w.Timeouts.Read)
+	defer cancel()
+
+	rows, err := w.DB.QueryContext(ctx, `SELECT sku FROM watches WHERE sku = ANY($1)`, pq.Array(skus))
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	existing := []string{}
+
+	for rows.Next() {
+		var sku string
+		if err := rows.Scan(&sku); err != nil {
+			return nil, contextError(ctx, err)
+		}
+		existing = append(existing, sku)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return existing, nil
+}
+
+// nullInt64 and nullString map zero values to NULL for COPY, which has no
+// NULLIF to do it on the server.
+func nullInt64(n int64) interface{} {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
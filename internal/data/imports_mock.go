@@ -0,0 +1,74 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+func (m MockWatchModel) Import(ctx context.Context, watches []*Watch) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	// Check every row before writing any, as the transaction would.
+	skus := make(map[string]bool)
+	for _, watch := range watches {
+		if m.db.skuTaken(watch.SKU, 0) || watch.SKU != "" && skus[watch.SKU] {
+			return ErrDuplicateSKU
+		}
+		skus[watch.SKU] = true
+
+		if _, ok := m.db.brands[watch.BrandID]; watch.BrandID != 0 && !ok {
+			return errMockForeignKey
+		}
+	}
+
+	createdAt := time.Now().Truncate(time.Second)
+
+	for _, watch := range watches {
+		if err := m.db.linkBrand(watch); err != nil {
+			return err
+		}
+
+		m.db.lastWatchID++
+
+		watch.ID = m.db.lastWatchID
+		watch.CreatedAt = createdAt
+		watch.StockQuantity = 0
+		watch.Version = 1
+
+		stored := *watch
+		m.db.watches[watch.ID] = &stored
+
+		m.db.recordPriceChange(ctx, watch.ID)
+
+		err := m.db.recordWatchRevision(ctx, watch.ID, RevisionInsert)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m MockWatchModel) ExistingSKUs(ctx context.Context, skus []string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	existing := []string{}
+
+	for _, sku := range skus {
+		if m.db.skuTaken(sku, 0) {
+			existing = append(existing, sku)
+		}
+	}
+
+	return existing, nil
+}
@@ -0,0 +1,171 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"jewelry.abgdrv.com/internal/validator"
+	"time"
+)
+
+var (
+	ErrInsufficientStock = errors.New("insufficient stock")
+)
+
+// Kinds of stock movements.
+const (
+	MovementReceipt    = "receipt"
+	MovementSale       = "sale"
+	MovementAdjustment = "adjustment"
+	MovementReturn     = "return"
+)
+
+var MovementKinds = []string{MovementReceipt, MovementSale, MovementAdjustment, MovementReturn}
+
+// StockMovement is one entry of the append-only stock ledger of a watch.
+type StockMovement struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	WatchID   int64     `json:"watch_id"`
+	Kind      string    `json:"kind"`
+	// Quantity is the signed change in stock: positive for receipts and
+	// returns, negative for sales and either for adjustments.
+	Quantity int32 `json:"quantity"`
+	// Balance is the stock quantity of the watch after the movement.
+	Balance int32  `json:"balance"`
+	Note    string `json:"note,omitempty"`
+	// UserID is the user who recorded the movement, zero if unknown.
+	UserID int64 `json:"user_id,omitempty"`
+}
+
+func ValidateStockMovement(v *validator.Validator, movement *StockMovement) {
+	v.Check(validator.In(movement.Kind, MovementKinds...), "kind", "must be one of receipt, sale, adjustment or return")
+
+	switch movement.Kind {
+	case MovementSale:
+		v.Check(movement.Quantity < 0, "quantity", "must be negative for a sale")
+	case MovementAdjustment:
+		v.Check(movement.Quantity != 0, "quantity", "must not be zero")
+	default:
+		v.Check(movement.Quantity > 0, "quantity", fmt.Sprintf("must be positive for a %s", movement.Kind))
+	}
+	v.Check(movement.Quantity >= -1_000_000 && movement.Quantity <= 1_000_000, "quantity", "must be between -1000000 and 1000000")
+
+	v.Check(len(movement.Note) <= 500, "note", "must not be more than 500 bytes long")
+}
+
+type InventoryModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// Record applies the movement to the stock of its watch and appends it to the
+// ledger, filling in its ID, CreatedAt and Balance.
+func (m InventoryModel) Record(ctx context.Context, movement *StockMovement) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		return recordStockMovement(ctx, tx, movement)
+	})
+}
+
+// recordStockMovement does the work of Record inside tx. The conditional
+// UPDATE locks the watch row, so concurrent movements of one watch are applied
+// one after another and none of them can take the stock below zero.
+func recordStockMovement(ctx context.Context, tx *sql.Tx, movement *StockMovement) error {
+	query := `
+	UPDATE watches
+	SET stock_quantity = stock_quantity + $1
+	WHERE id = $2 AND deleted_at IS NULL AND stock_quantity + $1 >= 0
+	RETURNING stock_quantity`
+
+	err := tx.QueryRowContext(ctx, query, movement.Quantity, movement.WatchID).Scan(&movement.Balance)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			var exists bool
+
+			err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM watches WHERE id = $1 AND deleted_at IS NULL)`, movement.WatchID).Scan(&exists)
+			switch {
+			case err != nil:
+				return contextError(ctx, err)
+			case exists:
+				return ErrInsufficientStock
+			default:
+				return ErrRecordNotFound
+			}
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	query = `
+	INSERT INTO stock_movements (watch_id, kind, quantity, balance, note, user_id)
+	VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0))
+	RETURNING id, created_at`
+
+	args := []interface{}{
+		movement.WatchID,
+		movement.Kind,
+		movement.Quantity,
+		movement.Balance,
+		movement.Note,
+		movement.UserID,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movement.ID, &movement.CreatedAt)
+	return contextError(ctx, err)
+}
+
+// GetMovements lists the ledger of one watch a page at a time.
+func (m InventoryModel) GetMovements(ctx context.Context, watchID int64, filters Filters) ([]*StockMovement, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, watch_id, kind, quantity, balance, note, COALESCE(user_id, 0)
+	FROM stock_movements
+	WHERE watch_id = $1
+	ORDER BY %s
+	LIMIT $2 OFFSET $3`, orderBy(filters.sortClauses(), false))
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, watchID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movements := []*StockMovement{}
+
+	for rows.Next() {
+		var movement StockMovement
+
+		err := rows.Scan(
+			&totalRecords,
+			&movement.ID,
+			&movement.CreatedAt,
+			&movement.WatchID,
+			&movement.Kind,
+			&movement.Quantity,
+			&movement.Balance,
+			&movement.Note,
+			&movement.UserID,
+		)
+		if err != nil {
+			return nil, Metadata{}, contextError(ctx, err)
+		}
+
+		movements = append(movements, &movement)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movements, metadata, nil
+}
@@ -0,0 +1,104 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type MockInventoryModel struct {
+	db *mockDB
+}
+
+func (m MockInventoryModel) Record(ctx context.Context, movement *StockMovement) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	return m.db.recordStockMovement(movement)
+}
+
+// recordStockMovement is the in-memory counterpart of recordStockMovement.
+// The caller holds db.mu.
+func (db *mockDB) recordStockMovement(movement *StockMovement) error {
+	watch, ok := db.watches[movement.WatchID]
+	if !ok || watch.DeletedAt != nil {
+		return ErrRecordNotFound
+	}
+
+	if int64(watch.StockQuantity)+int64(movement.Quantity) < 0 {
+		return ErrInsufficientStock
+	}
+
+	watch.StockQuantity += movement.Quantity
+
+	db.lastStockMovementID++
+
+	movement.ID = db.lastStockMovementID
+	movement.CreatedAt = time.Now().Truncate(time.Second)
+	movement.Balance = watch.StockQuantity
+
+	stored := *movement
+	db.stockMovements = append(db.stockMovements, &stored)
+
+	return nil
+}
+
+func (m MockInventoryModel) GetMovements(ctx context.Context, watchID int64, filters Filters) ([]*StockMovement, Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	matched := []*StockMovement{}
+
+	for _, stored := range m.db.stockMovements {
+		if stored.WatchID == watchID {
+			movement := *stored
+			matched = append(matched, &movement)
+		}
+	}
+
+	clauses := filters.sortClauses()
+
+	sort.Slice(matched, func(i, j int) bool {
+		for _, clause := range clauses {
+			var cmp int
+			switch clause.column {
+			case "created_at":
+				cmp = matched[i].CreatedAt.Compare(matched[j].CreatedAt)
+			default:
+				cmp = compareInt64(matched[i].ID, matched[j].ID)
+			}
+			if clause.descending {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+
+	totalRecords := len(matched)
+
+	start := filters.offset()
+	if start > totalRecords {
+		start = totalRecords
+	}
+	end := start + filters.limit()
+	if end > totalRecords {
+		end = totalRecords
+	}
+
+	if start == end {
+		totalRecords = 0
+	}
+
+	return matched[start:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
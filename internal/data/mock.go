@@ -0,0 +1,110 @@
+package data
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Errors returned where PostgreSQL would reject a write with a constraint
+// violation that the SQL models pass through unchanged.
+var (
+	errMockDuplicateKey = errors.New("mock: duplicate key value violates unique constraint")
+	errMockForeignKey   = errors.New("mock: insert or update violates foreign key constraint")
+)
+
+// mockDB is the in-memory counterpart of the PostgreSQL schema. Every mock
+// model shares one instance so that joins (users and tokens, users and
+// permissions) behave the same way they do against the real database.
+type mockDB struct {
+	mu sync.Mutex
+
+	watches     map[int64]*Watch
+	lastWatchID int64
+
+	watchRevisions      []*WatchRevision
+	lastWatchRevisionID int64
+
+	priceHistory      []*PriceChange
+	lastPriceChangeID int64
+
+	stockMovements      []*StockMovement
+	lastStockMovementID int64
+
+	watchImages      map[int64]*WatchImage
+	lastWatchImageID int64
+
+	brands      map[int64]*Brand
+	lastBrandID int64
+
+	currencyRates map[string]*CurrencyRate
+
+	wishlistItems []*mockWishlistItem
+	// wishlistShares maps user ids to the hashes of their share tokens.
+	wishlistShares map[int64]string
+
+	carts      map[int64]*mockCart
+	lastCartID int64
+
+	orders      map[int64]*Order
+	lastOrderID int64
+	// paymentEvents holds the ids of the payment events applied to orders.
+	paymentEvents map[string]bool
+
+	reviews      map[int64]*Review
+	lastReviewID int64
+
+	promotions           map[int64]*Promotion
+	lastPromotionID      int64
+	promotionRedemptions []*mockRedemption
+
+	users      map[int64]*User
+	lastUserID int64
+
+	tokens map[string]*Token
+
+	permissions      map[int64]string
+	usersPermissions map[int64]map[int64]bool
+}
+
+func newMockDB() *mockDB {
+	return &mockDB{
+		watches:          make(map[int64]*Watch),
+		watchImages:      make(map[int64]*WatchImage),
+		brands:           make(map[int64]*Brand),
+		currencyRates:    make(map[string]*CurrencyRate),
+		wishlistShares:   make(map[int64]string),
+		carts:            make(map[int64]*mockCart),
+		orders:           make(map[int64]*Order),
+		paymentEvents:    make(map[string]bool),
+		reviews:          make(map[int64]*Review),
+		promotions:       make(map[int64]*Promotion),
+		users:            make(map[int64]*User),
+		tokens:           make(map[string]*Token),
+		permissions:      map[int64]string{1: "watches:read", 2: "watches:write", 3: "inventory:write", 4: "brands:write", 5: "watches:purge", 6: "currencies:write", 7: "wishlist:write", 8: "orders:manage", 9: "reviews:moderate", 10: "promotions:write"},
+		usersPermissions: make(map[int64]map[int64]bool),
+	}
+}
+
+// mockMatchText mimics to_tsvector('simple', value) @@ plainto_tsquery('simple', query):
+// every word of the query has to appear as a word of the value, ignoring case.
+func mockMatchText(value, query string) bool {
+	words := make(map[string]bool)
+	for _, word := range mockWords(value) {
+		words[word] = true
+	}
+
+	for _, word := range mockWords(query) {
+		if !words[word] {
+			return false
+		}
+	}
+	return true
+}
+
+func mockWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,243 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMockWatchEditConflict(t *testing.T) {
+	ctx := context.Background()
+	models := NewMockModels()
+
+	watch := &Watch{Brand: "Omega", Model: "Seamaster", DialColor: "blue", StrapType: "steel", Diameter: 42, Energy: "mechanical", Gender: "male"}
+
+	err := models.Watches.Insert(ctx, watch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := models.Watches.Get(ctx, watch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := models.Watches.Get(ctx, watch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first.Model = "Speedmaster"
+
+	err = models.Watches.Update(ctx, first)
+	if err != nil {
+		t.Fatalf("first update: %v", err)
+	}
+	if first.Version != 2 {
+		t.Errorf("version after the first update = %d; want 2", first.Version)
+	}
+
+	// The second copy was read before the first update, so its version is
+	// out of date.
+	second.DialColor = "black"
+
+	err = models.Watches.Update(ctx, second)
+	if !errors.Is(err, ErrEditConflict) {
+		t.Fatalf("stale update: err = %v; want ErrEditConflict", err)
+	}
+
+	stored, err := models.Watches.Get(ctx, watch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Model != "Speedmaster" || stored.DialColor != "blue" {
+		t.Errorf("stored watch is %s with a %s dial; want the first update only", stored.Model, stored.DialColor)
+	}
+
+	err = models.Watches.Update(ctx, &Watch{ID: watch.ID + 1, Version: 1})
+	if !errors.Is(err, ErrEditConflict) {
+		t.Errorf("update of a missing watch: err = %v; want ErrEditConflict", err)
+	}
+}
+
+func TestMockDuplicateEmail(t *testing.T) {
+	ctx := context.Background()
+	models := NewMockModels()
+
+	alice := &User{Name: "Alice", Email: "alice@example.com"}
+	bob := &User{Name: "Bob", Email: "bob@example.com"}
+
+	for _, user := range []*User{alice, bob} {
+		err := models.Users.Insert(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		write   func() error
+		wantErr error
+	}{
+		{
+			name:    "insert with a taken email",
+			write:   func() error { return models.Users.Insert(ctx, &User{Name: "Eve", Email: "alice@example.com"}) },
+			wantErr: ErrDuplicateEmail,
+		},
+		{
+			name:    "insert differing in case",
+			write:   func() error { return models.Users.Insert(ctx, &User{Name: "Eve", Email: "ALICE@example.com"}) },
+			wantErr: ErrDuplicateEmail,
+		},
+		{
+			name: "update to the email of another user",
+			write: func() error {
+				user := *bob
+				user.Email = "Alice@Example.com"
+				return models.Users.Update(ctx, &user)
+			},
+			wantErr: ErrDuplicateEmail,
+		},
+		{
+			name: "update keeping the own email",
+			write: func() error {
+				user := *alice
+				user.Name = "Alice Smith"
+				return models.Users.Update(ctx, &user)
+			},
+		},
+		{
+			name:  "insert with a free email",
+			write: func() error { return models.Users.Insert(ctx, &User{Name: "Carol", Email: "carol@example.com"}) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.write()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMockTokenExpiry(t *testing.T) {
+	ctx := context.Background()
+	models := NewMockModels()
+
+	user := &User{Name: "Alice", Email: "alice@example.com"}
+
+	err := models.Users.Insert(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		scope     string
+		lookup    string
+		revoke    bool
+		wantFound bool
+	}{
+		{name: "valid", ttl: time.Hour, scope: ScopeAuthentication, lookup: ScopeAuthentication, wantFound: true},
+		{name: "expired", ttl: -time.Minute, scope: ScopeAuthentication, lookup: ScopeAuthentication},
+		{name: "other scope", ttl: time.Hour, scope: ScopeActivation, lookup: ScopeAuthentication},
+		{name: "revoked", ttl: time.Hour, scope: ScopeAuthentication, lookup: ScopeAuthentication, revoke: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := models.Tokens.New(ctx, user.ID, tt.ttl, tt.scope)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.revoke {
+				err = models.Tokens.DeleteAllForUser(ctx, tt.scope, user.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := models.Users.GetForToken(ctx, tt.lookup, token.Plaintext)
+
+			switch {
+			case tt.wantFound && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantFound && got.ID != user.ID:
+				t.Errorf("user %d; want %d", got.ID, user.ID)
+			case !tt.wantFound && !errors.Is(err, ErrRecordNotFound):
+				t.Errorf("err = %v; want ErrRecordNotFound", err)
+			}
+		})
+	}
+
+	_, err = models.Tokens.New(ctx, user.ID+1, time.Hour, ScopeAuthentication)
+	if !errors.Is(err, errMockForeignKey) {
+		t.Errorf("token of a missing user: err = %v; want errMockForeignKey", err)
+	}
+}
+
+func TestMockPermissions(t *testing.T) {
+	ctx := context.Background()
+	models := NewMockModels()
+
+	alice := &User{Name: "Alice", Email: "alice@example.com"}
+	bob := &User{Name: "Bob", Email: "bob@example.com"}
+
+	for _, user := range []*User{alice, bob} {
+		err := models.Users.Insert(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := models.Permissions.AddForUser(ctx, alice.ID, "watches:read", "watches:write", "no:such")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Permissions.AddForUser(ctx, bob.ID, "watches:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		userID int64
+		want   Permissions
+	}{
+		{"every granted code", alice.ID, Permissions{"watches:read", "watches:write"}},
+		{"only the own codes", bob.ID, Permissions{"watches:read"}},
+		{"missing user", bob.ID + 1, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := models.Permissions.GetAllForUser(ctx, tt.userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sort.Strings(got)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("permissions = %v; want %v", got, tt.want)
+			}
+		})
+	}
+
+	err = models.Permissions.AddForUser(ctx, bob.ID, "watches:read")
+	if !errors.Is(err, errMockDuplicateKey) {
+		t.Errorf("granting a code twice: err = %v; want errMockDuplicateKey", err)
+	}
+
+	err = models.Permissions.AddForUser(ctx, bob.ID+1, "watches:read")
+	if !errors.Is(err, errMockForeignKey) {
+		t.Errorf("granting to a missing user: err = %v; want errMockForeignKey", err)
+	}
+}
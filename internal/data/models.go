@@ -1,8 +1,10 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
@@ -10,24 +12,229 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
+// Timeouts bounds how long a single model operation may run against the
+// database, on top of whatever deadline the caller's context already carries.
+// Bulk applies to operations on many rows at once, such as imports.
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+	Bulk  time.Duration
+}
+
+// contextError returns the context's error in place of err once the context
+// is done. lib/pq reports a cancelled statement as an ordinary server error,
+// which would otherwise hide that the request was cancelled or timed out.
+func contextError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// withTx runs fn in a transaction that is committed if fn returns nil and
+// rolled back otherwise.
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return contextError(ctx, tx.Commit())
+}
+
+type WatchStore interface {
+	Insert(ctx context.Context, watch *Watch) error
+	Get(ctx context.Context, id int64) (*Watch, error)
+	GetTrashed(ctx context.Context, id int64) (*Watch, error)
+	Import(ctx context.Context, watches []*Watch) error
+	ExistingSKUs(ctx context.Context, skus []string) ([]string, error)
+	Update(ctx context.Context, watch *Watch) error
+	Revert(ctx context.Context, watch *Watch) error
+	Delete(ctx context.Context, id int64, version int32) error
+	Restore(ctx context.Context, id int64, version int32) error
+	Purge(ctx context.Context, id int64, version int32) error
+	GetAll(ctx context.Context, filter WatchFilter, filters Filters) ([]*Watch, Metadata, error)
+	Export(ctx context.Context, filter WatchFilter, filters Filters, fn func(watch *Watch) error) error
+	Facets(ctx context.Context, filter WatchFilter) (Facets, error)
+	CachedFacets(ctx context.Context) (Facets, error)
+	RefreshFacets(ctx context.Context) error
+}
+
+type RevisionStore interface {
+	Get(ctx context.Context, watchID int64, version int32) (*WatchRevision, error)
+	GetAll(ctx context.Context, watchID int64, filters Filters) ([]*WatchRevision, Metadata, error)
+}
+
+type PriceStore interface {
+	GetAll(ctx context.Context, watchID int64, filters Filters) ([]*PriceChange, Metadata, error)
+	GetDrops(ctx context.Context, watchIDs []int64, since time.Time) (map[int64]*PriceChange, error)
+}
+
+type InventoryStore interface {
+	Record(ctx context.Context, movement *StockMovement) error
+	GetMovements(ctx context.Context, watchID int64, filters Filters) ([]*StockMovement, Metadata, error)
+}
+
+type ImageStore interface {
+	Insert(ctx context.Context, image *WatchImage) error
+	Get(ctx context.Context, watchID, id int64) (*WatchImage, error)
+	GetAllForWatches(ctx context.Context, watchIDs []int64) (map[int64][]*WatchImage, error)
+	Update(ctx context.Context, image *WatchImage) error
+	Delete(ctx context.Context, watchID, id int64) error
+}
+
+type BrandStore interface {
+	Insert(ctx context.Context, brand *Brand) error
+	Get(ctx context.Context, id int64) (*Brand, error)
+	GetByName(ctx context.Context, name string) (*Brand, error)
+	Update(ctx context.Context, brand *Brand) error
+	Delete(ctx context.Context, id int64) error
+	GetAll(ctx context.Context, name string, filters Filters) ([]*Brand, Metadata, error)
+	GetForWatches(ctx context.Context, watchIDs []int64) (map[int64]*Brand, error)
+}
+
+type WishlistStore interface {
+	GetAll(ctx context.Context, userID int64, filters Filters) ([]*WishlistItem, Metadata, error)
+	Get(ctx context.Context, userID, watchID int64) (*WishlistItem, error)
+	Add(ctx context.Context, userID, watchID int64, note string) error
+	UpdateNote(ctx context.Context, userID, watchID int64, note string) error
+	Remove(ctx context.Context, userID, watchID int64) error
+	Share(ctx context.Context, userID int64) (string, error)
+	Unshare(ctx context.Context, userID int64) error
+	IsShared(ctx context.Context, userID int64) (bool, error)
+	GetOwnerForShareToken(ctx context.Context, tokenPlaintext string) (*User, error)
+}
+
+type CartStore interface {
+	NewGuest(ctx context.Context) (*Cart, error)
+	ForUser(ctx context.Context, userID int64) (int64, error)
+	Get(ctx context.Context, id int64) (*Cart, error)
+	GetForUser(ctx context.Context, userID int64) (*Cart, error)
+	SetItem(ctx context.Context, cartID, watchID int64, quantity int32) error
+	RemoveItem(ctx context.Context, cartID, watchID int64) error
+	Clear(ctx context.Context, cartID int64) error
+	Merge(ctx context.Context, fromID, toID int64) error
+}
+
+type OrderStore interface {
+	Create(ctx context.Context, order *Order, cartID int64, promotionCode string) error
+	Get(ctx context.Context, id int64) (*Order, error)
+	GetForPaymentIntent(ctx context.Context, intentID string) (*Order, error)
+	GetAll(ctx context.Context, filter OrderFilter, filters Filters) ([]*Order, Metadata, error)
+	Transition(ctx context.Context, order *Order, to, trackingNumber string) error
+	SetPaymentIntent(ctx context.Context, order *Order, intentID string) error
+	FailPayment(ctx context.Context, order *Order, intentID string) error
+	ApplyPaymentEvent(ctx context.Context, order *Order, eventID, eventType, paymentStatus, to string) error
+}
+
+type ReviewStore interface {
+	Insert(ctx context.Context, review *Review) error
+	Get(ctx context.Context, watchID, id int64) (*Review, error)
+	GetAll(ctx context.Context, filter ReviewFilter, filters Filters) ([]*Review, Metadata, error)
+	Update(ctx context.Context, review *Review) error
+	Delete(ctx context.Context, watchID, id int64) error
+}
+
+type PromotionStore interface {
+	Insert(ctx context.Context, promotion *Promotion) error
+	Get(ctx context.Context, id int64) (*Promotion, error)
+	GetByCode(ctx context.Context, code string) (*Promotion, error)
+	GetAll(ctx context.Context, filter PromotionFilter, filters Filters) ([]*Promotion, Metadata, error)
+	Update(ctx context.Context, promotion *Promotion) error
+	Delete(ctx context.Context, id int64) error
+	Deactivate(ctx context.Context, id int64) error
+	CountRedemptions(ctx context.Context, promotionID, userID int64) (int32, error)
+}
+
+type CurrencyStore interface {
+	Get(ctx context.Context, currency string) (*CurrencyRate, error)
+	GetAll(ctx context.Context) ([]*CurrencyRate, error)
+	Set(ctx context.Context, rate *CurrencyRate) error
+	Delete(ctx context.Context, currency string) error
+}
+
+type PermissionStore interface {
+	GetAllForUser(ctx context.Context, userID int64) (Permissions, error)
+	AddForUser(ctx context.Context, userID int64, codes ...string) error
+}
+
+type TokenStore interface {
+	New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error)
+	Insert(ctx context.Context, token *Token) error
+	DeleteAllForUser(ctx context.Context, scope string, userID int64) error
+}
+
+type UserStore interface {
+	Insert(ctx context.Context, user *User) error
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	Update(ctx context.Context, user *User) error
+	GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error)
+}
+
 type Models struct {
-	Watches     WatchModel
-	Permissions PermissionModel
-	Tokens      TokenModel
-	Users       UserModel
+	Watches     WatchStore
+	Revisions   RevisionStore
+	Prices      PriceStore
+	Inventory   InventoryStore
+	Images      ImageStore
+	Brands      BrandStore
+	Currencies  CurrencyStore
+	Wishlists   WishlistStore
+	Carts       CartStore
+	Orders      OrderStore
+	Reviews     ReviewStore
+	Promotions  PromotionStore
+	Permissions PermissionStore
+	Tokens      TokenStore
+	Users       UserStore
 }
 
-func NewModels(db *sql.DB) Models {
+func NewModels(db *sql.DB, timeouts Timeouts) Models {
 	return Models{
-		Watches:     WatchModel{DB: db},
-		Permissions: PermissionModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Users:       UserModel{DB: db},
+		Watches:     WatchModel{DB: db, Timeouts: timeouts},
+		Revisions:   RevisionModel{DB: db, Timeouts: timeouts},
+		Prices:      PriceModel{DB: db, Timeouts: timeouts},
+		Inventory:   InventoryModel{DB: db, Timeouts: timeouts},
+		Images:      ImageModel{DB: db, Timeouts: timeouts},
+		Brands:      BrandModel{DB: db, Timeouts: timeouts},
+		Currencies:  CurrencyModel{DB: db, Timeouts: timeouts},
+		Wishlists:   WishlistModel{DB: db, Timeouts: timeouts},
+		Carts:       CartModel{DB: db, Timeouts: timeouts},
+		Orders:      OrderModel{DB: db, Timeouts: timeouts},
+		Reviews:     ReviewModel{DB: db, Timeouts: timeouts},
+		Promotions:  PromotionModel{DB: db, Timeouts: timeouts},
+		Permissions: PermissionModel{DB: db, Timeouts: timeouts},
+		Tokens:      TokenModel{DB: db, Timeouts: timeouts},
+		Users:       UserModel{DB: db, Timeouts: timeouts},
 	}
 }
 
-//func NewMockModels() Models {
-//	return Models{
-//		Watches: MockWatchModel{},
-//	}
-//}
+// NewMockModels returns models backed by a shared in-memory store, so the
+// API can run without a PostgreSQL instance.
+func NewMockModels() Models {
+	db := newMockDB()
+
+	return Models{
+		Watches:     MockWatchModel{db: db},
+		Revisions:   MockRevisionModel{db: db},
+		Prices:      MockPriceModel{db: db},
+		Inventory:   MockInventoryModel{db: db},
+		Images:      MockImageModel{db: db},
+		Brands:      MockBrandModel{db: db},
+		Currencies:  MockCurrencyModel{db: db},
+		Wishlists:   MockWishlistModel{db: db},
+		Carts:       MockCartModel{db: db},
+		Orders:      MockOrderModel{db: db},
+		Reviews:     MockReviewModel{db: db},
+		Promotions:  MockPromotionModel{db: db},
+		Permissions: MockPermissionModel{db: db},
+		Tokens:      MockTokenModel{db: db},
+		Users:       MockUserModel{db: db},
+	}
+}
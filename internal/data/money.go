@@ -0,0 +1,209 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CatalogCurrency is the currency watch prices are kept in. Prices in any
+// other currency are converted from it at read time, using the rates managed
+// through CurrencyModel.
+const CatalogCurrency = "USD"
+
+// currencyExponents maps the supported ISO 4217 currencies to their number
+// of minor unit digits.
+var currencyExponents = map[string]int{
+	"AED": 2, "AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CNY": 2,
+	"CZK": 2, "DKK": 2, "EUR": 2, "GBP": 2, "HKD": 2, "HUF": 2, "IDR": 2,
+	"ILS": 2, "INR": 2, "JPY": 0, "KRW": 0, "KWD": 3, "KZT": 2, "MXN": 2,
+	"NOK": 2, "NZD": 2, "OMR": 3, "PLN": 2, "RUB": 2, "SAR": 2, "SEK": 2,
+	"SGD": 2, "THB": 2, "TRY": 2, "UAH": 2, "USD": 2, "ZAR": 2,
+}
+
+var (
+	ErrUnknownCurrency = errors.New("unknown currency")
+	ErrInvalidAmount   = errors.New("invalid amount")
+)
+
+// amountRX is the format of decimal money amounts.
+var amountRX = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// ValidCurrency reports whether code is a supported ISO 4217 currency code.
+func ValidCurrency(code string) bool {
+	_, ok := currencyExponents[code]
+	return ok
+}
+
+// Money is an exact amount in a currency, counted in the currency's minor
+// units (cents for USD, yen for JPY). In JSON it is an object holding the
+// amount as a decimal string, which no client has to parse as a float.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// ParseMoney parses a decimal amount in currency, which must not have more
+// decimal places than the currency has minor unit digits.
+func ParseMoney(amount, currency string) (Money, error) {
+	exponent, ok := currencyExponents[currency]
+	if !ok {
+		return Money{}, ErrUnknownCurrency
+	}
+
+	amount = strings.TrimSpace(amount)
+	if !amountRX.MatchString(amount) {
+		return Money{}, ErrInvalidAmount
+	}
+
+	whole, fraction, _ := strings.Cut(amount, ".")
+	if len(fraction) > exponent {
+		return Money{}, ErrInvalidAmount
+	}
+
+	units, err := strconv.ParseInt(whole+fraction+strings.Repeat("0", exponent-len(fraction)), 10, 64)
+	if err != nil {
+		return Money{}, ErrInvalidAmount
+	}
+
+	return Money{Amount: units, Currency: currency}, nil
+}
+
+// Decimal formats the amount with exactly as many decimal places as the
+// currency has minor unit digits.
+func (m Money) Decimal() string {
+	exponent := currencyExponents[m.Currency]
+
+	sign := ""
+	units := m.Amount
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+
+	digits := strconv.FormatInt(units, 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// Convert returns the amount in another currency, given the number of units
+// of that currency one unit of this one is worth, rounded half away from
+// zero to the minor unit.
+func (m Money) Convert(currency string, rate *big.Rat) Money {
+	if currency == m.Currency {
+		return m
+	}
+
+	value := new(big.Rat).SetInt64(m.Amount)
+	value.Mul(value, rate)
+
+	// Shift the amount from the minor units of one currency to those of
+	// the other.
+	for shift := currencyExponents[currency] - currencyExponents[m.Currency]; shift != 0; {
+		if shift > 0 {
+			value.Mul(value, big.NewRat(10, 1))
+			shift--
+		} else {
+			value.Quo(value, big.NewRat(10, 1))
+			shift++
+		}
+	}
+
+	// Adding half of the denominator before truncating rounds half away
+	// from zero.
+	num := new(big.Int).Abs(value.Num())
+	den := value.Denom()
+	num.Add(num.Mul(num, big.NewInt(2)), den)
+	num.Quo(num, new(big.Int).Mul(den, big.NewInt(2)))
+	if value.Sign() < 0 {
+		num.Neg(num)
+	}
+
+	amount := int64(math.MaxInt64)
+	if num.IsInt64() {
+		amount = num.Int64()
+	}
+
+	return Money{Amount: amount, Currency: currency}
+}
+
+// MoneyError reports a JSON money value that cannot be decoded.
+type MoneyError struct {
+	Amount   string
+	Currency string
+	Err      error
+}
+
+func (e *MoneyError) Error() string {
+	if errors.Is(e.Err, ErrUnknownCurrency) {
+		return fmt.Sprintf("%q is not a supported currency", e.Currency)
+	}
+	return fmt.Sprintf("%q is not a valid amount of %s", e.Amount, e.Currency)
+}
+
+func (e *MoneyError) Unwrap() error {
+	return e.Err
+}
+
+type moneyJSON struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Amount: m.Decimal(), Currency: m.Currency})
+}
+
+// UnmarshalJSON accepts an object with an amount, given as a string or a
+// number, and a currency. A bare amount, as prices were written before they
+// had a currency, and an object without a currency are taken to be in the
+// catalog currency.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+
+	var object struct {
+		Amount   json.RawMessage `json:"amount"`
+		Currency string          `json:"currency"`
+	}
+
+	raw := b
+	currency := CatalogCurrency
+
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		if err := json.Unmarshal(b, &object); err != nil {
+			return err
+		}
+		raw = object.Amount
+		if object.Currency != "" {
+			currency = object.Currency
+		}
+	}
+
+	amount := strings.Trim(string(bytes.TrimSpace(raw)), `"`)
+
+	money, err := ParseMoney(amount, currency)
+	if err != nil {
+		return &MoneyError{Amount: amount, Currency: currency, Err: err}
+	}
+
+	*m = money
+	return nil
+}
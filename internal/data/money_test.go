@@ -0,0 +1,100 @@
+package data
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     int64
+		wantErr  error
+	}{
+		{"12", "USD", 1200, nil},
+		{"12.5", "USD", 1250, nil},
+		{"12.34", "USD", 1234, nil},
+		{" 0.01 ", "USD", 1, nil},
+		{"-3.10", "EUR", -310, nil},
+		{"1500", "JPY", 1500, nil},
+		{"1.234", "KWD", 1234, nil},
+		{"12.345", "USD", 0, ErrInvalidAmount},
+		{"1.5", "JPY", 0, ErrInvalidAmount},
+		{"1,50", "EUR", 0, ErrInvalidAmount},
+		{"1e3", "USD", 0, ErrInvalidAmount},
+		{".5", "USD", 0, ErrInvalidAmount},
+		{"", "USD", 0, ErrInvalidAmount},
+		{"99999999999999999999", "USD", 0, ErrInvalidAmount},
+		{"12", "XYZ", 0, ErrUnknownCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount+" "+tt.currency, func(t *testing.T) {
+			got, err := ParseMoney(tt.amount, tt.currency)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v; want %v", err, tt.wantErr)
+			}
+			if err == nil && (got.Amount != tt.want || got.Currency != tt.currency) {
+				t.Errorf("got %d %s; want %d %s", got.Amount, got.Currency, tt.want, tt.currency)
+			}
+		})
+	}
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{1234, "USD"}, "12.34"},
+		{Money{5, "USD"}, "0.05"},
+		{Money{-5, "USD"}, "-0.05"},
+		{Money{1500, "JPY"}, "1500"},
+		{Money{1, "KWD"}, "0.001"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.money.Decimal(); got != tt.want {
+			t.Errorf("%d %s: Decimal() = %q; want %q", tt.money.Amount, tt.money.Currency, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		money    Money
+		currency string
+		rate     string
+		want     int64
+	}{
+		{"same currency", Money{1234, "USD"}, "USD", "2", 1234},
+		{"exact", Money{10000, "USD"}, "EUR", "0.92", 9200},
+		{"rounds down", Money{1, "USD"}, "EUR", "0.4", 0},
+		{"rounds half up", Money{1, "USD"}, "EUR", "0.5", 1},
+		{"rounds half away from zero", Money{-1, "USD"}, "EUR", "0.5", -1},
+		{"rounds negative down", Money{-1, "USD"}, "EUR", "0.4", 0},
+		{"to fewer digits", Money{12345, "USD"}, "JPY", "150", 18518},
+		{"to fewer digits half", Money{1, "USD"}, "JPY", "50", 1},
+		{"to more digits", Money{100, "JPY"}, "KWD", "0.002", 200},
+		{"repeating rate", Money{100, "USD"}, "EUR", "1/3", 33},
+		{"overflow", Money{math.MaxInt64, "USD"}, "EUR", "2", math.MaxInt64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, ok := new(big.Rat).SetString(tt.rate)
+			if !ok {
+				t.Fatalf("bad rate %q", tt.rate)
+			}
+
+			got := tt.money.Convert(tt.currency, rate)
+			if got.Amount != tt.want || got.Currency != tt.currency {
+				t.Errorf("got %d %s; want %d %s", got.Amount, got.Currency, tt.want, tt.currency)
+			}
+		})
+	}
+}
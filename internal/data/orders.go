@@ -0,0 +1,658 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"jewelry.abgdrv.com/internal/validator"
+	"time"
+)
+
+var (
+	ErrEmptyCart             = errors.New("empty cart")
+	ErrWatchUnavailable      = errors.New("watch unavailable")
+	ErrDuplicatePaymentEvent = errors.New("duplicate payment event")
+)
+
+// Statuses of an order.
+const (
+	OrderPending   = "pending"
+	OrderPaid      = "paid"
+	OrderShipped   = "shipped"
+	OrderDelivered = "delivered"
+	OrderCancelled = "cancelled"
+	OrderRefunded  = "refunded"
+)
+
+var OrderStatuses = []string{OrderPending, OrderPaid, OrderShipped, OrderDelivered, OrderCancelled, OrderRefunded}
+
+// Statuses of the payment of an order. An order is processing from the time
+// a payment is started until the provider reports its outcome.
+const (
+	PaymentUnpaid     = "unpaid"
+	PaymentProcessing = "processing"
+	PaymentPaid       = "paid"
+	PaymentFailed     = "failed"
+	PaymentRefunded   = "refunded"
+)
+
+// orderTransitions lists the statuses an order in each status can move to.
+// Cancelled and refunded orders are final.
+var orderTransitions = map[string][]string{
+	OrderPending:   {OrderPaid, OrderCancelled},
+	OrderPaid:      {OrderShipped, OrderRefunded},
+	OrderShipped:   {OrderDelivered},
+	OrderDelivered: {OrderRefunded},
+}
+
+// CanTransition reports whether an order can move from one status to another.
+func CanTransition(from, to string) bool {
+	return validator.In(to, orderTransitions[from]...)
+}
+
+// releasesStock reports whether moving an order from one status to another
+// puts its watches back in stock: it is cancelled, or refunded before it was
+// shipped. Watches of an order refunded after delivery only come back through
+// a return recorded in the inventory.
+func releasesStock(from, to string) bool {
+	return to == OrderCancelled || (from == OrderPaid && to == OrderRefunded)
+}
+
+// OutOfStockError is returned when an order asks for more of a watch than
+// there is in stock. It matches ErrInsufficientStock.
+type OutOfStockError struct {
+	WatchID int64
+}
+
+func (e *OutOfStockError) Error() string {
+	return fmt.Sprintf("insufficient stock of watch %d", e.WatchID)
+}
+
+func (e *OutOfStockError) Is(target error) bool {
+	return target == ErrInsufficientStock
+}
+
+// UnavailableWatchesError is returned when a cart holds watches that were
+// moved to the trash since they were added, and can no longer be ordered. It
+// matches ErrWatchUnavailable.
+type UnavailableWatchesError struct {
+	WatchIDs []int64
+}
+
+func (e *UnavailableWatchesError) Error() string {
+	return fmt.Sprintf("watches %v are no longer available", e.WatchIDs)
+}
+
+func (e *UnavailableWatchesError) Is(target error) bool {
+	return target == ErrWatchUnavailable
+}
+
+type Order struct {
+	ID              int64        `json:"id"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	UserID          int64        `json:"user_id"`
+	Email           string       `json:"email"`
+	Status          string       `json:"status"`
+	ShippingAddress string       `json:"shipping_address"`
+	TrackingNumber  string       `json:"tracking_number,omitempty"`
+	PaymentStatus   string       `json:"payment_status"`
+	PaymentIntentID string       `json:"payment_intent_id,omitempty"`
+	Items           []*OrderItem `json:"items"`
+	// PromotionCode and Discount are a snapshot of the promotion the order
+	// was placed with. Total is what is left after the discount.
+	PromotionCode string `json:"promotion_code,omitempty"`
+	Discount      Money  `json:"discount"`
+	Total         Money  `json:"total"`
+	Version       int32  `json:"version"`
+}
+
+// OrderItem is a quantity of one watch in an order. Brand, Model and
+// UnitPrice are a snapshot of the watch when the order was placed.
+type OrderItem struct {
+	// WatchID is zero once the watch has been purged.
+	WatchID int64 `json:"watch_id,omitempty"`
+	// BrandID is only set while the order is placed, for the promotion it
+	// is placed with.
+	BrandID   int64  `json:"-"`
+	Brand     string `json:"brand"`
+	Model     string `json:"model"`
+	Quantity  int32  `json:"quantity"`
+	UnitPrice Money  `json:"unit_price"`
+	Subtotal  Money  `json:"subtotal"`
+}
+
+func ValidateShippingAddress(v *validator.Validator, address string) {
+	v.Check(address != "", "shipping_address", "must be provided")
+	v.Check(len(address) <= 1000, "shipping_address", "must not be more than 1000 bytes long")
+}
+
+// ValidateOrderTransition checks that order can move to the status to, and
+// that a tracking number is given when it is shipped.
+func ValidateOrderTransition(v *validator.Validator, order *Order, to, trackingNumber string) {
+	v.Check(validator.In(to, OrderStatuses...), "status", "must be one of pending, paid, shipped, delivered, cancelled or refunded")
+	if v.Valid() {
+		v.Check(CanTransition(order.Status, to), "status", fmt.Sprintf("cannot change from %s to %s", order.Status, to))
+	}
+
+	if to == OrderShipped {
+		v.Check(trackingNumber != "", "tracking_number", "must be provided when shipping")
+	}
+	v.Check(len(trackingNumber) <= 100, "tracking_number", "must not be more than 100 bytes long")
+}
+
+// total fills in the subtotals of the items of the order, and its total
+// less the discount.
+func (order *Order) total() {
+	order.Total = Money{Amount: -order.Discount.Amount, Currency: CatalogCurrency}
+	order.Discount.Currency = CatalogCurrency
+
+	for _, item := range order.Items {
+		item.Subtotal = Money{Amount: item.UnitPrice.Amount * int64(item.Quantity), Currency: item.UnitPrice.Currency}
+		order.Total.Amount += item.Subtotal.Amount
+	}
+}
+
+// pricedLines returns the items of the order as promotions see them.
+func (order *Order) pricedLines() []PricedLine {
+	lines := make([]PricedLine, len(order.Items))
+	for i, item := range order.Items {
+		lines[i] = PricedLine{WatchID: item.WatchID, BrandID: item.BrandID, Subtotal: item.Subtotal}
+	}
+	return lines
+}
+
+// OrderFilter narrows a listing of orders. Zero fields match every order.
+type OrderFilter struct {
+	UserID int64
+	Status string
+}
+
+type OrderModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// Create places order from the cart cartID in one transaction: it takes a
+// snapshot of the watches in the cart at their current prices, takes them out
+// of stock with sale movements, and empties the cart. UserID, Email and
+// ShippingAddress of order have to be set; the rest is filled in. If
+// promotionCode is not empty, the order is discounted and the promotion
+// redeemed. It returns ErrEmptyCart if the cart holds no watch, an
+// UnavailableWatchesError if some of them are in the trash, a
+// *PromotionError if the promotion does not apply, and an OutOfStockError if
+// there is not enough of one of the watches in stock.
+func (m OrderModel) Create(ctx context.Context, order *Order, cartID int64, promotionCode string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		// Ordering by watch takes the row locks of recordStockMovement in the
+		// same order in every transaction, so two orders cannot deadlock.
+		query := `
+		SELECT cart_items.watch_id, COALESCE(watches.brand_id, 0), watches.brand, watches.model, cart_items.quantity,
+		       watches.price, watches.currency, watches.deleted_at IS NOT NULL
+		FROM cart_items
+		INNER JOIN watches ON watches.id = cart_items.watch_id
+		WHERE cart_items.cart_id = $1
+		ORDER BY cart_items.watch_id
+		FOR UPDATE OF cart_items`
+
+		rows, err := tx.QueryContext(ctx, query, cartID)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+		defer rows.Close()
+
+		order.Items = []*OrderItem{}
+
+		var unavailable []int64
+
+		for rows.Next() {
+			var item OrderItem
+			var trashed bool
+
+			err := rows.Scan(&item.WatchID, &item.BrandID, &item.Brand, &item.Model, &item.Quantity, &item.UnitPrice.Amount, &item.UnitPrice.Currency, &trashed)
+			if err != nil {
+				return contextError(ctx, err)
+			}
+
+			if trashed {
+				unavailable = append(unavailable, item.WatchID)
+				continue
+			}
+
+			order.Items = append(order.Items, &item)
+		}
+
+		if err = rows.Err(); err != nil {
+			return contextError(ctx, err)
+		}
+
+		if len(unavailable) > 0 {
+			return &UnavailableWatchesError{WatchIDs: unavailable}
+		}
+
+		if len(order.Items) == 0 {
+			return ErrEmptyCart
+		}
+
+		order.Discount = Money{}
+		order.total()
+
+		var promotion *Promotion
+
+		if promotionCode != "" {
+			promotion, err = priceOrder(ctx, tx, order, promotionCode)
+			if err != nil {
+				return err
+			}
+		}
+
+		query = `
+		INSERT INTO orders (user_id, email, shipping_address, promotion_code, discount, total, currency)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at, status, payment_status, version`
+
+		args := []interface{}{
+			order.UserID,
+			order.Email,
+			order.ShippingAddress,
+			order.PromotionCode,
+			order.Discount.Amount,
+			order.Total.Amount,
+			order.Total.Currency,
+		}
+
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&order.ID, &order.CreatedAt, &order.UpdatedAt, &order.Status, &order.PaymentStatus, &order.Version)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		if promotion != nil {
+			err = redeemPromotion(ctx, tx, promotion, order)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, item := range order.Items {
+			err = recordStockMovement(ctx, tx, &StockMovement{
+				WatchID:  item.WatchID,
+				Kind:     MovementSale,
+				Quantity: -item.Quantity,
+				Note:     fmt.Sprintf("order %d", order.ID),
+				UserID:   actor(ctx),
+			})
+			if err != nil {
+				if errors.Is(err, ErrInsufficientStock) {
+					return &OutOfStockError{WatchID: item.WatchID}
+				}
+				return err
+			}
+
+			query = `
+			INSERT INTO order_items (order_id, watch_id, brand, model, quantity, unit_price, currency)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+			_, err = tx.ExecContext(ctx, query, order.ID, item.WatchID, item.Brand, item.Model, item.Quantity, item.UnitPrice.Amount, item.UnitPrice.Currency)
+			if err != nil {
+				return contextError(ctx, err)
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM cart_items WHERE cart_id = $1`, cartID)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE carts SET updated_at = NOW() WHERE id = $1`, cartID)
+		return contextError(ctx, err)
+	})
+}
+
+// Get returns an order with its items.
+func (m OrderModel) Get(ctx context.Context, id int64) (*Order, error) {
+	return m.get(ctx, `WHERE id = $1`, id)
+}
+
+// GetForPaymentIntent returns the order a payment intent was created for.
+func (m OrderModel) GetForPaymentIntent(ctx context.Context, intentID string) (*Order, error) {
+	return m.get(ctx, `WHERE payment_intent_id = $1`, intentID)
+}
+
+func (m OrderModel) get(ctx context.Context, where string, arg interface{}) (*Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders ` + where
+
+	var order Order
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, arg).Scan(orderScanDest(&order)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	err = m.fillItems(ctx, &order)
+	if err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+// GetAll lists the orders matching filter a page at a time, with their items.
+func (m OrderModel) GetAll(ctx context.Context, filter OrderFilter, filters Filters) ([]*Order, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), %s
+	FROM orders
+	WHERE ($1 = 0 OR user_id = $1)
+	AND ($2 = '' OR status = $2)
+	ORDER BY %s
+	LIMIT $3 OFFSET $4`, orderColumns, orderBy(filters.sortClauses(), false))
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filter.UserID, filter.Status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	orders := []*Order{}
+
+	for rows.Next() {
+		var order Order
+
+		err := rows.Scan(append([]interface{}{&totalRecords}, orderScanDest(&order)...)...)
+		if err != nil {
+			return nil, Metadata{}, contextError(ctx, err)
+		}
+
+		orders = append(orders, &order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	err = m.fillItems(ctx, orders...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return orders, metadata, nil
+}
+
+// Transition moves order to the status to, setting its tracking number if
+// one is given, and puts its watches back in stock when it is cancelled or
+// refunded before shipping. Watches that have since gone to the trash or been
+// purged are not restocked. Cancelling it also gives back the redemption of
+// its promotion. It returns ErrEditConflict if the order changed since it was
+// read.
+func (m OrderModel) Transition(ctx context.Context, order *Order, to, trackingNumber string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		return transitionOrder(ctx, tx, order, to, trackingNumber)
+	})
+}
+
+// transitionOrder does the work of Transition inside tx.
+func transitionOrder(ctx context.Context, tx *sql.Tx, order *Order, to, trackingNumber string) error {
+	query := `
+	UPDATE orders
+	SET status = $1, tracking_number = CASE WHEN $2 = '' THEN tracking_number ELSE $2 END,
+	    updated_at = NOW(), version = version + 1
+	WHERE id = $3 AND version = $4
+	RETURNING tracking_number, updated_at, version`
+
+	err := tx.QueryRowContext(ctx, query, to, trackingNumber, order.ID, order.Version).Scan(&order.TrackingNumber, &order.UpdatedAt, &order.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	from := order.Status
+	order.Status = to
+
+	// The promotion is released before any watch is locked, in the order
+	// Create takes the locks in.
+	if to == OrderCancelled {
+		err = releasePromotion(ctx, tx, order.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !releasesStock(from, to) {
+		return nil
+	}
+
+	for _, item := range order.Items {
+		if item.WatchID == 0 {
+			continue
+		}
+
+		err = recordStockMovement(ctx, tx, &StockMovement{
+			WatchID:  item.WatchID,
+			Kind:     MovementReturn,
+			Quantity: item.Quantity,
+			Note:     fmt.Sprintf("order %d %s", order.ID, to),
+			UserID:   actor(ctx),
+		})
+		if err != nil && !errors.Is(err, ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetPaymentIntent records that a payment of order was started with the
+// payment intent intentID. It returns ErrEditConflict if the order changed
+// since it was read.
+func (m OrderModel) SetPaymentIntent(ctx context.Context, order *Order, intentID string) error {
+	query := `
+	UPDATE orders
+	SET payment_intent_id = $1, payment_status = $2, updated_at = NOW(), version = version + 1
+	WHERE id = $3 AND version = $4
+	RETURNING updated_at, version`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, intentID, PaymentProcessing, order.ID, order.Version).Scan(&order.UpdatedAt, &order.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	order.PaymentIntentID = intentID
+	order.PaymentStatus = PaymentProcessing
+
+	return nil
+}
+
+// FailPayment marks the payment intentID of order as failed, for a payment
+// that could not be captured and will never be reported to the webhook. It
+// changes nothing if the payment is no longer processing, as an event of the
+// intent got there first.
+func (m OrderModel) FailPayment(ctx context.Context, order *Order, intentID string) error {
+	query := `
+	UPDATE orders
+	SET payment_status = $1, updated_at = NOW(), version = version + 1
+	WHERE id = $2 AND payment_intent_id = $3 AND payment_status = $4
+	RETURNING updated_at, version`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, PaymentFailed, order.ID, intentID, PaymentProcessing).Scan(&order.UpdatedAt, &order.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	order.PaymentStatus = PaymentFailed
+
+	return nil
+}
+
+// ApplyPaymentEvent records the webhook event eventID of the payment of order
+// and sets its payment status, moving the order to the status to as well if
+// to is not empty and the order can move there. It returns
+// ErrDuplicatePaymentEvent, changing nothing, if the event was applied
+// before, and ErrEditConflict if the order changed since it was read.
+func (m OrderModel) ApplyPaymentEvent(ctx context.Context, order *Order, eventID, eventType, paymentStatus, to string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		query := `
+		INSERT INTO payment_events (id, order_id, type)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO NOTHING`
+
+		result, err := tx.ExecContext(ctx, query, eventID, order.ID, eventType)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrDuplicatePaymentEvent
+		}
+
+		query = `
+		UPDATE orders
+		SET payment_status = $1, updated_at = NOW(), version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING updated_at, version`
+
+		err = tx.QueryRowContext(ctx, query, paymentStatus, order.ID, order.Version).Scan(&order.UpdatedAt, &order.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return contextError(ctx, err)
+			}
+		}
+
+		order.PaymentStatus = paymentStatus
+
+		if to == "" || !CanTransition(order.Status, to) {
+			return nil
+		}
+
+		return transitionOrder(ctx, tx, order, to, "")
+	})
+}
+
+// fillItems reads the items of orders.
+func (m OrderModel) fillItems(ctx context.Context, orders ...*Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	query := `
+	SELECT order_id, COALESCE(watch_id, 0), brand, model, quantity, unit_price, currency
+	FROM order_items
+	WHERE order_id = ANY($1)
+	ORDER BY order_id, watch_id`
+
+	ids := make([]int64, len(orders))
+	byID := make(map[int64]*Order, len(orders))
+
+	for i, order := range orders {
+		ids[i] = order.ID
+		byID[order.ID] = order
+		order.Items = []*OrderItem{}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID int64
+		var item OrderItem
+
+		err := rows.Scan(&orderID, &item.WatchID, &item.Brand, &item.Model, &item.Quantity, &item.UnitPrice.Amount, &item.UnitPrice.Currency)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		item.Subtotal = Money{Amount: item.UnitPrice.Amount * int64(item.Quantity), Currency: item.UnitPrice.Currency}
+
+		order := byID[orderID]
+		order.Items = append(order.Items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return contextError(ctx, err)
+	}
+
+	return nil
+}
+
+// orderColumns are the columns of orders that orderScanDest scans.
+const orderColumns = `id, created_at, updated_at, user_id, email, status, shipping_address, tracking_number,
+	payment_status, COALESCE(payment_intent_id, ''), promotion_code, discount, currency, total, currency, version`
+
+// orderScanDest returns the destinations of orderColumns.
+func orderScanDest(order *Order) []interface{} {
+	return []interface{}{
+		&order.ID,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+		&order.UserID,
+		&order.Email,
+		&order.Status,
+		&order.ShippingAddress,
+		&order.TrackingNumber,
+		&order.PaymentStatus,
+		&order.PaymentIntentID,
+		&order.PromotionCode,
+		&order.Discount.Amount,
+		&order.Discount.Currency,
+		&order.Total.Amount,
+		&order.Total.Currency,
+		&order.Version,
+	}
+}
@@ -0,0 +1,374 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type MockOrderModel struct {
+	db *mockDB
+}
+
+func (m MockOrderModel) Create(ctx context.Context, order *Order, cartID int64, promotionCode string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.users[order.UserID]; !ok {
+		return errMockForeignKey
+	}
+
+	cart, ok := m.db.carts[cartID]
+	if !ok {
+		return ErrEmptyCart
+	}
+
+	items := []*OrderItem{}
+
+	var unavailable []int64
+
+	for _, cartItem := range cart.Items {
+		watch, ok := m.db.watches[cartItem.WatchID]
+		if !ok {
+			continue
+		}
+
+		if watch.DeletedAt != nil {
+			unavailable = append(unavailable, watch.ID)
+			continue
+		}
+
+		items = append(items, &OrderItem{
+			WatchID:   watch.ID,
+			BrandID:   watch.BrandID,
+			Brand:     watch.Brand,
+			Model:     watch.Model,
+			Quantity:  cartItem.Quantity,
+			UnitPrice: watch.Price,
+		})
+	}
+
+	if len(unavailable) > 0 {
+		sort.Slice(unavailable, func(i, j int) bool {
+			return unavailable[i] < unavailable[j]
+		})
+		return &UnavailableWatchesError{WatchIDs: unavailable}
+	}
+
+	if len(items) == 0 {
+		return ErrEmptyCart
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].WatchID < items[j].WatchID
+	})
+
+	order.Items = items
+	order.Discount = Money{}
+	order.total()
+
+	var promotion *Promotion
+
+	if promotionCode != "" {
+		var err error
+
+		promotion, err = m.db.priceOrder(order, promotionCode)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Check every watch before taking any out of stock, as the rollback of the
+	// transaction would.
+	for _, item := range items {
+		if m.db.watches[item.WatchID].StockQuantity < item.Quantity {
+			return &OutOfStockError{WatchID: item.WatchID}
+		}
+	}
+
+	m.db.lastOrderID++
+
+	now := time.Now().Truncate(time.Second)
+
+	order.ID = m.db.lastOrderID
+	order.CreatedAt = now
+	order.UpdatedAt = now
+	order.Status = OrderPending
+	order.PaymentStatus = PaymentUnpaid
+	order.Version = 1
+
+	if promotion != nil {
+		m.db.redeemPromotion(promotion, order)
+	}
+
+	for _, item := range items {
+		err := m.db.recordStockMovement(&StockMovement{
+			WatchID:  item.WatchID,
+			Kind:     MovementSale,
+			Quantity: -item.Quantity,
+			Note:     fmt.Sprintf("order %d", order.ID),
+			UserID:   actor(ctx),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cart.Items = nil
+
+	m.db.orders[order.ID] = copyOrder(order)
+
+	return nil
+}
+
+func (m MockOrderModel) Get(ctx context.Context, id int64) (*Order, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.orders[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	return copyOrder(stored), nil
+}
+
+func (m MockOrderModel) GetForPaymentIntent(ctx context.Context, intentID string) (*Order, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for _, stored := range m.db.orders {
+		if stored.PaymentIntentID != "" && stored.PaymentIntentID == intentID {
+			return copyOrder(stored), nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m MockOrderModel) GetAll(ctx context.Context, filter OrderFilter, filters Filters) ([]*Order, Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	matched := []*Order{}
+
+	for _, stored := range m.db.orders {
+		if filter.UserID != 0 && stored.UserID != filter.UserID {
+			continue
+		}
+		if filter.Status != "" && stored.Status != filter.Status {
+			continue
+		}
+		matched = append(matched, copyOrder(stored))
+	}
+
+	clauses := filters.sortClauses()
+
+	sort.Slice(matched, func(i, j int) bool {
+		for _, clause := range clauses {
+			var cmp int
+			switch clause.column {
+			case "created_at":
+				cmp = matched[i].CreatedAt.Compare(matched[j].CreatedAt)
+			case "total":
+				cmp = compareInt64(matched[i].Total.Amount, matched[j].Total.Amount)
+			default:
+				cmp = compareInt64(matched[i].ID, matched[j].ID)
+			}
+			if clause.descending {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+
+	totalRecords := len(matched)
+
+	start := filters.offset()
+	if start > totalRecords {
+		start = totalRecords
+	}
+	end := start + filters.limit()
+	if end > totalRecords {
+		end = totalRecords
+	}
+
+	if start == end {
+		totalRecords = 0
+	}
+
+	return matched[start:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m MockOrderModel) Transition(ctx context.Context, order *Order, to, trackingNumber string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	return m.db.transitionOrder(ctx, order, to, trackingNumber)
+}
+
+// transitionOrder is the in-memory counterpart of transitionOrder. The
+// caller holds db.mu.
+func (db *mockDB) transitionOrder(ctx context.Context, order *Order, to, trackingNumber string) error {
+	stored, ok := db.orders[order.ID]
+	if !ok || stored.Version != order.Version {
+		return ErrEditConflict
+	}
+
+	if to == OrderCancelled {
+		db.releasePromotion(order.ID)
+	}
+
+	if releasesStock(stored.Status, to) {
+		for _, item := range stored.Items {
+			if item.WatchID == 0 {
+				continue
+			}
+
+			err := db.recordStockMovement(&StockMovement{
+				WatchID:  item.WatchID,
+				Kind:     MovementReturn,
+				Quantity: item.Quantity,
+				Note:     fmt.Sprintf("order %d %s", order.ID, to),
+				UserID:   actor(ctx),
+			})
+			if err != nil && err != ErrRecordNotFound {
+				return err
+			}
+		}
+	}
+
+	stored.Status = to
+	if trackingNumber != "" {
+		stored.TrackingNumber = trackingNumber
+	}
+	stored.UpdatedAt = time.Now().Truncate(time.Second)
+	stored.Version++
+
+	*order = *copyOrder(stored)
+
+	return nil
+}
+
+func (m MockOrderModel) SetPaymentIntent(ctx context.Context, order *Order, intentID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.orders[order.ID]
+	if !ok || stored.Version != order.Version {
+		return ErrEditConflict
+	}
+
+	for _, other := range m.db.orders {
+		if other.PaymentIntentID == intentID {
+			return errMockDuplicateKey
+		}
+	}
+
+	stored.PaymentIntentID = intentID
+	stored.PaymentStatus = PaymentProcessing
+	stored.UpdatedAt = time.Now().Truncate(time.Second)
+	stored.Version++
+
+	*order = *copyOrder(stored)
+
+	return nil
+}
+
+func (m MockOrderModel) FailPayment(ctx context.Context, order *Order, intentID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.orders[order.ID]
+	if !ok || stored.PaymentIntentID != intentID || stored.PaymentStatus != PaymentProcessing {
+		return nil
+	}
+
+	stored.PaymentStatus = PaymentFailed
+	stored.UpdatedAt = time.Now().Truncate(time.Second)
+	stored.Version++
+
+	*order = *copyOrder(stored)
+
+	return nil
+}
+
+func (m MockOrderModel) ApplyPaymentEvent(ctx context.Context, order *Order, eventID, eventType, paymentStatus, to string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if m.db.paymentEvents[eventID] {
+		return ErrDuplicatePaymentEvent
+	}
+
+	stored, ok := m.db.orders[order.ID]
+	if !ok || stored.Version != order.Version {
+		return ErrEditConflict
+	}
+
+	stored.PaymentStatus = paymentStatus
+	stored.UpdatedAt = time.Now().Truncate(time.Second)
+	stored.Version++
+
+	if to != "" && CanTransition(stored.Status, to) {
+		err := m.db.transitionOrder(ctx, copyOrder(stored), to, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	m.db.paymentEvents[eventID] = true
+
+	*order = *copyOrder(stored)
+
+	return nil
+}
+
+// copyOrder returns a copy of an order and its items.
+func copyOrder(order *Order) *Order {
+	copied := *order
+	copied.Items = make([]*OrderItem, len(order.Items))
+
+	for i, item := range order.Items {
+		copiedItem := *item
+		copied.Items[i] = &copiedItem
+	}
+
+	return &copied
+}
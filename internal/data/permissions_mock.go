@@ -0,0 +1,64 @@
+package data
+
+import (
+	"context"
+)
+
+type MockPermissionModel struct {
+	db *mockDB
+}
+
+func (m MockPermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	var permissions Permissions
+
+	if _, ok := m.db.users[userID]; !ok {
+		return permissions, nil
+	}
+
+	for permissionID := range m.db.usersPermissions[userID] {
+		permissions = append(permissions, m.db.permissions[permissionID])
+	}
+
+	return permissions, nil
+}
+
+func (m MockPermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.users[userID]; !ok {
+		return errMockForeignKey
+	}
+
+	granted := m.db.usersPermissions[userID]
+	if granted == nil {
+		granted = make(map[int64]bool)
+	}
+
+	for permissionID, code := range m.db.permissions {
+		for _, c := range codes {
+			if c != code {
+				continue
+			}
+			if granted[permissionID] {
+				return errMockDuplicateKey
+			}
+			granted[permissionID] = true
+		}
+	}
+
+	m.db.usersPermissions[userID] = granted
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+// PriceChange is one entry of the price history of a watch. The first entry
+// of a watch has the price it was created with and no previous price.
+type PriceChange struct {
+	ID            int64     `json:"id"`
+	ChangedAt     time.Time `json:"changed_at"`
+	WatchID       int64     `json:"watch_id"`
+	Price         Money     `json:"price"`
+	PreviousPrice *Money    `json:"previous_price,omitempty"`
+	// UserID is the user who changed the price, zero if unknown.
+	UserID int64 `json:"user_id,omitempty"`
+}
+
+// IsDrop reports whether the change lowered the price.
+func (change *PriceChange) IsDrop() bool {
+	return change.PreviousPrice != nil && change.PreviousPrice.Currency == change.Price.Currency &&
+		change.PreviousPrice.Amount > change.Price.Amount
+}
+
+// recordPriceChange appends the price of the watch as written by tx to its
+// history, unless it is the price the history already ends with.
+func recordPriceChange(ctx context.Context, tx *sql.Tx, watchID int64) error {
+	query := `
+	INSERT INTO price_history (watch_id, price, currency, previous_price, previous_currency, user_id)
+	SELECT w.id, w.price, w.currency, last.price, last.currency, NULLIF($2, 0)
+	FROM watches w
+	LEFT JOIN LATERAL (
+		SELECT price, currency FROM price_history
+		WHERE watch_id = w.id
+		ORDER BY changed_at DESC, id DESC
+		LIMIT 1
+	) last ON true
+	WHERE w.id = $1 AND (last.price, last.currency) IS DISTINCT FROM (w.price, w.currency)`
+
+	_, err := tx.ExecContext(ctx, query, watchID, actor(ctx))
+	return contextError(ctx, err)
+}
+
+// recordInitialPrices starts the price history of freshly inserted watches.
+func recordInitialPrices(ctx context.Context, tx *sql.Tx, watchIDs []int64) error {
+	query := `
+	INSERT INTO price_history (watch_id, price, currency, user_id)
+	SELECT id, price, currency, NULLIF($2, 0) FROM watches WHERE id = ANY($1)`
+
+	_, err := tx.ExecContext(ctx, query, pq.Array(watchIDs), actor(ctx))
+	return contextError(ctx, err)
+}
+
+type PriceModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// GetAll lists the price history of one watch a page at a time.
+func (m PriceModel) GetAll(ctx context.Context, watchID int64, filters Filters) ([]*PriceChange, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, changed_at, watch_id, price, currency, previous_price, previous_currency, COALESCE(user_id, 0)
+	FROM price_history
+	WHERE watch_id = $1
+	ORDER BY %s
+	LIMIT $2 OFFSET $3`, orderBy(filters.sortClauses(), false))
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, watchID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	changes := []*PriceChange{}
+
+	for rows.Next() {
+		change, err := scanPriceChange(func(dest ...interface{}) error {
+			return rows.Scan(append([]interface{}{&totalRecords}, dest...)...)
+		})
+		if err != nil {
+			return nil, Metadata{}, contextError(ctx, err)
+		}
+
+		changes = append(changes, change)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	return changes, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// GetDrops returns, keyed by watch id, the last price change of those of the
+// watches whose price was last changed by a drop made since the given time.
+func (m PriceModel) GetDrops(ctx context.Context, watchIDs []int64, since time.Time) (map[int64]*PriceChange, error) {
+	drops := make(map[int64]*PriceChange)
+
+	if len(watchIDs) == 0 {
+		return drops, nil
+	}
+
+	query := `
+	SELECT id, changed_at, watch_id, price, currency, previous_price, previous_currency, COALESCE(user_id, 0)
+	FROM (
+		SELECT DISTINCT ON (watch_id) *
+		FROM price_history
+		WHERE watch_id = ANY($1)
+		ORDER BY watch_id, changed_at DESC, id DESC
+	) last
+	WHERE previous_currency = currency AND previous_price > price AND changed_at >= $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(watchIDs), since)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		change, err := scanPriceChange(rows.Scan)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		drops[change.WatchID] = change
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return drops, nil
+}
+
+// scanPriceChange reads a price change through scan. The previous price is
+// NULL for the first entry of a watch.
+func scanPriceChange(scan func(dest ...interface{}) error) (*PriceChange, error) {
+	var change PriceChange
+	var previousPrice sql.NullInt64
+	var previousCurrency sql.NullString
+
+	err := scan(
+		&change.ID,
+		&change.ChangedAt,
+		&change.WatchID,
+		&change.Price.Amount,
+		&change.Price.Currency,
+		&previousPrice,
+		&previousCurrency,
+		&change.UserID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if previousPrice.Valid {
+		change.PreviousPrice = &Money{Amount: previousPrice.Int64, Currency: previousCurrency.String}
+	}
+
+	return &change, nil
+}
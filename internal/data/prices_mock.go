@@ -0,0 +1,137 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type MockPriceModel struct {
+	db *mockDB
+}
+
+func (m MockPriceModel) GetAll(ctx context.Context, watchID int64, filters Filters) ([]*PriceChange, Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	matched := []*PriceChange{}
+
+	for _, stored := range m.db.priceHistory {
+		if stored.WatchID == watchID {
+			matched = append(matched, copyPriceChange(stored))
+		}
+	}
+
+	clauses := filters.sortClauses()
+
+	sort.Slice(matched, func(i, j int) bool {
+		for _, clause := range clauses {
+			var cmp int
+			switch clause.column {
+			case "changed_at":
+				cmp = matched[i].ChangedAt.Compare(matched[j].ChangedAt)
+			default:
+				cmp = compareInt64(matched[i].ID, matched[j].ID)
+			}
+			if clause.descending {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+
+	totalRecords := len(matched)
+
+	start := filters.offset()
+	if start > totalRecords {
+		start = totalRecords
+	}
+	end := start + filters.limit()
+	if end > totalRecords {
+		end = totalRecords
+	}
+
+	if start == end {
+		totalRecords = 0
+	}
+
+	return matched[start:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m MockPriceModel) GetDrops(ctx context.Context, watchIDs []int64, since time.Time) (map[int64]*PriceChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	drops := make(map[int64]*PriceChange)
+
+	for _, id := range watchIDs {
+		last := m.db.lastPriceChange(id, time.Time{})
+		if last != nil && last.IsDrop() && !last.ChangedAt.Before(since) {
+			drops[id] = copyPriceChange(last)
+		}
+	}
+
+	return drops, nil
+}
+
+// recordPriceChange is the in-memory counterpart of recordPriceChange. The
+// caller holds db.mu.
+func (db *mockDB) recordPriceChange(ctx context.Context, watchID int64) {
+	watch := db.watches[watchID]
+
+	change := &PriceChange{
+		ChangedAt: time.Now().Truncate(time.Second),
+		WatchID:   watchID,
+		Price:     watch.Price,
+		UserID:    actor(ctx),
+	}
+
+	if last := db.lastPriceChange(watchID, time.Time{}); last != nil {
+		if last.Price == watch.Price {
+			return
+		}
+		previous := last.Price
+		change.PreviousPrice = &previous
+	}
+
+	db.lastPriceChangeID++
+	change.ID = db.lastPriceChangeID
+
+	db.priceHistory = append(db.priceHistory, change)
+}
+
+// lastPriceChange returns the latest entry of the price history of a watch
+// made no later than at, or the latest of all if at is zero. The caller holds
+// db.mu.
+func (db *mockDB) lastPriceChange(watchID int64, at time.Time) *PriceChange {
+	var last *PriceChange
+
+	// Entries are appended in order, so the last one found is the latest.
+	for _, change := range db.priceHistory {
+		if change.WatchID == watchID && (at.IsZero() || !change.ChangedAt.After(at)) {
+			last = change
+		}
+	}
+
+	return last
+}
+
+func copyPriceChange(stored *PriceChange) *PriceChange {
+	change := *stored
+	if stored.PreviousPrice != nil {
+		previous := *stored.PreviousPrice
+		change.PreviousPrice = &previous
+	}
+	return &change
+}
@@ -0,0 +1,536 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"jewelry.abgdrv.com/internal/validator"
+	"regexp"
+	"time"
+)
+
+var (
+	ErrDuplicatePromotion = errors.New("duplicate promotion")
+	// ErrPromotionOverRedeemed is returned when a promotion would allow
+	// fewer redemptions than it has already had.
+	ErrPromotionOverRedeemed = errors.New("promotion redeemed more often than allowed")
+	// ErrPromotionRedeemed is returned when deleting a promotion that orders
+	// were placed with, whose redemptions have to be kept.
+	ErrPromotionRedeemed = errors.New("promotion redeemed")
+)
+
+// Kinds of promotion.
+const (
+	PromotionPercentage = "percentage"
+	PromotionFixed      = "fixed"
+)
+
+var PromotionKinds = []string{PromotionPercentage, PromotionFixed}
+
+// PromotionCodeRX is the format of promotion codes. Codes are matched
+// regardless of case.
+var PromotionCodeRX = regexp.MustCompile("^[A-Za-z0-9_-]+$")
+
+// Promotion is a discount customers get by entering its code. It takes
+// PercentOff percent or AmountOff off the watches it targets: those of
+// BrandID, the watch WatchID, or every watch when neither is set.
+type Promotion struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Code        string    `json:"code"`
+	Description string    `json:"description,omitempty"`
+	Kind        string    `json:"kind"`
+	PercentOff  int32     `json:"percent_off,omitempty"`
+	AmountOff   Money     `json:"amount_off"`
+	// MinOrder is the least the watches of an order, discounted or not, have
+	// to add up to.
+	MinOrder Money `json:"min_order"`
+	BrandID  int64 `json:"brand_id,omitempty"`
+	WatchID  int64 `json:"watch_id,omitempty"`
+	// MaxRedemptions and MaxRedemptionsPerUser are unlimited at zero.
+	MaxRedemptions        int32 `json:"max_redemptions"`
+	MaxRedemptionsPerUser int32 `json:"max_redemptions_per_user"`
+	// RedemptionCount is the number of orders placed with the promotion that
+	// were not cancelled. It is only changed through the order model.
+	RedemptionCount int32      `json:"redemption_count"`
+	StartsAt        *time.Time `json:"starts_at,omitempty"`
+	EndsAt          *time.Time `json:"ends_at,omitempty"`
+	Active          bool       `json:"active"`
+	Version         int32      `json:"version"`
+}
+
+func ValidatePromotion(v *validator.Validator, promotion *Promotion) {
+	v.Check(promotion.Code != "", "code", "must be provided")
+	v.Check(len(promotion.Code) <= 50, "code", "must not be more than 50 bytes long")
+	v.Check(validator.Matches(promotion.Code, PromotionCodeRX), "code", "must only contain letters, digits, dashes and underscores")
+
+	v.Check(len(promotion.Description) <= 1000, "description", "must not be more than 1000 bytes long")
+
+	v.Check(validator.In(promotion.Kind, PromotionKinds...), "kind", "must be one of percentage or fixed")
+
+	switch promotion.Kind {
+	case PromotionPercentage:
+		v.Check(promotion.PercentOff >= 1 && promotion.PercentOff <= 100, "percent_off", "must be between 1 and 100")
+		v.Check(promotion.AmountOff.Amount == 0, "amount_off", "must not be set for a percentage promotion")
+	case PromotionFixed:
+		v.Check(promotion.AmountOff.Amount > 0, "amount_off", "must be greater than zero")
+		v.Check(promotion.PercentOff == 0, "percent_off", "must not be set for a fixed promotion")
+	}
+
+	v.Check(promotion.AmountOff.Currency == CatalogCurrency, "amount_off", "must be in "+CatalogCurrency)
+	v.Check(promotion.MinOrder.Amount >= 0, "min_order", "must not be negative")
+	v.Check(promotion.MinOrder.Currency == CatalogCurrency, "min_order", "must be in "+CatalogCurrency)
+
+	v.Check(promotion.BrandID >= 0, "brand_id", "must be a positive integer")
+	v.Check(promotion.WatchID >= 0, "watch_id", "must be a positive integer")
+	v.Check(promotion.BrandID == 0 || promotion.WatchID == 0, "watch_id", "cannot be used together with brand_id")
+
+	v.Check(promotion.MaxRedemptions >= 0, "max_redemptions", "must not be negative")
+	v.Check(promotion.MaxRedemptionsPerUser >= 0, "max_redemptions_per_user", "must not be negative")
+
+	if promotion.StartsAt != nil && promotion.EndsAt != nil {
+		v.Check(promotion.EndsAt.After(*promotion.StartsAt), "ends_at", "must be after starts_at")
+	}
+}
+
+// PricedLine is a line of a cart or an order as a promotion sees it.
+type PricedLine struct {
+	WatchID  int64
+	BrandID  int64
+	Subtotal Money
+}
+
+// Discount is what a promotion takes off a cart or an order, and why.
+type Discount struct {
+	Code        string `json:"code"`
+	Description string `json:"description,omitempty"`
+	// Explanation says in words what the discount was worked out from.
+	Explanation string `json:"explanation"`
+	Amount      Money  `json:"amount"`
+	// WatchIDs are the watches the discount was taken off.
+	WatchIDs []int64 `json:"watch_ids"`
+}
+
+// PromotionError explains why a promotion does not apply to a cart or an
+// order.
+type PromotionError struct {
+	Reason string
+}
+
+func (e *PromotionError) Error() string {
+	return "promotion " + e.Reason
+}
+
+// Price works out the discount the promotion gives on lines at the time now,
+// for a customer who redeemed it used times before. It returns a
+// *PromotionError if the promotion does not apply.
+func (promotion *Promotion) Price(lines []PricedLine, used int32, now time.Time) (*Discount, error) {
+	switch {
+	case !promotion.Active:
+		return nil, &PromotionError{Reason: "is not active"}
+	case promotion.StartsAt != nil && now.Before(*promotion.StartsAt):
+		return nil, &PromotionError{Reason: "is not valid yet"}
+	case promotion.EndsAt != nil && !now.Before(*promotion.EndsAt):
+		return nil, &PromotionError{Reason: "has expired"}
+	case promotion.MaxRedemptions > 0 && promotion.RedemptionCount >= promotion.MaxRedemptions:
+		return nil, &PromotionError{Reason: "has been fully redeemed"}
+	case promotion.MaxRedemptionsPerUser > 0 && used >= promotion.MaxRedemptionsPerUser:
+		return nil, &PromotionError{Reason: "has already been used the maximum number of times"}
+	}
+
+	discount := &Discount{
+		Code:        promotion.Code,
+		Description: promotion.Description,
+		Amount:      Money{Currency: CatalogCurrency},
+		WatchIDs:    []int64{},
+	}
+
+	var total, eligible int64
+
+	for _, line := range lines {
+		total += line.Subtotal.Amount
+
+		if promotion.targets(line) {
+			eligible += line.Subtotal.Amount
+			discount.WatchIDs = append(discount.WatchIDs, line.WatchID)
+		}
+	}
+
+	if len(discount.WatchIDs) == 0 {
+		return nil, &PromotionError{Reason: "does not apply to any of the watches"}
+	}
+
+	if total < promotion.MinOrder.Amount {
+		return nil, &PromotionError{Reason: fmt.Sprintf("requires an order of at least %s", promotion.MinOrder)}
+	}
+
+	scope := "the order"
+	if promotion.BrandID != 0 || promotion.WatchID != 0 {
+		scope = "the eligible watches"
+	}
+
+	switch promotion.Kind {
+	case PromotionPercentage:
+		// Adding 50 before dividing rounds to the nearest minor unit.
+		discount.Amount.Amount = (eligible*int64(promotion.PercentOff) + 50) / 100
+		discount.Explanation = fmt.Sprintf("%d%% off %s", promotion.PercentOff, scope)
+	case PromotionFixed:
+		discount.Amount.Amount = min(promotion.AmountOff.Amount, eligible)
+		discount.Explanation = fmt.Sprintf("%s off %s", promotion.AmountOff, scope)
+	}
+
+	return discount, nil
+}
+
+// targets reports whether the promotion applies to the watch of line.
+func (promotion *Promotion) targets(line PricedLine) bool {
+	switch {
+	case promotion.WatchID != 0:
+		return line.WatchID == promotion.WatchID
+	case promotion.BrandID != 0:
+		return line.BrandID == promotion.BrandID
+	}
+	return true
+}
+
+// PromotionFilter narrows a listing of promotions. Zero fields match every
+// promotion.
+type PromotionFilter struct {
+	// Code matches the promotions whose code contains it, ignoring case.
+	Code string
+}
+
+const promotionColumns = `id, created_at, updated_at, code, description, kind, percent_off, amount_off,
+	min_order, currency, COALESCE(brand_id, 0), COALESCE(watch_id, 0), max_redemptions,
+	max_redemptions_per_user, redemption_count, starts_at, ends_at, active, version`
+
+// scanDest returns the destinations of promotionColumns. The currency is
+// scanned into AmountOff, and setCurrency copies it to MinOrder afterwards.
+func (promotion *Promotion) scanDest() []interface{} {
+	return []interface{}{
+		&promotion.ID,
+		&promotion.CreatedAt,
+		&promotion.UpdatedAt,
+		&promotion.Code,
+		&promotion.Description,
+		&promotion.Kind,
+		&promotion.PercentOff,
+		&promotion.AmountOff.Amount,
+		&promotion.MinOrder.Amount,
+		&promotion.AmountOff.Currency,
+		&promotion.BrandID,
+		&promotion.WatchID,
+		&promotion.MaxRedemptions,
+		&promotion.MaxRedemptionsPerUser,
+		&promotion.RedemptionCount,
+		&promotion.StartsAt,
+		&promotion.EndsAt,
+		&promotion.Active,
+		&promotion.Version,
+	}
+}
+
+// setCurrency copies the currency scanned into AmountOff to MinOrder.
+func (promotion *Promotion) setCurrency() {
+	promotion.MinOrder.Currency = promotion.AmountOff.Currency
+}
+
+type PromotionModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+func (m PromotionModel) Insert(ctx context.Context, promotion *Promotion) error {
+	query := `
+	INSERT INTO promotions (code, description, kind, percent_off, amount_off, min_order, currency, brand_id,
+	                        watch_id, max_redemptions, max_redemptions_per_user, starts_at, ends_at, active)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), NULLIF($9, 0), $10, $11, $12, $13, $14)
+	RETURNING id, created_at, updated_at, redemption_count, version`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, promotion.args()...).Scan(
+		&promotion.ID,
+		&promotion.CreatedAt,
+		&promotion.UpdatedAt,
+		&promotion.RedemptionCount,
+		&promotion.Version,
+	)
+	if err != nil {
+		return promotionError(ctx, err)
+	}
+	return nil
+}
+
+func (m PromotionModel) Get(ctx context.Context, id int64) (*Promotion, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	return m.getWhere(ctx, "id = $1", id)
+}
+
+// GetByCode finds a promotion by code, ignoring case.
+func (m PromotionModel) GetByCode(ctx context.Context, code string) (*Promotion, error) {
+	return m.getWhere(ctx, "code = $1", code)
+}
+
+func (m PromotionModel) getWhere(ctx context.Context, condition string, arg interface{}) (*Promotion, error) {
+	query := `SELECT ` + promotionColumns + ` FROM promotions WHERE ` + condition
+
+	var promotion Promotion
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, arg).Scan(promotion.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	promotion.setCurrency()
+
+	return &promotion, nil
+}
+
+func (m PromotionModel) GetAll(ctx context.Context, filter PromotionFilter, filters Filters) ([]*Promotion, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), %s
+	FROM promotions
+	WHERE (strpos(lower(code), lower($1)) > 0 OR $1 = '')
+	ORDER BY %s
+	LIMIT $2 OFFSET $3`, promotionColumns, orderBy(filters.sortClauses(), false))
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filter.Code, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	promotions := []*Promotion{}
+
+	for rows.Next() {
+		var promotion Promotion
+
+		err := rows.Scan(append([]interface{}{&totalRecords}, promotion.scanDest()...)...)
+		if err != nil {
+			return nil, Metadata{}, contextError(ctx, err)
+		}
+
+		promotion.setCurrency()
+		promotions = append(promotions, &promotion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	return promotions, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Update writes every field of the promotion but its redemption count. It
+// returns ErrEditConflict if the promotion changed since it was read, and
+// ErrPromotionOverRedeemed if MaxRedemptions is below the redemption count.
+func (m PromotionModel) Update(ctx context.Context, promotion *Promotion) error {
+	query := `
+	UPDATE promotions
+	SET code = $1, description = $2, kind = $3, percent_off = $4, amount_off = $5, min_order = $6,
+	    currency = $7, brand_id = NULLIF($8, 0), watch_id = NULLIF($9, 0), max_redemptions = $10,
+	    max_redemptions_per_user = $11, starts_at = $12, ends_at = $13, active = $14,
+	    updated_at = NOW(), version = version + 1
+	WHERE id = $15 AND version = $16
+	RETURNING updated_at, redemption_count, version`
+
+	args := append(promotion.args(), promotion.ID, promotion.Version)
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&promotion.UpdatedAt, &promotion.RedemptionCount, &promotion.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return promotionError(ctx, err)
+		}
+	}
+	return nil
+}
+
+// Delete deletes a promotion. It returns ErrPromotionRedeemed if orders that
+// were not cancelled were placed with it, in which case it can only be
+// deactivated.
+func (m PromotionModel) Delete(ctx context.Context, id int64) error {
+	return m.execOne(ctx, `DELETE FROM promotions WHERE id = $1`, id)
+}
+
+// Deactivate stops a promotion from applying to new carts and orders.
+func (m PromotionModel) Deactivate(ctx context.Context, id int64) error {
+	query := `
+	UPDATE promotions
+	SET active = false, updated_at = NOW(), version = version + 1
+	WHERE id = $1`
+
+	return m.execOne(ctx, query, id)
+}
+
+// execOne runs a statement on the promotion with the given id, returning
+// ErrRecordNotFound if no row was affected.
+func (m PromotionModel) execOne(ctx context.Context, query string, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return promotionError(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// CountRedemptions returns the number of orders a user placed with a
+// promotion that were not cancelled.
+func (m PromotionModel) CountRedemptions(ctx context.Context, promotionID, userID int64) (int32, error) {
+	query := `SELECT count(*) FROM promotion_redemptions WHERE promotion_id = $1 AND user_id = $2`
+
+	var count int32
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, promotionID, userID).Scan(&count)
+	return count, contextError(ctx, err)
+}
+
+// args returns the values of the columns written by Insert and Update.
+func (promotion *Promotion) args() []interface{} {
+	return []interface{}{
+		promotion.Code,
+		promotion.Description,
+		promotion.Kind,
+		promotion.PercentOff,
+		promotion.AmountOff.Amount,
+		promotion.MinOrder.Amount,
+		promotion.AmountOff.Currency,
+		promotion.BrandID,
+		promotion.WatchID,
+		promotion.MaxRedemptions,
+		promotion.MaxRedemptionsPerUser,
+		promotion.StartsAt,
+		promotion.EndsAt,
+		promotion.Active,
+	}
+}
+
+// priceOrder applies the promotion with the given code to order inside tx,
+// for the order's user. The row of the promotion stays locked until tx ends,
+// so orders placed with it at the same time are priced one after the other
+// and a limited promotion cannot be redeemed more often than allowed. It
+// returns a *PromotionError if there is no such promotion or it does not
+// apply.
+func priceOrder(ctx context.Context, tx *sql.Tx, order *Order, code string) (*Promotion, error) {
+	query := `SELECT ` + promotionColumns + ` FROM promotions WHERE code = $1 FOR UPDATE`
+
+	var promotion Promotion
+
+	err := tx.QueryRowContext(ctx, query, code).Scan(promotion.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, &PromotionError{Reason: "does not exist"}
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	promotion.setCurrency()
+
+	var used int32
+
+	query = `SELECT count(*) FROM promotion_redemptions WHERE promotion_id = $1 AND user_id = $2`
+
+	err = tx.QueryRowContext(ctx, query, promotion.ID, order.UserID).Scan(&used)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	discount, err := promotion.Price(order.pricedLines(), used, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	order.PromotionCode = promotion.Code
+	order.Discount = discount.Amount
+	order.total()
+
+	return &promotion, nil
+}
+
+// redeemPromotion records that order was placed with promotion, which tx
+// holds the lock of.
+func redeemPromotion(ctx context.Context, tx *sql.Tx, promotion *Promotion, order *Order) error {
+	query := `
+	INSERT INTO promotion_redemptions (order_id, promotion_id, user_id, discount)
+	VALUES ($1, $2, $3, $4)`
+
+	_, err := tx.ExecContext(ctx, query, order.ID, promotion.ID, order.UserID, order.Discount.Amount)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE promotions SET redemption_count = redemption_count + 1 WHERE id = $1`, promotion.ID)
+	return contextError(ctx, err)
+}
+
+// releasePromotion gives back the redemption of the promotion an order was
+// placed with, if any, so that it can be used again.
+func releasePromotion(ctx context.Context, tx *sql.Tx, orderID int64) error {
+	query := `
+	WITH redemption AS (
+		DELETE FROM promotion_redemptions WHERE order_id = $1 RETURNING promotion_id
+	)
+	UPDATE promotions
+	SET redemption_count = redemption_count - 1
+	FROM redemption
+	WHERE promotions.id = redemption.promotion_id`
+
+	_, err := tx.ExecContext(ctx, query, orderID)
+	return contextError(ctx, err)
+}
+
+func promotionError(ctx context.Context, err error) error {
+	switch err.Error() {
+	case `pq: duplicate key value violates unique constraint "promotions_code_key"`:
+		return ErrDuplicatePromotion
+	case `pq: new row for relation "promotions" violates check constraint "promotions_redemption_count_check"`:
+		return ErrPromotionOverRedeemed
+	case `pq: update or delete on table "promotions" violates foreign key constraint "promotion_redemptions_promotion_id_fkey" on table "promotion_redemptions"`:
+		return ErrPromotionRedeemed
+	}
+	return contextError(ctx, err)
+}
@@ -0,0 +1,326 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mockRedemption is a row of promotion_redemptions.
+type mockRedemption struct {
+	OrderID     int64
+	PromotionID int64
+	UserID      int64
+	Discount    int64
+}
+
+type MockPromotionModel struct {
+	db *mockDB
+}
+
+func (m MockPromotionModel) Insert(ctx context.Context, promotion *Promotion) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if err := m.db.checkPromotion(promotion); err != nil {
+		return err
+	}
+
+	m.db.lastPromotionID++
+
+	now := time.Now().Truncate(time.Second)
+
+	promotion.ID = m.db.lastPromotionID
+	promotion.CreatedAt = now
+	promotion.UpdatedAt = now
+	promotion.RedemptionCount = 0
+	promotion.Version = 1
+
+	stored := *promotion
+	m.db.promotions[promotion.ID] = &stored
+
+	return nil
+}
+
+func (m MockPromotionModel) Get(ctx context.Context, id int64) (*Promotion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.promotions[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	promotion := *stored
+	return &promotion, nil
+}
+
+func (m MockPromotionModel) GetByCode(ctx context.Context, code string) (*Promotion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored := m.db.promotionByCode(code)
+	if stored == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	promotion := *stored
+	return &promotion, nil
+}
+
+func (m MockPromotionModel) GetAll(ctx context.Context, filter PromotionFilter, filters Filters) ([]*Promotion, Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	matched := []*Promotion{}
+
+	for _, stored := range m.db.promotions {
+		if strings.Contains(strings.ToLower(stored.Code), strings.ToLower(filter.Code)) {
+			promotion := *stored
+			matched = append(matched, &promotion)
+		}
+	}
+
+	clauses := filters.sortClauses()
+
+	sort.Slice(matched, func(i, j int) bool {
+		for _, clause := range clauses {
+			var cmp int
+			switch clause.column {
+			case "code":
+				cmp = strings.Compare(strings.ToLower(matched[i].Code), strings.ToLower(matched[j].Code))
+			case "created_at":
+				cmp = matched[i].CreatedAt.Compare(matched[j].CreatedAt)
+			case "redemption_count":
+				cmp = compareInt64(int64(matched[i].RedemptionCount), int64(matched[j].RedemptionCount))
+			default:
+				cmp = compareInt64(matched[i].ID, matched[j].ID)
+			}
+			if clause.descending {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+
+	totalRecords := len(matched)
+
+	start := filters.offset()
+	if start > totalRecords {
+		start = totalRecords
+	}
+	end := start + filters.limit()
+	if end > totalRecords {
+		end = totalRecords
+	}
+
+	if start == end {
+		totalRecords = 0
+	}
+
+	return matched[start:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m MockPromotionModel) Update(ctx context.Context, promotion *Promotion) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.promotions[promotion.ID]
+	if !ok || stored.Version != promotion.Version {
+		return ErrEditConflict
+	}
+
+	if err := m.db.checkPromotion(promotion); err != nil {
+		return err
+	}
+
+	if promotion.MaxRedemptions > 0 && stored.RedemptionCount > promotion.MaxRedemptions {
+		return ErrPromotionOverRedeemed
+	}
+
+	updated := *promotion
+	updated.CreatedAt = stored.CreatedAt
+	updated.UpdatedAt = time.Now().Truncate(time.Second)
+	updated.RedemptionCount = stored.RedemptionCount
+	updated.Version++
+
+	*stored = updated
+	*promotion = updated
+
+	return nil
+}
+
+func (m MockPromotionModel) Delete(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.promotions[id]; !ok {
+		return ErrRecordNotFound
+	}
+
+	for _, redemption := range m.db.promotionRedemptions {
+		if redemption.PromotionID == id {
+			return ErrPromotionRedeemed
+		}
+	}
+
+	delete(m.db.promotions, id)
+
+	return nil
+}
+
+func (m MockPromotionModel) Deactivate(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.promotions[id]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	stored.Active = false
+	stored.UpdatedAt = time.Now().Truncate(time.Second)
+	stored.Version++
+
+	return nil
+}
+
+func (m MockPromotionModel) CountRedemptions(ctx context.Context, promotionID, userID int64) (int32, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	return m.db.countRedemptions(promotionID, userID), nil
+}
+
+// checkPromotion mimics the unique code and the foreign keys of promotions.
+// The caller holds db.mu.
+func (db *mockDB) checkPromotion(promotion *Promotion) error {
+	if other := db.promotionByCode(promotion.Code); other != nil && other.ID != promotion.ID {
+		return ErrDuplicatePromotion
+	}
+
+	if _, ok := db.brands[promotion.BrandID]; promotion.BrandID != 0 && !ok {
+		return errMockForeignKey
+	}
+	if _, ok := db.watches[promotion.WatchID]; promotion.WatchID != 0 && !ok {
+		return errMockForeignKey
+	}
+
+	return nil
+}
+
+// promotionByCode returns the stored promotion with the code, ignoring case
+// as citext does. The caller holds db.mu.
+func (db *mockDB) promotionByCode(code string) *Promotion {
+	for _, stored := range db.promotions {
+		if strings.EqualFold(stored.Code, code) {
+			return stored
+		}
+	}
+	return nil
+}
+
+func (db *mockDB) countRedemptions(promotionID, userID int64) int32 {
+	var count int32
+	for _, redemption := range db.promotionRedemptions {
+		if redemption.PromotionID == promotionID && redemption.UserID == userID {
+			count++
+		}
+	}
+	return count
+}
+
+// promoted reports whether a promotion matching fn exists, which keeps its
+// brand or watch from being deleted. The caller holds db.mu.
+func (db *mockDB) promoted(fn func(promotion *Promotion) bool) bool {
+	for _, promotion := range db.promotions {
+		if fn(promotion) {
+			return true
+		}
+	}
+	return false
+}
+
+// priceOrder is the in-memory counterpart of priceOrder. The caller holds
+// db.mu, which serializes it the way the row lock does.
+func (db *mockDB) priceOrder(order *Order, code string) (*Promotion, error) {
+	promotion := db.promotionByCode(code)
+	if promotion == nil {
+		return nil, &PromotionError{Reason: "does not exist"}
+	}
+
+	discount, err := promotion.Price(order.pricedLines(), db.countRedemptions(promotion.ID, order.UserID), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	order.PromotionCode = promotion.Code
+	order.Discount = discount.Amount
+	order.total()
+
+	return promotion, nil
+}
+
+// redeemPromotion is the in-memory counterpart of redeemPromotion. The
+// caller holds db.mu.
+func (db *mockDB) redeemPromotion(promotion *Promotion, order *Order) {
+	db.promotionRedemptions = append(db.promotionRedemptions, &mockRedemption{
+		OrderID:     order.ID,
+		PromotionID: promotion.ID,
+		UserID:      order.UserID,
+		Discount:    order.Discount.Amount,
+	})
+	promotion.RedemptionCount++
+}
+
+// releasePromotion is the in-memory counterpart of releasePromotion. The
+// caller holds db.mu.
+func (db *mockDB) releasePromotion(orderID int64) {
+	redemptions := db.promotionRedemptions[:0]
+	for _, redemption := range db.promotionRedemptions {
+		if redemption.OrderID != orderID {
+			redemptions = append(redemptions, redemption)
+			continue
+		}
+		if promotion, ok := db.promotions[redemption.PromotionID]; ok {
+			promotion.RedemptionCount--
+		}
+	}
+	db.promotionRedemptions = redemptions
+}
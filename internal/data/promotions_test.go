@@ -0,0 +1,176 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPromotionPrice(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	earlier := now.Add(-time.Hour)
+	later := now.Add(time.Hour)
+
+	usd := func(amount int64) Money {
+		return Money{Amount: amount, Currency: CatalogCurrency}
+	}
+
+	// Two watches of brand 1 and one of brand 2, 600.00 USD in all.
+	lines := []PricedLine{
+		{WatchID: 10, BrandID: 1, Subtotal: usd(10000)},
+		{WatchID: 11, BrandID: 1, Subtotal: usd(20000)},
+		{WatchID: 20, BrandID: 2, Subtotal: usd(30000)},
+	}
+
+	percent := func(off int32) Promotion {
+		return Promotion{Code: "SAVE", Kind: PromotionPercentage, PercentOff: off, Active: true}
+	}
+	fixed := func(off int64) Promotion {
+		return Promotion{Code: "SAVE", Kind: PromotionFixed, AmountOff: usd(off), Active: true}
+	}
+	with := func(promotion Promotion, fn func(promotion *Promotion)) Promotion {
+		fn(&promotion)
+		return promotion
+	}
+
+	tests := []struct {
+		name      string
+		promotion Promotion
+		lines     []PricedLine
+		used      int32
+		want      int64
+		wantIDs   []int64
+		wantErr   string
+	}{
+		{
+			name:      "percentage of the order",
+			promotion: percent(10),
+			want:      6000,
+			wantIDs:   []int64{10, 11, 20},
+		},
+		{
+			name:      "percentage rounds to the nearest cent",
+			promotion: percent(15),
+			lines:     []PricedLine{{WatchID: 10, Subtotal: usd(3333)}},
+			want:      500,
+			wantIDs:   []int64{10},
+		},
+		{
+			name:      "percentage of a brand",
+			promotion: with(percent(50), func(p *Promotion) { p.BrandID = 1 }),
+			want:      15000,
+			wantIDs:   []int64{10, 11},
+		},
+		{
+			name:      "percentage of a watch",
+			promotion: with(percent(100), func(p *Promotion) { p.WatchID = 20 }),
+			want:      30000,
+			wantIDs:   []int64{20},
+		},
+		{
+			name:      "fixed amount",
+			promotion: fixed(2500),
+			want:      2500,
+			wantIDs:   []int64{10, 11, 20},
+		},
+		{
+			name:      "fixed amount capped at the eligible watches",
+			promotion: with(fixed(50000), func(p *Promotion) { p.WatchID = 10 }),
+			want:      10000,
+			wantIDs:   []int64{10},
+		},
+		{
+			name:      "minimum order counts every watch",
+			promotion: with(fixed(1000), func(p *Promotion) { p.BrandID = 2; p.MinOrder = usd(60000) }),
+			want:      1000,
+			wantIDs:   []int64{20},
+		},
+		{
+			name:      "below the minimum order",
+			promotion: with(fixed(1000), func(p *Promotion) { p.MinOrder = usd(60001) }),
+			wantErr:   "requires an order of at least 600.01 USD",
+		},
+		{
+			name:      "no eligible watch",
+			promotion: with(percent(10), func(p *Promotion) { p.BrandID = 3 }),
+			wantErr:   "does not apply to any of the watches",
+		},
+		{
+			name:      "empty cart",
+			promotion: percent(10),
+			lines:     []PricedLine{},
+			wantErr:   "does not apply to any of the watches",
+		},
+		{
+			name:      "inactive",
+			promotion: with(percent(10), func(p *Promotion) { p.Active = false }),
+			wantErr:   "is not active",
+		},
+		{
+			name:      "not started",
+			promotion: with(percent(10), func(p *Promotion) { p.StartsAt = &later }),
+			wantErr:   "is not valid yet",
+		},
+		{
+			name:      "started now",
+			promotion: with(percent(10), func(p *Promotion) { p.StartsAt = &now }),
+			want:      6000,
+			wantIDs:   []int64{10, 11, 20},
+		},
+		{
+			name:      "ended",
+			promotion: with(percent(10), func(p *Promotion) { p.StartsAt = &earlier; p.EndsAt = &now }),
+			wantErr:   "has expired",
+		},
+		{
+			name:      "fully redeemed",
+			promotion: with(percent(10), func(p *Promotion) { p.MaxRedemptions = 5; p.RedemptionCount = 5 }),
+			wantErr:   "has been fully redeemed",
+		},
+		{
+			name:      "redemptions left",
+			promotion: with(percent(10), func(p *Promotion) { p.MaxRedemptions = 5; p.RedemptionCount = 4 }),
+			want:      6000,
+			wantIDs:   []int64{10, 11, 20},
+		},
+		{
+			name:      "used up by the customer",
+			promotion: with(percent(10), func(p *Promotion) { p.MaxRedemptionsPerUser = 2 }),
+			used:      2,
+			wantErr:   "has already been used the maximum number of times",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.lines == nil {
+				tt.lines = lines
+			}
+
+			discount, err := tt.promotion.Price(tt.lines, tt.used, now)
+
+			if tt.wantErr != "" {
+				var promotionErr *PromotionError
+				if !errors.As(err, &promotionErr) {
+					t.Fatalf("err = %v; want a *PromotionError", err)
+				}
+				if promotionErr.Reason != tt.wantErr {
+					t.Errorf("reason = %q; want %q", promotionErr.Reason, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if discount.Amount != usd(tt.want) {
+				t.Errorf("amount = %s; want %s", discount.Amount, usd(tt.want))
+			}
+			if !reflect.DeepEqual(discount.WatchIDs, tt.wantIDs) {
+				t.Errorf("watch ids = %v; want %v", discount.WatchIDs, tt.wantIDs)
+			}
+		})
+	}
+}
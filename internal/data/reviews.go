@@ -0,0 +1,308 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"jewelry.abgdrv.com/internal/validator"
+	"time"
+)
+
+var (
+	ErrDuplicateReview = errors.New("duplicate review")
+)
+
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+var ReviewStatuses = []string{ReviewPending, ReviewApproved, ReviewRejected}
+
+// Review is the review of a watch by a user, who may write only one per
+// watch. Reviews are published once a moderator approves them, and only
+// approved reviews count towards the rating of the watch.
+type Review struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	WatchID   int64     `json:"watch_id"`
+	UserID    int64     `json:"user_id"`
+	// Author is the name of the user, read from the users table.
+	Author  string `json:"author"`
+	Rating  int8   `json:"rating"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	Status  string `json:"status"`
+	Version int32  `json:"version"`
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Rating >= 1 && review.Rating <= 5, "rating", "must be between 1 and 5")
+
+	v.Check(review.Title != "", "title", "must be provided")
+	v.Check(len(review.Title) <= 200, "title", "must not be more than 200 bytes long")
+
+	v.Check(review.Body != "", "body", "must be provided")
+	v.Check(len(review.Body) <= 5000, "body", "must not be more than 5000 bytes long")
+}
+
+func ValidateReviewStatus(v *validator.Validator, status string) {
+	v.Check(status != "", "status", "must be provided")
+	v.Check(validator.In(status, ReviewStatuses...), "status", "must be one of pending, approved or rejected")
+}
+
+// ReviewFilter narrows a list of reviews. Zero values match everything.
+type ReviewFilter struct {
+	WatchID int64
+	Status  string
+}
+
+const reviewColumns = `reviews.id, reviews.created_at, reviews.updated_at, reviews.watch_id, reviews.user_id,
+	users.name, reviews.rating, reviews.title, reviews.body, reviews.status, reviews.version`
+
+func (review *Review) scanDest() []interface{} {
+	return []interface{}{
+		&review.ID,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.WatchID,
+		&review.UserID,
+		&review.Author,
+		&review.Rating,
+		&review.Title,
+		&review.Body,
+		&review.Status,
+		&review.Version,
+	}
+}
+
+type ReviewModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// Insert adds the review to a watch that is not in the trash. It returns
+// ErrDuplicateReview if the user already reviewed the watch.
+func (m ReviewModel) Insert(ctx context.Context, review *Review) error {
+	query := `
+	INSERT INTO reviews (watch_id, user_id, rating, title, body, status)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at, updated_at, version,
+	          (SELECT name FROM users WHERE id = $2)`
+
+	args := []interface{}{
+		review.WatchID,
+		review.UserID,
+		review.Rating,
+		review.Title,
+		review.Body,
+		review.Status,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		err := lockWatch(ctx, tx, review.WatchID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt, &review.Version, &review.Author)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "reviews_watch_id_user_id_key"`:
+				return ErrDuplicateReview
+			default:
+				return contextError(ctx, err)
+			}
+		}
+
+		return refreshWatchRating(ctx, tx, review.WatchID)
+	})
+}
+
+func (m ReviewModel) Get(ctx context.Context, watchID, id int64) (*Review, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `SELECT ` + reviewColumns + `
+	FROM reviews
+	INNER JOIN users ON users.id = reviews.user_id
+	WHERE reviews.id = $1 AND reviews.watch_id = $2`
+
+	var review Review
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, watchID).Scan(review.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return &review, nil
+}
+
+func (m ReviewModel) GetAll(ctx context.Context, filter ReviewFilter, filters Filters) ([]*Review, Metadata, error) {
+	clauses := filters.sortClauses()
+	for i := range clauses {
+		clauses[i].expr = "reviews." + clauses[i].column
+	}
+
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), %s
+	FROM reviews
+	INNER JOIN users ON users.id = reviews.user_id
+	WHERE ($1 = 0 OR reviews.watch_id = $1)
+	AND ($2 = '' OR reviews.status = $2)
+	ORDER BY %s
+	LIMIT $3 OFFSET $4`, reviewColumns, orderBy(clauses, false))
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filter.WatchID, filter.Status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+
+		err := rows.Scan(append([]interface{}{&totalRecords}, review.scanDest()...)...)
+		if err != nil {
+			return nil, Metadata{}, contextError(ctx, err)
+		}
+
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	return reviews, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Update writes the rating, title, body and status of the review. It returns
+// ErrEditConflict if the review changed since it was read.
+func (m ReviewModel) Update(ctx context.Context, review *Review) error {
+	query := `
+	UPDATE reviews
+	SET rating = $1, title = $2, body = $3, status = $4, updated_at = NOW(), version = version + 1
+	WHERE id = $5 AND watch_id = $6 AND version = $7
+	RETURNING updated_at, version`
+
+	args := []interface{}{
+		review.Rating,
+		review.Title,
+		review.Body,
+		review.Status,
+		review.ID,
+		review.WatchID,
+		review.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		err := lockRatedWatch(ctx, tx, review.WatchID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&review.UpdatedAt, &review.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return contextError(ctx, err)
+			}
+		}
+
+		return refreshWatchRating(ctx, tx, review.WatchID)
+	})
+}
+
+func (m ReviewModel) Delete(ctx context.Context, watchID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		err := lockRatedWatch(ctx, tx, watchID)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `DELETE FROM reviews WHERE id = $1 AND watch_id = $2`, id, watchID)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+
+		return refreshWatchRating(ctx, tx, watchID)
+	})
+}
+
+// lockRatedWatch takes the row lock of a watch, in the trash or not, for the
+// rest of tx, which serializes the refreshes of its rating. Reviews of a
+// watch in the trash can still be moderated and removed.
+func lockRatedWatch(ctx context.Context, tx *sql.Tx, watchID int64) error {
+	var id int64
+
+	err := tx.QueryRowContext(ctx, `SELECT id FROM watches WHERE id = $1 FOR UPDATE`, watchID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return contextError(ctx, err)
+		}
+	}
+	return nil
+}
+
+// refreshWatchRating recomputes watches.average_rating and review_count from
+// the approved reviews of the watch. The version is left alone, since the
+// rating is never written through an update of the watch.
+func refreshWatchRating(ctx context.Context, tx *sql.Tx, watchID int64) error {
+	query := `
+	UPDATE watches
+	SET (average_rating, review_count) = (
+		SELECT COALESCE(ROUND(AVG(rating), 2), 0), count(*)
+		FROM reviews
+		WHERE watch_id = $1 AND status = 'approved'
+	)
+	WHERE id = $1`
+
+	_, err := tx.ExecContext(ctx, query, watchID)
+	return contextError(ctx, err)
+}
@@ -0,0 +1,216 @@
+package data
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+type MockReviewModel struct {
+	db *mockDB
+}
+
+func (m MockReviewModel) Insert(ctx context.Context, review *Review) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if !m.db.liveWatch(review.WatchID) {
+		return ErrRecordNotFound
+	}
+
+	user, ok := m.db.users[review.UserID]
+	if !ok {
+		return errMockForeignKey
+	}
+
+	for _, stored := range m.db.reviews {
+		if stored.WatchID == review.WatchID && stored.UserID == review.UserID {
+			return ErrDuplicateReview
+		}
+	}
+
+	m.db.lastReviewID++
+
+	now := time.Now().Truncate(time.Second)
+
+	review.ID = m.db.lastReviewID
+	review.CreatedAt = now
+	review.UpdatedAt = now
+	review.Author = user.Name
+	review.Version = 1
+
+	stored := *review
+	m.db.reviews[review.ID] = &stored
+
+	m.db.refreshWatchRating(review.WatchID)
+
+	return nil
+}
+
+func (m MockReviewModel) Get(ctx context.Context, watchID, id int64) (*Review, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.reviews[id]
+	if !ok || stored.WatchID != watchID {
+		return nil, ErrRecordNotFound
+	}
+
+	return m.db.review(stored), nil
+}
+
+func (m MockReviewModel) GetAll(ctx context.Context, filter ReviewFilter, filters Filters) ([]*Review, Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	matched := []*Review{}
+
+	for _, stored := range m.db.reviews {
+		if filter.WatchID != 0 && stored.WatchID != filter.WatchID {
+			continue
+		}
+		if filter.Status != "" && stored.Status != filter.Status {
+			continue
+		}
+		matched = append(matched, m.db.review(stored))
+	}
+
+	clauses := filters.sortClauses()
+
+	sort.Slice(matched, func(i, j int) bool {
+		for _, clause := range clauses {
+			var cmp int
+			switch clause.column {
+			case "created_at":
+				cmp = matched[i].CreatedAt.Compare(matched[j].CreatedAt)
+			case "rating":
+				cmp = compareInt64(int64(matched[i].Rating), int64(matched[j].Rating))
+			default:
+				cmp = compareInt64(matched[i].ID, matched[j].ID)
+			}
+			if clause.descending {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+
+	totalRecords := len(matched)
+
+	start := filters.offset()
+	if start > totalRecords {
+		start = totalRecords
+	}
+	end := start + filters.limit()
+	if end > totalRecords {
+		end = totalRecords
+	}
+
+	if start == end {
+		totalRecords = 0
+	}
+
+	return matched[start:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m MockReviewModel) Update(ctx context.Context, review *Review) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.watches[review.WatchID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	stored, ok := m.db.reviews[review.ID]
+	if !ok || stored.WatchID != review.WatchID || stored.Version != review.Version {
+		return ErrEditConflict
+	}
+
+	stored.Rating = review.Rating
+	stored.Title = review.Title
+	stored.Body = review.Body
+	stored.Status = review.Status
+	stored.UpdatedAt = time.Now().Truncate(time.Second)
+	stored.Version++
+
+	review.UpdatedAt = stored.UpdatedAt
+	review.Version = stored.Version
+
+	m.db.refreshWatchRating(review.WatchID)
+
+	return nil
+}
+
+func (m MockReviewModel) Delete(ctx context.Context, watchID, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.reviews[id]
+	if !ok || stored.WatchID != watchID {
+		return ErrRecordNotFound
+	}
+
+	delete(m.db.reviews, id)
+
+	m.db.refreshWatchRating(watchID)
+
+	return nil
+}
+
+// review returns a copy of a stored review with the name of its author, as
+// the join with users would. The caller holds db.mu.
+func (db *mockDB) review(stored *Review) *Review {
+	review := *stored
+	if user, ok := db.users[review.UserID]; ok {
+		review.Author = user.Name
+	}
+	return &review
+}
+
+// refreshWatchRating is the in-memory counterpart of refreshWatchRating. The
+// caller holds db.mu.
+func (db *mockDB) refreshWatchRating(watchID int64) {
+	watch, ok := db.watches[watchID]
+	if !ok {
+		return
+	}
+
+	var sum, count int32
+
+	for _, review := range db.reviews {
+		if review.WatchID == watchID && review.Status == ReviewApproved {
+			sum += int32(review.Rating)
+			count++
+		}
+	}
+
+	watch.AverageRating = 0
+	if count > 0 {
+		watch.AverageRating = math.Round(float64(sum)/float64(count)*100) / 100
+	}
+	watch.ReviewCount = count
+}
@@ -0,0 +1,284 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Actions recorded in the revision history of a watch.
+const (
+	RevisionInsert  = "insert"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	RevisionRevert  = "revert"
+)
+
+// WatchRevision is the state of a watch right after one of its versions was
+// written. Changes holds the fields that differ from the previous revision.
+type WatchRevision struct {
+	ID        int64                  `json:"id"`
+	CreatedAt time.Time              `json:"created_at"`
+	WatchID   int64                  `json:"watch_id"`
+	Version   int32                  `json:"version"`
+	Action    string                 `json:"action"`
+	UserID    int64                  `json:"user_id,omitempty"`
+	Snapshot  *Watch                 `json:"snapshot"`
+	Changes   map[string]FieldChange `json:"changes"`
+}
+
+// FieldChange is the JSON value of a field before and after a revision. A
+// field that was or became empty is null on that side.
+type FieldChange struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+// unrevisedFields are left out of the diffs: the id never changes, the
+// version is the revision's own number, the stock level has a ledger of its
+// own and the ratings follow the reviews.
+var unrevisedFields = map[string]bool{
+	"id":             true,
+	"version":        true,
+	"stock_quantity": true,
+	"relevance":      true,
+	"average_rating": true,
+	"review_count":   true,
+}
+
+type actorContextKey struct{}
+
+// WithActor returns a copy of ctx carrying the id of the user on whose behalf
+// writes are made, which is recorded in the revisions they produce. Anonymous
+// users have id 0 and are recorded as no user.
+func WithActor(ctx context.Context, userID int64) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, userID)
+}
+
+func actor(ctx context.Context) int64 {
+	userID, _ := ctx.Value(actorContextKey{}).(int64)
+	return userID
+}
+
+// diffSnapshots compares two JSON encoded watches field by field. previous
+// is nil for the first revision of a watch.
+func diffSnapshots(previous, current []byte) (map[string]FieldChange, error) {
+	before := map[string]json.RawMessage{}
+	after := map[string]json.RawMessage{}
+
+	if previous != nil {
+		if err := json.Unmarshal(previous, &before); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(current, &after); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool)
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+
+	changes := make(map[string]FieldChange)
+
+	for key := range keys {
+		if unrevisedFields[key] {
+			continue
+		}
+
+		// jsonb normalizes what it stores, so values are compared decoded
+		// rather than byte for byte.
+		var from, to interface{}
+		if raw, ok := before[key]; ok {
+			if err := json.Unmarshal(raw, &from); err != nil {
+				return nil, err
+			}
+		}
+		if raw, ok := after[key]; ok {
+			if err := json.Unmarshal(raw, &to); err != nil {
+				return nil, err
+			}
+		}
+
+		if !reflect.DeepEqual(from, to) {
+			changes[key] = FieldChange{From: before[key], To: after[key]}
+		}
+	}
+
+	return changes, nil
+}
+
+// recordWatchRevision snapshots the watch as written by tx and stores it as
+// a revision made by the actor of ctx. Every statement that bumps the version
+// of a watch records one, so versions and revisions correspond one to one.
+func recordWatchRevision(ctx context.Context, tx *sql.Tx, watchID int64, action string) error {
+	query := `SELECT id, created_at, brand, COALESCE(brand_id, 0), model, dial_color, strap_type,
+	       diameter, energy, gender, price, currency, image_url, COALESCE(sku, ''), stock_quantity,
+	       average_rating, review_count, version, deleted_at
+	FROM watches WHERE id = $1`
+
+	var watch Watch
+
+	err := tx.QueryRowContext(ctx, query, watchID).Scan(
+		&watch.ID,
+		&watch.CreatedAt,
+		&watch.Brand,
+		&watch.BrandID,
+		&watch.Model,
+		&watch.DialColor,
+		&watch.StrapType,
+		&watch.Diameter,
+		&watch.Energy,
+		&watch.Gender,
+		&watch.Price.Amount,
+		&watch.Price.Currency,
+		&watch.ImageURL,
+		&watch.SKU,
+		&watch.StockQuantity,
+		&watch.AverageRating,
+		&watch.ReviewCount,
+		&watch.Version,
+		&watch.DeletedAt,
+	)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	var previous []byte
+
+	query = `SELECT snapshot FROM watch_revisions WHERE watch_id = $1 ORDER BY version DESC LIMIT 1`
+
+	err = tx.QueryRowContext(ctx, query, watchID).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return contextError(ctx, err)
+	}
+
+	snapshot, err := json.Marshal(&watch)
+	if err != nil {
+		return err
+	}
+
+	changes, err := diffSnapshots(previous, snapshot)
+	if err != nil {
+		return err
+	}
+
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO watch_revisions (watch_id, version, action, user_id, snapshot, changes)
+	VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6)`
+
+	_, err = tx.ExecContext(ctx, query, watchID, watch.Version, action, actor(ctx), snapshot, changesJSON)
+	return contextError(ctx, err)
+}
+
+type RevisionModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+func (m RevisionModel) Get(ctx context.Context, watchID int64, version int32) (*WatchRevision, error) {
+	if version < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, created_at, watch_id, version, action, COALESCE(user_id, 0), snapshot, changes
+	FROM watch_revisions
+	WHERE watch_id = $1 AND version = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	revision, err := scanRevision(m.DB.QueryRowContext(ctx, query, watchID, version).Scan)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return revision, nil
+}
+
+func (m RevisionModel) GetAll(ctx context.Context, watchID int64, filters Filters) ([]*WatchRevision, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, watch_id, version, action, COALESCE(user_id, 0), snapshot, changes
+	FROM watch_revisions
+	WHERE watch_id = $1
+	ORDER BY %s
+	LIMIT $2 OFFSET $3`, orderBy(filters.sortClauses(), false))
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, watchID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*WatchRevision{}
+
+	for rows.Next() {
+		revision, err := scanRevision(func(dest ...interface{}) error {
+			return rows.Scan(append([]interface{}{&totalRecords}, dest...)...)
+		})
+		if err != nil {
+			return nil, Metadata{}, contextError(ctx, err)
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	return revisions, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// scanRevision reads a revision through scan, decoding its JSON columns.
+func scanRevision(scan func(dest ...interface{}) error) (*WatchRevision, error) {
+	var revision WatchRevision
+	var snapshot, changes []byte
+
+	err := scan(
+		&revision.ID,
+		&revision.CreatedAt,
+		&revision.WatchID,
+		&revision.Version,
+		&revision.Action,
+		&revision.UserID,
+		&snapshot,
+		&changes,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(snapshot, &revision.Snapshot); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(changes, &revision.Changes); err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
@@ -0,0 +1,148 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+type MockRevisionModel struct {
+	db *mockDB
+}
+
+func (m MockRevisionModel) Get(ctx context.Context, watchID int64, version int32) (*WatchRevision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for _, stored := range m.db.watchRevisions {
+		if stored.WatchID == watchID && stored.Version == version {
+			return copyRevision(stored), nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m MockRevisionModel) GetAll(ctx context.Context, watchID int64, filters Filters) ([]*WatchRevision, Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	matched := []*WatchRevision{}
+
+	for _, stored := range m.db.watchRevisions {
+		if stored.WatchID == watchID {
+			matched = append(matched, copyRevision(stored))
+		}
+	}
+
+	clauses := filters.sortClauses()
+
+	sort.Slice(matched, func(i, j int) bool {
+		for _, clause := range clauses {
+			var cmp int
+			switch clause.column {
+			case "version":
+				cmp = compareInt64(int64(matched[i].Version), int64(matched[j].Version))
+			default:
+				cmp = compareInt64(matched[i].ID, matched[j].ID)
+			}
+			if clause.descending {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+
+	totalRecords := len(matched)
+
+	start := filters.offset()
+	if start > totalRecords {
+		start = totalRecords
+	}
+	end := start + filters.limit()
+	if end > totalRecords {
+		end = totalRecords
+	}
+
+	if start == end {
+		totalRecords = 0
+	}
+
+	return matched[start:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// recordWatchRevision is the in-memory counterpart of recordWatchRevision.
+// The snapshot goes through JSON just as it does in the jsonb column. The
+// caller holds db.mu.
+func (db *mockDB) recordWatchRevision(ctx context.Context, watchID int64, action string) error {
+	watch := db.watches[watchID]
+
+	var previous []byte
+	var latest *WatchRevision
+	for _, stored := range db.watchRevisions {
+		if stored.WatchID == watchID && (latest == nil || stored.Version > latest.Version) {
+			latest = stored
+		}
+	}
+	if latest != nil {
+		var err error
+		if previous, err = json.Marshal(latest.Snapshot); err != nil {
+			return err
+		}
+	}
+
+	snapshot, err := json.Marshal(watch)
+	if err != nil {
+		return err
+	}
+
+	changes, err := diffSnapshots(previous, snapshot)
+	if err != nil {
+		return err
+	}
+
+	db.lastWatchRevisionID++
+
+	revision := &WatchRevision{
+		ID:        db.lastWatchRevisionID,
+		CreatedAt: time.Now().Truncate(time.Second),
+		WatchID:   watchID,
+		Version:   watch.Version,
+		Action:    action,
+		UserID:    actor(ctx),
+		Changes:   changes,
+	}
+	if err = json.Unmarshal(snapshot, &revision.Snapshot); err != nil {
+		return err
+	}
+
+	db.watchRevisions = append(db.watchRevisions, revision)
+
+	return nil
+}
+
+func copyRevision(stored *WatchRevision) *WatchRevision {
+	revision := *stored
+
+	snapshot := *stored.Snapshot
+	revision.Snapshot = &snapshot
+
+	revision.Changes = make(map[string]FieldChange, len(stored.Changes))
+	for key, change := range stored.Changes {
+		revision.Changes[key] = change
+	}
+
+	return &revision
+}
@@ -0,0 +1,59 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+type MockTokenModel struct {
+	db *mockDB
+}
+
+func (m MockTokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+func (m MockTokenModel) Insert(ctx context.Context, token *Token) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.users[token.UserID]; !ok {
+		return errMockForeignKey
+	}
+	if _, ok := m.db.tokens[string(token.Hash)]; ok {
+		return errMockDuplicateKey
+	}
+
+	stored := *token
+	stored.Plaintext = ""
+	stored.Expiry = token.Expiry.Truncate(time.Second)
+	m.db.tokens[string(token.Hash)] = &stored
+
+	return nil
+}
+
+func (m MockTokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for hash, token := range m.db.tokens {
+		if token.Scope == scope && token.UserID == userID {
+			delete(m.db.tokens, hash)
+		}
+	}
+
+	return nil
+}
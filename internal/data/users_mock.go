@@ -0,0 +1,116 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"strings"
+	"time"
+)
+
+type MockUserModel struct {
+	db *mockDB
+}
+
+func (m MockUserModel) Insert(ctx context.Context, user *User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if m.db.emailTaken(user.Email, 0) {
+		return ErrDuplicateEmail
+	}
+
+	m.db.lastUserID++
+
+	user.ID = m.db.lastUserID
+	user.CreatedAt = time.Now().Truncate(time.Second)
+	user.Version = 1
+
+	stored := *user
+	stored.Password.plaintext = nil
+	m.db.users[user.ID] = &stored
+
+	return nil
+}
+
+func (m MockUserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for _, stored := range m.db.users {
+		if strings.EqualFold(stored.Email, email) {
+			user := *stored
+			return &user, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m MockUserModel) Update(ctx context.Context, user *User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if m.db.emailTaken(user.Email, user.ID) {
+		return ErrDuplicateEmail
+	}
+
+	stored, ok := m.db.users[user.ID]
+	if !ok || stored.Version != user.Version {
+		return ErrEditConflict
+	}
+
+	user.Version++
+
+	updated := *user
+	updated.Password.plaintext = nil
+	m.db.users[user.ID] = &updated
+
+	return nil
+}
+
+func (m MockUserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	token, ok := m.db.tokens[string(tokenHash[:])]
+	if !ok || token.Scope != tokenScope || !token.Expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+
+	stored, ok := m.db.users[token.UserID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	user := *stored
+	return &user, nil
+}
+
+// emailTaken reports whether another user already owns the email address,
+// mirroring the case-insensitive UNIQUE constraint on users.email (citext).
+func (db *mockDB) emailTaken(email string, exceptID int64) bool {
+	for id, stored := range db.users {
+		if id != exceptID && strings.EqualFold(stored.Email, email) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,26 +3,61 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/lib/pq"
 	"jewelry.abgdrv.com/internal/validator"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
+var (
+	ErrDuplicateSKU = errors.New("duplicate sku")
+	// ErrWatchInUse is returned when purging a watch that promotions target.
+	ErrWatchInUse = errors.New("watch in use")
+)
+
+// SKURX is the format of stock keeping units: letters, digits, dots, dashes
+// and underscores, starting with a letter or digit.
+var SKURX = regexp.MustCompile("^[A-Za-z0-9][A-Za-z0-9._-]*$")
+
 type Watch struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"-"`
-	Brand     string    `json:"brand,omitempty"`
-	Model     string    `json:"model,omitempty"`
-	DialColor string    `json:"dial_color"`
-	StrapType string    `json:"strap_type"`
-	Diameter  int8      `json:"diameter"`
-	Energy    string    `json:"energy"`
-	Gender    string    `json:"gender"`
-	Price     float64   `json:"price"`
-	ImageURL  string    `json:"image_url"`
-	Version   int32     `json:"version"`
+	// Brand is a copy of the name of the brand referenced by BrandID.
+	Brand     string `json:"brand,omitempty"`
+	BrandID   int64  `json:"brand_id,omitempty"`
+	Model     string `json:"model,omitempty"`
+	DialColor string `json:"dial_color"`
+	StrapType string `json:"strap_type"`
+	Diameter  int8   `json:"diameter"`
+	Energy    string `json:"energy"`
+	Gender    string `json:"gender"`
+	Price     Money  `json:"price"`
+	ImageURL  string `json:"image_url"`
+	SKU       string `json:"sku,omitempty"`
+	// StockQuantity is only changed through the inventory model, which
+	// records every change in the stock movements ledger.
+	StockQuantity int32 `json:"stock_quantity"`
+	// AverageRating and ReviewCount cover the approved reviews of the watch
+	// and are only changed through the review model.
+	AverageRating float64 `json:"average_rating"`
+	ReviewCount   int32   `json:"review_count"`
+	Version       int32   `json:"version"`
+	// DeletedAt is set while the watch is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Relevance is the full-text search rank, only set when listing watches
+	// with a search query.
+	Relevance float32 `json:"relevance,omitempty"`
+	// PreviousPrice and DiscountPercent are filled in from the price history
+	// when the price was recently lowered.
+	PreviousPrice   *Money  `json:"previous_price,omitempty"`
+	DiscountPercent float64 `json:"discount_percent,omitempty"`
 }
 
 func ValidateWatch(v *validator.Validator, watch *Watch) {
@@ -45,64 +80,190 @@ func ValidateWatch(v *validator.Validator, watch *Watch) {
 
 	v.Check(strings.ToLower(watch.Gender) == "male" || strings.ToLower(watch.Gender) == "female", "gender", "Gender can be male or female")
 
-	v.Check(watch.Price > 0, "price", "can not be equal or less than 0")
+	v.Check(watch.Price.Amount > 0, "price", "can not be equal or less than 0")
+	v.Check(watch.Price.Currency == CatalogCurrency, "price", "must be in "+CatalogCurrency)
 
-	v.Check(watch.ImageURL != "", "image_url", "must be provided")
+	// image_url is normally derived from the primary uploaded image, but
+	// watches without images may still link to one hosted elsewhere.
+	v.Check(len(watch.ImageURL) <= 2000, "image_url", "must not be more than 2000 bytes long")
+
+	if watch.SKU != "" {
+		v.Check(len(watch.SKU) <= 64, "sku", "must not be more than 64 bytes long")
+		v.Check(validator.Matches(watch.SKU, SKURX), "sku", "must only contain letters, digits, dots, dashes and underscores")
+	}
 }
 
-type WatchModel struct {
-	DB *sql.DB
+// WatchFilter narrows down the watches listed by GetAll and counted by
+// Facets. A watch has to match one of the values of every non-empty list;
+// zero bounds are not applied.
+type WatchFilter struct {
+	Search      string
+	Brands      []string
+	DialColors  []string
+	StrapTypes  []string
+	Energies    []string
+	Genders     []string
+	Diameters   []int
+	DiameterMin int
+	DiameterMax int
+	// PriceMin and PriceMax are in minor units of the catalog currency.
+	PriceMin int64
+	PriceMax int64
+	// InStock, when set, keeps only the watches that are (true) or are not
+	// (false) in stock.
+	InStock *bool
+	// PriceDroppedSince keeps only the watches that are cheaper now than
+	// they were at that time.
+	PriceDroppedSince time.Time
+	// RatingMin keeps only the watches with at least this average rating.
+	RatingMin float64
+	// Deleted selects the watches in the trash instead of the others.
+	Deleted bool
 }
 
-func (w WatchModel) Insert(watch *Watch) error {
-	query := `INSERT INTO watches (brand, model, dial_color, strap_type, diameter, energy, gender, price, image_url) 
-				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-				RETURNING id, created_at, version`
+// maxFilterValues caps the number of comma-separated values per attribute.
+const maxFilterValues = 20
+
+func ValidateWatchFilter(v *validator.Validator, f WatchFilter) {
+	for key, values := range map[string][]string{
+		"brand":      f.Brands,
+		"dial_color": f.DialColors,
+		"strap_type": f.StrapTypes,
+		"energy":     f.Energies,
+		"gender":     f.Genders,
+	} {
+		v.Check(len(values) <= maxFilterValues, key, fmt.Sprintf("must not contain more than %d values", maxFilterValues))
+		for _, value := range values {
+			v.Check(value != "", key, "must not contain empty values")
+			v.Check(len(value) <= 500, key, "must not contain values more than 500 bytes long")
+		}
+	}
 
-	args := []interface{}{
-		watch.Brand,
-		watch.Model,
-		watch.DialColor,
-		watch.StrapType,
-		watch.Diameter,
-		watch.Energy,
-		watch.Gender,
-		watch.Price,
-		watch.ImageURL,
+	v.Check(len(f.Diameters) <= maxFilterValues, "diameter", fmt.Sprintf("must not contain more than %d values", maxFilterValues))
+	for _, diameter := range f.Diameters {
+		v.Check(diameter > 0, "diameter", "must contain values greater than zero")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	v.Check(f.DiameterMin >= 0, "diameter_min", "must not be negative")
+	v.Check(f.DiameterMax >= 0, "diameter_max", "must not be negative")
+	v.Check(f.DiameterMax == 0 || f.DiameterMin <= f.DiameterMax, "diameter_max", "must not be less than diameter_min")
+
+	v.Check(f.PriceMin >= 0, "price_min", "must not be negative")
+	v.Check(f.PriceMax >= 0, "price_max", "must not be negative")
+	v.Check(f.PriceMax == 0 || f.PriceMin <= f.PriceMax, "price_max", "must not be less than price_min")
+
+	v.Check(f.RatingMin >= 0 && f.RatingMin <= 5, "rating_min", "must be between 0 and 5")
+
+	v.Check(len(f.Search) <= 500, "q", "must not be more than 500 bytes long")
+}
+
+// IsEmpty reports whether the filter matches every watch.
+func (f WatchFilter) IsEmpty() bool {
+	return f.Search == "" && len(f.Brands) == 0 && len(f.DialColors) == 0 && len(f.StrapTypes) == 0 &&
+		len(f.Energies) == 0 && len(f.Genders) == 0 && len(f.Diameters) == 0 &&
+		f.DiameterMin == 0 && f.DiameterMax == 0 && f.PriceMin == 0 && f.PriceMax == 0 && f.InStock == nil && f.PriceDroppedSince.IsZero() && f.RatingMin == 0
+}
+
+type WatchModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// Insert adds the watch. A watch with a Brand but no BrandID is linked to
+// the brand of that name, which is created along with the watch if there is
+// none yet; Update does the same.
+func (w WatchModel) Insert(ctx context.Context, watch *Watch) error {
+	query := `INSERT INTO watches (brand, model, dial_color, strap_type, diameter, energy, gender, price, currency, image_url, sku, brand_id) 
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), NULLIF($12, 0))
+				RETURNING id, created_at, version, stock_quantity`
+
+	ctx, cancel := context.WithTimeout(ctx, w.Timeouts.Write)
 	defer cancel()
 
-	return w.DB.QueryRowContext(ctx, query, args...).Scan(&watch.ID, &watch.CreatedAt, &watch.Version)
+	return withTx(ctx, w.DB, func(tx *sql.Tx) error {
+		err := linkBrand(ctx, tx, watch)
+		if err != nil {
+			return err
+		}
+
+		args := []interface{}{
+			watch.Brand,
+			watch.Model,
+			watch.DialColor,
+			watch.StrapType,
+			watch.Diameter,
+			watch.Energy,
+			watch.Gender,
+			watch.Price.Amount,
+			watch.Price.Currency,
+			watch.ImageURL,
+			watch.SKU,
+			watch.BrandID,
+		}
+
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&watch.ID, &watch.CreatedAt, &watch.Version, &watch.StockQuantity)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "watches_sku_idx"`:
+				return ErrDuplicateSKU
+			default:
+				return contextError(ctx, err)
+			}
+		}
+
+		err = recordPriceChange(ctx, tx, watch.ID)
+		if err != nil {
+			return err
+		}
+
+		return recordWatchRevision(ctx, tx, watch.ID, RevisionInsert)
+	})
 }
 
-func (w WatchModel) Get(id int64) (*Watch, error) {
+// Get returns a watch outside the trash.
+func (w WatchModel) Get(ctx context.Context, id int64) (*Watch, error) {
+	return w.get(ctx, id, false)
+}
+
+// GetTrashed returns a watch in the trash.
+func (w WatchModel) GetTrashed(ctx context.Context, id int64) (*Watch, error) {
+	return w.get(ctx, id, true)
+}
+
+func (w WatchModel) get(ctx context.Context, id int64, deleted bool) (*Watch, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `SELECT id, created_at, brand, model, dial_color, strap_type,
-       diameter, energy, gender, price, image_url, version 
-			FROM watches WHERE id = $1`
+	query := `SELECT id, created_at, brand, COALESCE(brand_id, 0), model, dial_color, strap_type,
+       diameter, energy, gender, price, currency, image_url, COALESCE(sku, ''), stock_quantity,
+       average_rating, review_count, deleted_at, version 
+			FROM watches WHERE id = $1 AND (deleted_at IS NOT NULL) = $2`
 
 	var watch Watch
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, w.Timeouts.Read)
 	defer cancel()
 
-	err := w.DB.QueryRowContext(ctx, query, id).Scan(
+	err := w.DB.QueryRowContext(ctx, query, id, deleted).Scan(
 		&watch.ID,
 		&watch.CreatedAt,
 		&watch.Brand,
+		&watch.BrandID,
 		&watch.Model,
 		&watch.DialColor,
 		&watch.StrapType,
 		&watch.Diameter,
 		&watch.Energy,
 		&watch.Gender,
-		&watch.Price,
+		&watch.Price.Amount,
+		&watch.Price.Currency,
 		&watch.ImageURL,
+		&watch.SKU,
+		&watch.StockQuantity,
+		&watch.AverageRating,
+		&watch.ReviewCount,
+		&watch.DeletedAt,
 		&watch.Version,
 	)
 	if err != nil {
@@ -110,121 +271,205 @@ func (w WatchModel) Get(id int64) (*Watch, error) {
 		case errors.Is(err, sql.ErrNoRows):
 			return nil, ErrRecordNotFound
 		default:
-			return nil, err
+			return nil, contextError(ctx, err)
 		}
 	}
 
 	return &watch, nil
 }
 
-func (w WatchModel) Update(watch *Watch) error {
+func (w WatchModel) Update(ctx context.Context, watch *Watch) error {
+	return w.update(ctx, watch, RevisionUpdate)
+}
+
+// Revert writes the watch back like Update, but records the revision as a
+// revert of an earlier one.
+func (w WatchModel) Revert(ctx context.Context, watch *Watch) error {
+	return w.update(ctx, watch, RevisionRevert)
+}
+
+func (w WatchModel) update(ctx context.Context, watch *Watch, action string) error {
 	query := `UPDATE watches
 				SET brand = $1, model = $2, dial_color = $3,
 				    strap_type = $4, diameter = $5, energy = $6,
-				    gender = $7, price = $8, image_url = $9,
-				    version = version + 1
-				    WHERE id = $10 AND version = $11
-				    RETURNING version`
-
-	args := []interface{}{
-		watch.Brand,
-		watch.Model,
-		watch.DialColor,
-		watch.StrapType,
-		watch.Diameter,
-		watch.Energy,
-		watch.Gender,
-		watch.Price,
-		watch.ImageURL,
-		watch.ID,
-		watch.Version,
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+				    gender = $7, price = $8, currency = $9, image_url = $10,
+				    sku = NULLIF($11, ''), brand_id = NULLIF($12, 0), version = version + 1
+				    WHERE id = $13 AND version = $14 AND deleted_at IS NULL
+				    RETURNING version, stock_quantity, average_rating, review_count`
+
+	ctx, cancel := context.WithTimeout(ctx, w.Timeouts.Write)
 	defer cancel()
 
-	err := w.DB.QueryRowContext(ctx, query, args...).Scan(&watch.Version)
-	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrEditConflict
-		default:
+	return withTx(ctx, w.DB, func(tx *sql.Tx) error {
+		err := linkBrand(ctx, tx, watch)
+		if err != nil {
 			return err
 		}
+
+		args := []interface{}{
+			watch.Brand,
+			watch.Model,
+			watch.DialColor,
+			watch.StrapType,
+			watch.Diameter,
+			watch.Energy,
+			watch.Gender,
+			watch.Price.Amount,
+			watch.Price.Currency,
+			watch.ImageURL,
+			watch.SKU,
+			watch.BrandID,
+			watch.ID,
+			watch.Version,
+		}
+
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&watch.Version, &watch.StockQuantity, &watch.AverageRating, &watch.ReviewCount)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "watches_sku_idx"`:
+				return ErrDuplicateSKU
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return contextError(ctx, err)
+			}
+		}
+
+		err = recordPriceChange(ctx, tx, watch.ID)
+		if err != nil {
+			return err
+		}
+
+		err = refreshCartPrices(ctx, tx, watch.ID)
+		if err != nil {
+			return err
+		}
+
+		return recordWatchRevision(ctx, tx, watch.ID, action)
+	})
+}
+
+// Delete moves the watch to the trash, from where Restore brings it back and
+// Purge removes it for good. Unless version is zero, the watch is only moved
+// at that version, and ErrEditConflict is returned if it is no longer there.
+func (w WatchModel) Delete(ctx context.Context, id int64, version int32) error {
+	query := `
+	UPDATE watches
+	SET deleted_at = NOW(), version = version + 1
+	WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)`
+
+	err := w.execOne(ctx, query, id, RevisionDelete, version)
+	if errors.Is(err, ErrRecordNotFound) && version != 0 {
+		return ErrEditConflict
 	}
+	return err
+}
 
-	return nil
+// Restore brings a watch back from the trash. Like Delete, it only does so at
+// version unless that is zero.
+func (w WatchModel) Restore(ctx context.Context, id int64, version int32) error {
+	query := `
+	UPDATE watches
+	SET deleted_at = NULL, version = version + 1
+	WHERE id = $1 AND deleted_at IS NOT NULL AND ($2 = 0 OR version = $2)`
+
+	err := w.execOne(ctx, query, id, RevisionRestore, version)
+	if errors.Is(err, ErrRecordNotFound) && version != 0 {
+		return ErrEditConflict
+	}
+	return err
 }
 
-func (w WatchModel) Delete(id int64) error {
+// Purge permanently deletes a watch from the trash together with its stock
+// movements, images and revisions. Like Delete, it only does so at version
+// unless that is zero.
+func (w WatchModel) Purge(ctx context.Context, id int64, version int32) error {
+	query := `DELETE FROM watches WHERE id = $1 AND deleted_at IS NOT NULL AND ($2 = 0 OR version = $2)`
+
+	err := w.execOne(ctx, query, id, "", version)
+	switch {
+	case err != nil && err.Error() == `pq: update or delete on table "watches" violates foreign key constraint "promotions_watch_id_fkey" on table "promotions"`:
+		return ErrWatchInUse
+	case errors.Is(err, ErrRecordNotFound) && version != 0:
+		return ErrEditConflict
+	}
+	return err
+}
+
+// execOne runs a statement on the watch with the given id, followed by any
+// further arguments, returning ErrRecordNotFound if no row was affected.
+// Unless action is empty, the resulting version of the watch is recorded as a
+// revision.
+func (w WatchModel) execOne(ctx context.Context, query string, id int64, action string, args ...interface{}) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	query := `DELETE FROM watches WHERE id = $1`
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, w.Timeouts.Write)
 	defer cancel()
 
-	result, err := w.DB.ExecContext(ctx, query, id)
-	if err != nil {
-		return err
-	}
+	return withTx(ctx, w.DB, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, append([]interface{}{id}, args...)...)
+		if err != nil {
+			return contextError(ctx, err)
+		}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
-	}
+		if rowsAffected == 0 {
+			return ErrRecordNotFound
+		}
 
-	return nil
+		if action == "" {
+			return nil
+		}
+		return recordWatchRevision(ctx, tx, id, action)
+	})
 }
 
-func (w WatchModel) GetAll(
-	brand string,
-	dialColor string,
-	strapType string,
-	diameter int8,
-	energy string,
-	gender string,
-	priceRange []int,
-	filters Filters) ([]*Watch, Metadata, error) {
-	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, brand, model, dial_color, strap_type,
-		       diameter, energy, gender, price, image_url, version
-		FROM watches 
-		WHERE (to_tsvector('simple', brand) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (to_tsvector('simple', dial_color) @@ plainto_tsquery('simple', $2) OR $2 = '')
-		AND (to_tsvector('simple', strap_type) @@ plainto_tsquery('simple', $3) OR $3 = '')
-		AND (diameter = $4 OR $4 = 0)
-		AND (to_tsvector('simple', energy) @@ plainto_tsquery('simple', $5) OR $5 = '')
-		AND (to_tsvector('simple', gender) @@ plainto_tsquery('simple', $6) OR $6 = '')
-		AND (price BETWEEN $7 AND $8)
-		ORDER BY %s %s, id ASC
-		LIMIT $9 OFFSET $10`, filters.sortColumn(), filters.sortDirection())
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func (w WatchModel) GetAll(ctx context.Context, filter WatchFilter, filters Filters) ([]*Watch, Metadata, error) {
+	args := queryArgs{}
+
+	where := "WHERE " + watchFilterCondition(filter, &args)
+
+	relevance, clauses := watchSort(filter, filters, &args)
 
-	args := []interface{}{
-		brand,
-		dialColor,
-		strapType,
-		diameter,
-		energy,
-		gender,
-		priceRange[0],
-		priceRange[1],
-		filters.limit(),
-		filters.offset(),
+	var query string
+
+	if filters.keyset() {
+		values, err := filters.watchCursorValues(clauses)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		where += " AND " + keysetCondition(clauses, values, filters.backward(), &args)
+
+		// One extra row tells whether another page follows in the direction
+		// being read.
+		query = fmt.Sprintf(`
+		SELECT %s, %s
+		FROM watches
+		%s
+		ORDER BY %s
+		LIMIT %s`, watchListColumns, relevance, where, orderBy(clauses, filters.backward()), args.add(filters.limit()+1))
+	} else {
+		query = fmt.Sprintf(`
+		SELECT count(*) OVER(), %s, %s
+		FROM watches
+		%s
+		ORDER BY %s
+		LIMIT %s OFFSET %s`, watchListColumns, relevance, where, orderBy(clauses, false), args.add(filters.limit()), args.add(filters.offset()))
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, w.Timeouts.Read)
+	defer cancel()
+
 	rows, err := w.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, Metadata{}, err
+		return nil, Metadata{}, contextError(ctx, err)
 	}
 	defer rows.Close()
 
@@ -234,63 +479,302 @@ func (w WatchModel) GetAll(
 	for rows.Next() {
 		var watch Watch
 
-		err := rows.Scan(
-			&totalRecords,
-			&watch.ID,
-			&watch.CreatedAt,
-			&watch.Brand,
-			&watch.Model,
-			&watch.DialColor,
-			&watch.StrapType,
-			&watch.Diameter,
-			&watch.Energy,
-			&watch.Gender,
-			&watch.Price,
-			&watch.ImageURL,
-			&watch.Version,
-		)
+		dest := watch.listScanDest()
+		if !filters.keyset() {
+			dest = append([]interface{}{&totalRecords}, dest...)
+		}
+
+		err := rows.Scan(dest...)
 		if err != nil {
-			return nil, Metadata{}, err
+			return nil, Metadata{}, contextError(ctx, err)
 		}
 
 		watches = append(watches, &watch)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	if filters.keyset() {
+		watches, metadata := keysetWatchPage(watches, filters, clauses)
+		return watches, metadata, nil
 	}
 
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	if metadata.CurrentPage < metadata.LastPage && len(watches) > 0 {
+		metadata.NextCursor = watches[len(watches)-1].cursor(filters.Sort, clauses)
+	}
 
 	return watches, metadata, nil
 }
 
-//type MockWatchModel struct{}
-//
-//func (m MockWatchModel) Insert(watch *Watch) error {
-//	return nil
-//}
-//
-//func (m MockWatchModel) Get(id int64) (*Watch, error) {
-//	return nil, nil
-//}
-//
-//func (m MockWatchModel) Update(watch *Watch) error {
-//	return nil
-//}
-//
-//func (m MockWatchModel) Delete(id int64) error {
-//	return nil
-//}
-//
-//func (w MockWatchModel) GetAll(
-//	brand string,
-//	dialColor string,
-//	strapType string,
-//	diameter int8,
-//	energy string,
-//	gender string,
-//	priceRange []int,
-//	filters Filters) ([]*Watch, Metadata, error) {
-//	return nil, Metadata{}, nil
-//}
+// watchListColumns are the columns selected when listing watches, which
+// listScanDest scans together with the relevance that follows them.
+const watchListColumns = `id, created_at, brand, COALESCE(brand_id, 0), model, dial_color, strap_type,
+	diameter, energy, gender, price, currency, image_url, COALESCE(sku, ''), stock_quantity,
+	average_rating, review_count, version, deleted_at`
+
+func (watch *Watch) listScanDest() []interface{} {
+	return []interface{}{
+		&watch.ID,
+		&watch.CreatedAt,
+		&watch.Brand,
+		&watch.BrandID,
+		&watch.Model,
+		&watch.DialColor,
+		&watch.StrapType,
+		&watch.Diameter,
+		&watch.Energy,
+		&watch.Gender,
+		&watch.Price.Amount,
+		&watch.Price.Currency,
+		&watch.ImageURL,
+		&watch.SKU,
+		&watch.StockQuantity,
+		&watch.AverageRating,
+		&watch.ReviewCount,
+		&watch.Version,
+		&watch.DeletedAt,
+		&watch.Relevance,
+	}
+}
+
+// watchSort returns the expression of the search relevance for filter and
+// the clauses ordering watches by filters.Sort, appending the arguments of
+// both to args.
+func watchSort(filter WatchFilter, filters Filters, args *queryArgs) (string, []sortClause) {
+	relevance := "0::real"
+	if tsquery := searchQuery(filter.Search); tsquery != "" {
+		relevance = fmt.Sprintf("ts_rank(search_vector, to_tsquery('simple', %s))", args.add(tsquery))
+	}
+
+	clauses := filters.sortClauses()
+	for i := range clauses {
+		if clauses[i].column == "relevance" {
+			clauses[i].expr = relevance
+		}
+	}
+
+	return relevance, clauses
+}
+
+// watchFilterCondition returns the WHERE condition shared by the queries that
+// list or aggregate watches, appending its arguments to args.
+func watchFilterCondition(f WatchFilter, args *queryArgs) string {
+	conditions := []string{"deleted_at IS NULL"}
+	if f.Deleted {
+		conditions[0] = "deleted_at IS NOT NULL"
+	}
+
+	if len(f.Brands) > 0 {
+		conditions = append(conditions, brandFilterCondition(f.Brands, args))
+	}
+
+	for _, attribute := range []struct {
+		column string
+		values []string
+	}{
+		{"dial_color", f.DialColors},
+		{"strap_type", f.StrapTypes},
+		{"energy", f.Energies},
+		{"gender", f.Genders},
+	} {
+		if len(attribute.values) > 0 {
+			conditions = append(conditions, textFilterCondition(attribute.column, attribute.values, args))
+		}
+	}
+
+	if len(f.Diameters) > 0 {
+		conditions = append(conditions, fmt.Sprintf("diameter = ANY(%s)", args.add(pq.Array(f.Diameters))))
+	}
+	if f.DiameterMin > 0 {
+		conditions = append(conditions, fmt.Sprintf("diameter >= %s", args.add(f.DiameterMin)))
+	}
+	if f.DiameterMax > 0 {
+		conditions = append(conditions, fmt.Sprintf("diameter <= %s", args.add(f.DiameterMax)))
+	}
+	if f.PriceMin > 0 {
+		conditions = append(conditions, fmt.Sprintf("price >= %s", args.add(f.PriceMin)))
+	}
+	if f.PriceMax > 0 {
+		conditions = append(conditions, fmt.Sprintf("price <= %s", args.add(f.PriceMax)))
+	}
+	if f.InStock != nil {
+		if *f.InStock {
+			conditions = append(conditions, "stock_quantity > 0")
+		} else {
+			conditions = append(conditions, "stock_quantity = 0")
+		}
+	}
+	if f.RatingMin > 0 {
+		conditions = append(conditions, fmt.Sprintf("average_rating >= %s", args.add(f.RatingMin)))
+	}
+	if !f.PriceDroppedSince.IsZero() {
+		conditions = append(conditions, fmt.Sprintf(`price < (
+			SELECT ph.price FROM price_history ph
+			WHERE ph.watch_id = watches.id AND ph.changed_at <= %s
+			ORDER BY ph.changed_at DESC, ph.id DESC
+			LIMIT 1)`, args.add(f.PriceDroppedSince)))
+	}
+	if tsquery := searchQuery(f.Search); tsquery != "" {
+		conditions = append(conditions, fmt.Sprintf("search_vector @@ to_tsquery('simple', %s)", args.add(tsquery)))
+	}
+
+	return strings.Join(conditions, "\n\t\tAND ")
+}
+
+// textFilterCondition matches rows where the column contains the words of any
+// of the values.
+func textFilterCondition(column string, values []string, args *queryArgs) string {
+	matches := make([]string, len(values))
+	for i, value := range values {
+		matches[i] = fmt.Sprintf("to_tsvector('simple', %s) @@ plainto_tsquery('simple', %s)", column, args.add(value))
+	}
+	return "(" + strings.Join(matches, " OR ") + ")"
+}
+
+// brandFilterCondition matches watches of any of the brands given by id or
+// slug. Other values match the words of the brand name, as the filter did
+// before brands had ids.
+func brandFilterCondition(values []string, args *queryArgs) string {
+	matches := make([]string, len(values))
+	for i, value := range values {
+		if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+			matches[i] = fmt.Sprintf("brand_id = %s", args.add(id))
+			continue
+		}
+
+		placeholder := args.add(value)
+		matches[i] = fmt.Sprintf("(brand_id = (SELECT id FROM brands WHERE slug = %s) OR to_tsvector('simple', brand) @@ plainto_tsquery('simple', %s))",
+			placeholder, placeholder)
+	}
+	return "(" + strings.Join(matches, " OR ") + ")"
+}
+
+// searchQuery turns free text into a tsquery that requires every word of the
+// text as a prefix, so "sea blu" matches "Seamaster" with a blue dial. Only
+// letters and digits are kept, which leaves no tsquery operators in the
+// user's input.
+func searchQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// sortValue returns the watch's value for one of the sortable columns.
+func (watch *Watch) sortValue(column string) interface{} {
+	switch column {
+	case "brand":
+		return watch.Brand
+	case "model":
+		return watch.Model
+	case "dial_color":
+		return watch.DialColor
+	case "energy":
+		return watch.Energy
+	case "diameter":
+		return watch.Diameter
+	case "price":
+		return watch.Price.Amount
+	case "average_rating":
+		return watch.AverageRating
+	case "review_count":
+		return watch.ReviewCount
+	case "created_at":
+		return watch.CreatedAt
+	case "deleted_at":
+		if watch.DeletedAt == nil {
+			return time.Time{}
+		}
+		return *watch.DeletedAt
+	case "relevance":
+		return watch.Relevance
+	case "id":
+		return watch.ID
+	}
+	panic("unknown sort column: " + column)
+}
+
+// cursor returns the opaque token pointing at the watch's position in a
+// listing ordered by clauses.
+func (watch *Watch) cursor(sort string, clauses []sortClause) string {
+	values := make([]interface{}, len(clauses))
+	for i, clause := range clauses {
+		values[i] = watch.sortValue(clause.column)
+	}
+	return encodeCursor(sort, values)
+}
+
+// watchCursorValues decodes the after or before cursor into values of the
+// same Go types as the watch columns named by clauses.
+func (f Filters) watchCursorValues(clauses []sortClause) ([]interface{}, error) {
+	token := f.After
+	if f.backward() {
+		token = f.Before
+	}
+
+	c, err := decodeCursor(token)
+	if err != nil {
+		return nil, err
+	}
+	if c.Sort != f.Sort || len(c.Values) != len(clauses) {
+		return nil, ErrInvalidCursor
+	}
+
+	var sample Watch
+	values := make([]interface{}, len(clauses))
+
+	for i, clause := range clauses {
+		value := reflect.New(reflect.TypeOf(sample.sortValue(clause.column)))
+		if err := json.Unmarshal(c.Values[i], value.Interface()); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values[i] = value.Elem().Interface()
+	}
+
+	return values, nil
+}
+
+// keysetWatchPage trims the extra row fetched past the page size, restores
+// the requested order of a backward page and fills in the cursors pointing
+// at the neighbouring pages.
+func keysetWatchPage(watches []*Watch, filters Filters, clauses []sortClause) ([]*Watch, Metadata) {
+	hasMore := len(watches) > filters.limit()
+	if hasMore {
+		watches = watches[:filters.limit()]
+	}
+
+	if filters.backward() {
+		for i, j := 0, len(watches)-1; i < j; i, j = i+1, j-1 {
+			watches[i], watches[j] = watches[j], watches[i]
+		}
+	}
+
+	metadata := Metadata{PageSize: filters.PageSize}
+
+	if len(watches) == 0 {
+		return watches, metadata
+	}
+
+	first, last := watches[0], watches[len(watches)-1]
+
+	if filters.backward() {
+		metadata.NextCursor = last.cursor(filters.Sort, clauses)
+		if hasMore {
+			metadata.PrevCursor = first.cursor(filters.Sort, clauses)
+		}
+	} else {
+		metadata.PrevCursor = first.cursor(filters.Sort, clauses)
+		if hasMore {
+			metadata.NextCursor = last.cursor(filters.Sort, clauses)
+		}
+	}
+
+	return watches, metadata
+}
@@ -0,0 +1,532 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type MockWatchModel struct {
+	db *mockDB
+}
+
+func (m MockWatchModel) Insert(ctx context.Context, watch *Watch) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if m.db.skuTaken(watch.SKU, 0) {
+		return ErrDuplicateSKU
+	}
+	if _, ok := m.db.brands[watch.BrandID]; watch.BrandID != 0 && !ok {
+		return errMockForeignKey
+	}
+
+	if err := m.db.linkBrand(watch); err != nil {
+		return err
+	}
+
+	m.db.lastWatchID++
+
+	watch.ID = m.db.lastWatchID
+	watch.CreatedAt = time.Now().Truncate(time.Second)
+	watch.StockQuantity = 0
+	watch.Version = 1
+
+	stored := *watch
+	m.db.watches[watch.ID] = &stored
+
+	m.db.recordPriceChange(ctx, watch.ID)
+
+	return m.db.recordWatchRevision(ctx, watch.ID, RevisionInsert)
+}
+
+func (m MockWatchModel) Get(ctx context.Context, id int64) (*Watch, error) {
+	return m.get(ctx, id, false)
+}
+
+func (m MockWatchModel) GetTrashed(ctx context.Context, id int64) (*Watch, error) {
+	return m.get(ctx, id, true)
+}
+
+func (m MockWatchModel) get(ctx context.Context, id int64, deleted bool) (*Watch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.watches[id]
+	if !ok || (stored.DeletedAt != nil) != deleted {
+		return nil, ErrRecordNotFound
+	}
+
+	watch := *stored
+	return &watch, nil
+}
+
+func (m MockWatchModel) Update(ctx context.Context, watch *Watch) error {
+	return m.update(ctx, watch, RevisionUpdate)
+}
+
+func (m MockWatchModel) Revert(ctx context.Context, watch *Watch) error {
+	return m.update(ctx, watch, RevisionRevert)
+}
+
+func (m MockWatchModel) update(ctx context.Context, watch *Watch, action string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if m.db.skuTaken(watch.SKU, watch.ID) {
+		return ErrDuplicateSKU
+	}
+	if _, ok := m.db.brands[watch.BrandID]; watch.BrandID != 0 && !ok {
+		return errMockForeignKey
+	}
+
+	stored, ok := m.db.watches[watch.ID]
+	if !ok || stored.Version != watch.Version || stored.DeletedAt != nil {
+		return ErrEditConflict
+	}
+
+	if err := m.db.linkBrand(watch); err != nil {
+		return err
+	}
+
+	watch.StockQuantity = stored.StockQuantity
+	watch.Version++
+
+	updated := *watch
+	m.db.watches[watch.ID] = &updated
+
+	m.db.recordPriceChange(ctx, watch.ID)
+	m.db.refreshCartPrices(watch.ID)
+
+	return m.db.recordWatchRevision(ctx, watch.ID, action)
+}
+
+func (m MockWatchModel) Delete(ctx context.Context, id int64, version int32) error {
+	return m.setDeleted(ctx, id, version, true)
+}
+
+func (m MockWatchModel) Restore(ctx context.Context, id int64, version int32) error {
+	return m.setDeleted(ctx, id, version, false)
+}
+
+// setDeleted moves a watch to the trash or back out of it, at the given
+// version unless it is zero.
+func (m MockWatchModel) setDeleted(ctx context.Context, id int64, version int32, deleted bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.watches[id]
+	if !ok || (stored.DeletedAt != nil) == deleted {
+		if version != 0 {
+			return ErrEditConflict
+		}
+		return ErrRecordNotFound
+	}
+	if version != 0 && stored.Version != version {
+		return ErrEditConflict
+	}
+
+	stored.DeletedAt = nil
+	if deleted {
+		now := time.Now().Truncate(time.Second)
+		stored.DeletedAt = &now
+	}
+	stored.Version++
+
+	if deleted {
+		return m.db.recordWatchRevision(ctx, id, RevisionDelete)
+	}
+	return m.db.recordWatchRevision(ctx, id, RevisionRestore)
+}
+
+func (m MockWatchModel) Purge(ctx context.Context, id int64, version int32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.watches[id]
+	if !ok || stored.DeletedAt == nil {
+		if version != 0 {
+			return ErrEditConflict
+		}
+		return ErrRecordNotFound
+	}
+	if version != 0 && stored.Version != version {
+		return ErrEditConflict
+	}
+
+	if m.db.promoted(func(promotion *Promotion) bool { return promotion.WatchID == id }) {
+		return ErrWatchInUse
+	}
+
+	delete(m.db.watches, id)
+
+	// stock_movements, watch_images, watch_revisions, price_history,
+	// wishlist_items, cart_items and reviews cascade on delete.
+	movements := m.db.stockMovements[:0]
+	for _, movement := range m.db.stockMovements {
+		if movement.WatchID != id {
+			movements = append(movements, movement)
+		}
+	}
+	m.db.stockMovements = movements
+
+	for imageID, image := range m.db.watchImages {
+		if image.WatchID == id {
+			delete(m.db.watchImages, imageID)
+		}
+	}
+
+	revisions := m.db.watchRevisions[:0]
+	for _, revision := range m.db.watchRevisions {
+		if revision.WatchID != id {
+			revisions = append(revisions, revision)
+		}
+	}
+	m.db.watchRevisions = revisions
+
+	history := m.db.priceHistory[:0]
+	for _, change := range m.db.priceHistory {
+		if change.WatchID != id {
+			history = append(history, change)
+		}
+	}
+	m.db.priceHistory = history
+
+	items := m.db.wishlistItems[:0]
+	for _, item := range m.db.wishlistItems {
+		if item.WatchID != id {
+			items = append(items, item)
+		}
+	}
+	m.db.wishlistItems = items
+
+	for _, cart := range m.db.carts {
+		cartItems := cart.Items[:0]
+		for _, item := range cart.Items {
+			if item.WatchID != id {
+				cartItems = append(cartItems, item)
+			}
+		}
+		cart.Items = cartItems
+	}
+
+	for reviewID, review := range m.db.reviews {
+		if review.WatchID == id {
+			delete(m.db.reviews, reviewID)
+		}
+	}
+
+	for _, order := range m.db.orders {
+		for _, item := range order.Items {
+			if item.WatchID == id {
+				item.WatchID = 0
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m MockWatchModel) GetAll(ctx context.Context, filter WatchFilter, filters Filters) ([]*Watch, Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	matched := []*Watch{}
+
+	for _, stored := range m.db.watches {
+		if !m.db.watchMatches(stored, filter) {
+			continue
+		}
+
+		watch := *stored
+		watch.Relevance = mockSearchRank(&watch, filter.Search)
+		matched = append(matched, &watch)
+	}
+
+	clauses := filters.sortClauses()
+
+	sort.Slice(matched, func(i, j int) bool {
+		return compareWatches(matched[i], matched[j], clauses) < 0
+	})
+
+	if filters.keyset() {
+		values, err := filters.watchCursorValues(clauses)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		// Read the rows in the direction of the cursor, including one extra
+		// row just as the SQL model does.
+		if filters.backward() {
+			for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+				matched[i], matched[j] = matched[j], matched[i]
+			}
+		}
+
+		page := []*Watch{}
+		for _, watch := range matched {
+			cmp := compareSortValues(watch, values, clauses)
+			if filters.backward() {
+				cmp = -cmp
+			}
+			if cmp > 0 {
+				page = append(page, watch)
+			}
+			if len(page) > filters.limit() {
+				break
+			}
+		}
+
+		watches, metadata := keysetWatchPage(page, filters, clauses)
+		return watches, metadata, nil
+	}
+
+	totalRecords := len(matched)
+
+	start := filters.offset()
+	if start > totalRecords {
+		start = totalRecords
+	}
+	end := start + filters.limit()
+	if end > totalRecords {
+		end = totalRecords
+	}
+
+	// count(*) OVER() is only reported alongside returned rows, so a page past
+	// the end yields empty metadata just like the SQL model.
+	if start == end {
+		totalRecords = 0
+	}
+
+	watches := matched[start:end]
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	if metadata.CurrentPage < metadata.LastPage && len(watches) > 0 {
+		metadata.NextCursor = watches[len(watches)-1].cursor(filters.Sort, clauses)
+	}
+
+	return watches, metadata, nil
+}
+
+// skuTaken reports whether another watch already has the SKU, mirroring the
+// unique index on watches.sku, which ignores watches without one.
+func (db *mockDB) skuTaken(sku string, exceptID int64) bool {
+	if sku == "" {
+		return false
+	}
+	for id, stored := range db.watches {
+		if id != exceptID && stored.SKU == sku {
+			return true
+		}
+	}
+	return false
+}
+
+// watchMatches is the in-memory counterpart of watchFilterCondition. The
+// caller holds db.mu.
+func (db *mockDB) watchMatches(watch *Watch, f WatchFilter) bool {
+	if (watch.DeletedAt != nil) != f.Deleted {
+		return false
+	}
+
+	if len(f.Brands) > 0 {
+		matches := false
+		for _, value := range f.Brands {
+			if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+				matches = matches || watch.BrandID == id
+				continue
+			}
+
+			brand, ok := db.brands[watch.BrandID]
+			matches = matches || ok && brand.Slug == value || mockMatchText(watch.Brand, value)
+		}
+		if !matches {
+			return false
+		}
+	}
+
+	for _, attribute := range []struct {
+		value  string
+		values []string
+	}{
+		{watch.DialColor, f.DialColors},
+		{watch.StrapType, f.StrapTypes},
+		{watch.Energy, f.Energies},
+		{watch.Gender, f.Genders},
+	} {
+		if len(attribute.values) == 0 {
+			continue
+		}
+
+		matches := false
+		for _, value := range attribute.values {
+			matches = matches || mockMatchText(attribute.value, value)
+		}
+		if !matches {
+			return false
+		}
+	}
+
+	if len(f.Diameters) > 0 {
+		matches := false
+		for _, diameter := range f.Diameters {
+			matches = matches || int(watch.Diameter) == diameter
+		}
+		if !matches {
+			return false
+		}
+	}
+
+	switch {
+	case f.DiameterMin > 0 && int(watch.Diameter) < f.DiameterMin:
+		return false
+	case f.DiameterMax > 0 && int(watch.Diameter) > f.DiameterMax:
+		return false
+	case f.PriceMin > 0 && watch.Price.Amount < f.PriceMin:
+		return false
+	case f.PriceMax > 0 && watch.Price.Amount > f.PriceMax:
+		return false
+	case f.InStock != nil && *f.InStock != (watch.StockQuantity > 0):
+		return false
+	case f.RatingMin > 0 && watch.AverageRating < f.RatingMin:
+		return false
+	case searchQuery(f.Search) != "" && mockSearchRank(watch, f.Search) == 0:
+		return false
+	}
+
+	if !f.PriceDroppedSince.IsZero() {
+		then := db.lastPriceChange(watch.ID, f.PriceDroppedSince)
+		if then == nil || watch.Price.Amount >= then.Price.Amount {
+			return false
+		}
+	}
+
+	return true
+}
+
+// mockSearchRank stands in for matching and ranking search_vector against
+// searchQuery(search). Every word of the search has to be a prefix of a word
+// in one of the searched fields, and each match scores the weight of the best
+// field it was found in (A = 1.0, B = 0.4, C = 0.2, as ts_rank weighs them).
+func mockSearchRank(watch *Watch, search string) float32 {
+	fields := []struct {
+		value  string
+		weight float32
+	}{
+		{watch.Brand, 1.0},
+		{watch.Model, 1.0},
+		{watch.DialColor, 0.4},
+		{watch.StrapType, 0.2},
+	}
+
+	var rank float32
+
+	for _, term := range mockWords(search) {
+		var best float32
+		for _, field := range fields {
+			for _, word := range mockWords(field.value) {
+				if strings.HasPrefix(word, term) && field.weight > best {
+					best = field.weight
+				}
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		rank += best
+	}
+
+	return rank
+}
+
+// compareWatches orders two watches by clauses the way ORDER BY would.
+func compareWatches(a, b *Watch, clauses []sortClause) int {
+	values := make([]interface{}, len(clauses))
+	for i, clause := range clauses {
+		values[i] = b.sortValue(clause.column)
+	}
+	return compareSortValues(a, values, clauses)
+}
+
+// compareSortValues orders a watch against the sort key values of another
+// row, taking the direction of every key into account.
+func compareSortValues(watch *Watch, values []interface{}, clauses []sortClause) int {
+	for i, clause := range clauses {
+		cmp := compareValues(watch.sortValue(clause.column), values[i])
+		if clause.descending {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case int64:
+		return compareInt64(a, b.(int64))
+	case int32:
+		return compareInt64(int64(a), int64(b.(int32)))
+	case int8:
+		return compareInt64(int64(a), int64(b.(int8)))
+	case float32:
+		return compareValues(float64(a), float64(b.(float32)))
+	case float64:
+		switch b := b.(float64); {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	}
+	panic(fmt.Sprintf("uncomparable sort value %T", a))
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,246 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"jewelry.abgdrv.com/internal/validator"
+	"time"
+)
+
+var ErrDuplicateWishlistItem = errors.New("duplicate wishlist item")
+
+// WishlistItem is a watch a customer saved to their wishlist. Watches in the
+// trash stay on wishlists but are left out of them until they are restored.
+type WishlistItem struct {
+	Watch   *Watch    `json:"watch"`
+	Note    string    `json:"note"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+func ValidateWishlistNote(v *validator.Validator, note string) {
+	v.Check(len(note) <= 500, "note", "must not be more than 500 bytes long")
+}
+
+type WishlistModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// GetAll lists the wishlist of a user a page at a time.
+func (m WishlistModel) GetAll(ctx context.Context, userID int64, filters Filters) ([]*WishlistItem, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), note, added_at, %s, 0::real
+	FROM wishlist_items
+	INNER JOIN watches ON watches.id = wishlist_items.watch_id
+	WHERE wishlist_items.user_id = $1 AND watches.deleted_at IS NULL
+	ORDER BY %s
+	LIMIT $2 OFFSET $3`, watchListColumns, orderBy(filters.sortClauses(), false))
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	items := []*WishlistItem{}
+
+	for rows.Next() {
+		item := WishlistItem{Watch: &Watch{}}
+
+		err := rows.Scan(append([]interface{}{&totalRecords, &item.Note, &item.AddedAt}, item.Watch.listScanDest()...)...)
+		if err != nil {
+			return nil, Metadata{}, contextError(ctx, err)
+		}
+
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	return items, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m WishlistModel) Get(ctx context.Context, userID, watchID int64) (*WishlistItem, error) {
+	query := fmt.Sprintf(`
+	SELECT note, added_at, %s, 0::real
+	FROM wishlist_items
+	INNER JOIN watches ON watches.id = wishlist_items.watch_id
+	WHERE wishlist_items.user_id = $1 AND wishlist_items.watch_id = $2 AND watches.deleted_at IS NULL`, watchListColumns)
+
+	item := WishlistItem{Watch: &Watch{}}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, watchID).Scan(
+		append([]interface{}{&item.Note, &item.AddedAt}, item.Watch.listScanDest()...)...,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return &item, nil
+}
+
+// Add saves a watch to the wishlist of a user. It returns ErrRecordNotFound
+// if there is no such watch outside the trash.
+func (m WishlistModel) Add(ctx context.Context, userID, watchID int64, note string) error {
+	query := `
+	INSERT INTO wishlist_items (user_id, watch_id, note)
+	SELECT $1, id, $3 FROM watches WHERE id = $2 AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, watchID, note)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "wishlist_items_pkey"`:
+			return ErrDuplicateWishlistItem
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m WishlistModel) UpdateNote(ctx context.Context, userID, watchID int64, note string) error {
+	query := `UPDATE wishlist_items SET note = $3 WHERE user_id = $1 AND watch_id = $2`
+
+	return m.execOne(ctx, query, userID, watchID, note)
+}
+
+func (m WishlistModel) Remove(ctx context.Context, userID, watchID int64) error {
+	query := `DELETE FROM wishlist_items WHERE user_id = $1 AND watch_id = $2`
+
+	return m.execOne(ctx, query, userID, watchID)
+}
+
+// Share makes the wishlist of a user readable by anyone with the returned
+// token, replacing any token it was shared with before. Only the hash of the
+// token is stored, so it cannot be shown again.
+func (m WishlistModel) Share(ctx context.Context, userID int64) (string, error) {
+	plaintext, hash, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+	INSERT INTO wishlist_shares (user_id, hash)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET hash = EXCLUDED.hash, created_at = NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, userID, hash)
+	if err != nil {
+		return "", contextError(ctx, err)
+	}
+
+	return plaintext, nil
+}
+
+// Unshare stops sharing the wishlist of a user, returning ErrRecordNotFound
+// if it was not shared.
+func (m WishlistModel) Unshare(ctx context.Context, userID int64) error {
+	query := `DELETE FROM wishlist_shares WHERE user_id = $1`
+
+	return m.execOne(ctx, query, userID)
+}
+
+func (m WishlistModel) IsShared(ctx context.Context, userID int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM wishlist_shares WHERE user_id = $1)`
+
+	var shared bool
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&shared)
+	return shared, contextError(ctx, err)
+}
+
+// GetOwnerForShareToken returns the user whose wishlist is shared with the
+// token.
+func (m WishlistModel) GetOwnerForShareToken(ctx context.Context, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	SELECT users.id, users.created_at, users.name, users.email, users.activated, users.version
+	FROM users
+	INNER JOIN wishlist_shares
+	ON users.id = wishlist_shares.user_id
+	WHERE wishlist_shares.hash = $1`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:]).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return &user, nil
+}
+
+// execOne runs a statement, returning ErrRecordNotFound if no row was
+// affected.
+func (m WishlistModel) execOne(ctx context.Context, query string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
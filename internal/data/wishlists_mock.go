@@ -0,0 +1,249 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"sort"
+	"time"
+)
+
+type MockWishlistModel struct {
+	db *mockDB
+}
+
+// mockWishlistItem is a row of wishlist_items.
+type mockWishlistItem struct {
+	UserID  int64
+	WatchID int64
+	Note    string
+	AddedAt time.Time
+}
+
+func (m MockWishlistModel) GetAll(ctx context.Context, userID int64, filters Filters) ([]*WishlistItem, Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	items := []*WishlistItem{}
+
+	for _, stored := range m.db.wishlistItems {
+		if item := m.db.wishlistItem(stored); stored.UserID == userID && item != nil {
+			items = append(items, item)
+		}
+	}
+
+	clauses := filters.sortClauses()
+
+	sort.Slice(items, func(i, j int) bool {
+		for _, clause := range clauses {
+			var cmp int
+			switch clause.column {
+			case "added_at":
+				cmp = items[i].AddedAt.Compare(items[j].AddedAt)
+			case "price":
+				cmp = compareInt64(items[i].Watch.Price.Amount, items[j].Watch.Price.Amount)
+			default:
+				cmp = compareInt64(items[i].Watch.ID, items[j].Watch.ID)
+			}
+			if clause.descending {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+
+	totalRecords := len(items)
+
+	start := filters.offset()
+	if start > totalRecords {
+		start = totalRecords
+	}
+	end := start + filters.limit()
+	if end > totalRecords {
+		end = totalRecords
+	}
+
+	if start == end {
+		totalRecords = 0
+	}
+
+	return items[start:end], calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m MockWishlistModel) Get(ctx context.Context, userID, watchID int64) (*WishlistItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for _, stored := range m.db.wishlistItems {
+		if stored.UserID == userID && stored.WatchID == watchID {
+			if item := m.db.wishlistItem(stored); item != nil {
+				return item, nil
+			}
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m MockWishlistModel) Add(ctx context.Context, userID, watchID int64, note string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	watch, ok := m.db.watches[watchID]
+	if !ok || watch.DeletedAt != nil {
+		return ErrRecordNotFound
+	}
+
+	if _, ok := m.db.users[userID]; !ok {
+		return errMockForeignKey
+	}
+
+	for _, stored := range m.db.wishlistItems {
+		if stored.UserID == userID && stored.WatchID == watchID {
+			return ErrDuplicateWishlistItem
+		}
+	}
+
+	m.db.wishlistItems = append(m.db.wishlistItems, &mockWishlistItem{
+		UserID:  userID,
+		WatchID: watchID,
+		Note:    note,
+		AddedAt: time.Now().Truncate(time.Second),
+	})
+
+	return nil
+}
+
+func (m MockWishlistModel) UpdateNote(ctx context.Context, userID, watchID int64, note string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for _, stored := range m.db.wishlistItems {
+		if stored.UserID == userID && stored.WatchID == watchID {
+			stored.Note = note
+			return nil
+		}
+	}
+
+	return ErrRecordNotFound
+}
+
+func (m MockWishlistModel) Remove(ctx context.Context, userID, watchID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for i, stored := range m.db.wishlistItems {
+		if stored.UserID == userID && stored.WatchID == watchID {
+			m.db.wishlistItems = append(m.db.wishlistItems[:i], m.db.wishlistItems[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrRecordNotFound
+}
+
+func (m MockWishlistModel) Share(ctx context.Context, userID int64) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	plaintext, hash, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.users[userID]; !ok {
+		return "", errMockForeignKey
+	}
+
+	m.db.wishlistShares[userID] = string(hash)
+
+	return plaintext, nil
+}
+
+func (m MockWishlistModel) Unshare(ctx context.Context, userID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.wishlistShares[userID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.db.wishlistShares, userID)
+
+	return nil
+}
+
+func (m MockWishlistModel) IsShared(ctx context.Context, userID int64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	_, ok := m.db.wishlistShares[userID]
+	return ok, nil
+}
+
+func (m MockWishlistModel) GetOwnerForShareToken(ctx context.Context, tokenPlaintext string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for userID, hash := range m.db.wishlistShares {
+		if hash == string(tokenHash[:]) {
+			user := *m.db.users[userID]
+			return &user, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+// wishlistItem joins a wishlist row with its watch, returning nil while the
+// watch is in the trash.
+func (db *mockDB) wishlistItem(stored *mockWishlistItem) *WishlistItem {
+	watch, ok := db.watches[stored.WatchID]
+	if !ok || watch.DeletedAt != nil {
+		return nil
+	}
+
+	copied := *watch
+
+	return &WishlistItem{Watch: &copied, Note: stored.Note, AddedAt: stored.AddedAt}
+}
@@ -0,0 +1,380 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Operation is one operation of a JSON Patch.
+type Operation struct {
+	Op   string
+	Path string
+	From string
+
+	path  []string
+	from  []string
+	value interface{}
+}
+
+// JSONPatch is a JSON Patch: a list of operations applied in order. If any
+// of them fails, the patch as a whole fails.
+type JSONPatch []Operation
+
+// ParseJSONPatch parses a JSON Patch, checking that every operation has the
+// members its op requires and that its pointers are well formed.
+func ParseJSONPatch(b []byte) (JSONPatch, error) {
+	var raw []struct {
+		Op    string           `json:"op"`
+		Path  *string          `json:"path"`
+		From  *string          `json:"from"`
+		Value *json.RawMessage `json:"value"`
+	}
+
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, errors.New("the patch must be a JSON array of operations")
+	}
+
+	p := make(JSONPatch, len(raw))
+
+	for i, r := range raw {
+		op := &p[i]
+		op.Op = r.Op
+
+		switch r.Op {
+		case "add", "remove", "replace", "move", "copy", "test":
+		default:
+			return nil, fmt.Errorf("operation %d: op must be one of add, remove, replace, move, copy or test", i)
+		}
+
+		if r.Path == nil {
+			return nil, fmt.Errorf("operation %d: path must be provided", i)
+		}
+		op.Path = *r.Path
+
+		var err error
+		if op.path, err = parsePointer(op.Path); err != nil {
+			return nil, fmt.Errorf("operation %d: path %w", i, err)
+		}
+
+		switch r.Op {
+		case "add", "replace", "test":
+			if r.Value == nil {
+				return nil, fmt.Errorf("operation %d: value must be provided", i)
+			}
+			if op.value, err = Decode(*r.Value); err != nil {
+				return nil, fmt.Errorf("operation %d: value is not valid JSON", i)
+			}
+
+		case "move", "copy":
+			if r.From == nil {
+				return nil, fmt.Errorf("operation %d: from must be provided", i)
+			}
+			op.From = *r.From
+
+			if op.from, err = parsePointer(op.From); err != nil {
+				return nil, fmt.Errorf("operation %d: from %w", i, err)
+			}
+			if r.Op == "move" && isPrefix(op.from, op.path) && len(op.from) < len(op.path) {
+				return nil, fmt.Errorf("operation %d: a value cannot be moved into one of its children", i)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+func (p JSONPatch) Apply(doc interface{}) (interface{}, error) {
+	var err error
+
+	for i := range p {
+		op := &p[i]
+
+		doc, err = op.apply(doc)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return doc, nil
+}
+
+func (op *Operation) apply(doc interface{}) (interface{}, error) {
+	switch op.Op {
+	case "add":
+		return add(doc, op.path, deepCopy(op.value))
+
+	case "remove":
+		return remove(doc, op.path)
+
+	case "replace":
+		if _, err := get(doc, op.path); err != nil {
+			return nil, err
+		}
+		doc, err := remove(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, deepCopy(op.value))
+
+	case "move":
+		value, err := get(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		doc, err = remove(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, value)
+
+	case "copy":
+		value, err := get(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, deepCopy(value))
+
+	case "test":
+		value, err := get(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(value, op.value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its reference tokens.
+// The empty pointer refers to the whole document.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("must be a JSON Pointer starting with a slash")
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		if strings.Contains(strings.NewReplacer("~0", "", "~1", "").Replace(token), "~") {
+			return nil, errors.New("must only use ~ in the escapes ~0 and ~1")
+		}
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+func isPrefix(prefix, tokens []string) bool {
+	if len(prefix) > len(tokens) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != tokens[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayIndex parses the reference token of an array element. Only indexes
+// up to max are valid.
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("%q is not an array index", token)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i > max {
+		return 0, fmt.Errorf("array index %s is out of bounds", token)
+	}
+
+	return i, nil
+}
+
+func get(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("cannot refer to %q inside a value that is not an object or array", token)
+		}
+	}
+
+	return doc, nil
+}
+
+// update descends to the parent of the location tokens refer to, replaces
+// it with what fn returns for it and returns the updated document.
+func update(doc interface{}, tokens []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[tokens[0]]
+		if !ok {
+			return nil, fmt.Errorf("member %q does not exist", tokens[0])
+		}
+		child, err := update(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[tokens[0]] = child
+		return node, nil
+
+	case []interface{}:
+		i, err := arrayIndex(tokens[0], len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := update(node[i], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+
+	default:
+		return nil, fmt.Errorf("cannot refer to %q inside a value that is not an object or array", tokens[0])
+	}
+}
+
+func add(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return update(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+
+		case []interface{}:
+			if token == "-" {
+				return append(node, value), nil
+			}
+			i, err := arrayIndex(token, len(node))
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+
+		default:
+			return nil, fmt.Errorf("cannot add %q to a value that is not an object or array", token)
+		}
+	})
+}
+
+func remove(doc interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("the whole document cannot be removed")
+	}
+
+	return update(doc, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := node[token]; !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			delete(node, token)
+			return node, nil
+
+		case []interface{}:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:i], node[i+1:]...), nil
+
+		default:
+			return nil, fmt.Errorf("cannot remove %q from a value that is not an object or array", token)
+		}
+	})
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for name, member := range v {
+			object[name] = deepCopy(member)
+		}
+		return object
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for i, element := range v {
+			array[i] = deepCopy(element)
+		}
+		return array
+	default:
+		return value
+	}
+}
+
+// equal compares two JSON values the way the test operation does: numbers
+// by their value rather than how they are written.
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for name, member := range a {
+			other, ok := b[name]
+			if !ok || !equal(member, other) {
+				return false
+			}
+		}
+		return true
+
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, okX := new(big.Rat).SetString(a.String())
+		y, okY := new(big.Rat).SetString(b.String())
+		return okX && okY && x.Cmp(y) == 0
+
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,47 @@
+package patch
+
+import "errors"
+
+// MergePatch is a JSON Merge Patch: an object whose members replace those of
+// the document, recursively for objects, and whose null members remove them.
+type MergePatch struct {
+	value interface{}
+}
+
+// ParseMergePatch parses a merge patch. Any JSON value is a valid one,
+// although anything but an object replaces the whole document.
+func ParseMergePatch(b []byte) (*MergePatch, error) {
+	value, err := Decode(b)
+	if err != nil {
+		return nil, errors.New("the patch is not valid JSON")
+	}
+
+	return &MergePatch{value: value}, nil
+}
+
+func (p *MergePatch) Apply(doc interface{}) (interface{}, error) {
+	return merge(doc, p.value), nil
+}
+
+// merge implements the MergePatch algorithm of RFC 7396.
+func merge(target, patch interface{}) interface{} {
+	members, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	object, ok := target.(map[string]interface{})
+	if !ok {
+		object = make(map[string]interface{})
+	}
+
+	for name, value := range members {
+		if value == nil {
+			delete(object, name)
+			continue
+		}
+		object[name] = merge(object[name], value)
+	}
+
+	return object
+}
@@ -0,0 +1,159 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to values that have a JSON encoding.
+//
+// A patch is never applied to a Go value directly. The value is encoded, the
+// patch is applied to its JSON document and the result is decoded into a new
+// value, so that every field is patched the same way whatever its type, and
+// a member set to null or removed by the patch comes out as a zero value.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"reflect"
+	"strings"
+)
+
+// The media types of the patch formats. A plain JSON body is read as a merge
+// patch, which is what partial updates sent as application/json always were.
+const (
+	MediaTypeMergePatch = "application/merge-patch+json"
+	MediaTypeJSONPatch  = "application/json-patch+json"
+)
+
+var (
+	ErrUnsupportedMediaType = errors.New("unsupported patch media type")
+	// ErrTestFailed is returned when a test operation of a JSON Patch does
+	// not hold, in which case nothing of the patch is applied.
+	ErrTestFailed = errors.New("test operation failed")
+)
+
+// Patch is a parsed patch document.
+type Patch interface {
+	// Apply returns the document patched, as decoded by Decode. The
+	// document may be modified in place.
+	Apply(doc interface{}) (interface{}, error)
+}
+
+// Parse parses a patch document of the given content type, which is read as
+// a merge patch if it is empty or application/json.
+func Parse(contentType string, body []byte) (Patch, error) {
+	mediaType := "application/json"
+	if contentType != "" {
+		var err error
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, ErrUnsupportedMediaType
+		}
+	}
+
+	switch mediaType {
+	case MediaTypeMergePatch, "application/json":
+		return ParseMergePatch(body)
+	case MediaTypeJSONPatch:
+		return ParseJSONPatch(body)
+	default:
+		return nil, ErrUnsupportedMediaType
+	}
+}
+
+// Decode decodes a JSON document into the generic form patches are applied
+// to, keeping numbers as written.
+func Decode(b []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// ReadOnlyError is returned by Apply when the patch changes a member that
+// must not be changed.
+type ReadOnlyError struct {
+	Member string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("%q cannot be changed", e.Member)
+}
+
+// ResultError is returned by Apply when the patched document cannot be
+// decoded into the destination value.
+type ResultError struct {
+	Err error
+}
+
+func (e *ResultError) Error() string {
+	var typeError *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(e.Err, &typeError) && typeError.Field != "":
+		return fmt.Sprintf("the patched document contains incorrect JSON type for field %q", typeError.Field)
+	case strings.HasPrefix(e.Err.Error(), "json: unknown field "):
+		return "the patched document contains unknown key " + strings.TrimPrefix(e.Err.Error(), "json: unknown field ")
+	case errors.As(e.Err, &typeError):
+		return "the patched document must be a JSON object"
+	default:
+		return "the patched document is invalid: " + e.Err.Error()
+	}
+}
+
+func (e *ResultError) Unwrap() error {
+	return e.Err
+}
+
+// Apply applies p to the JSON encoding of src and decodes the result into
+// dst, which should point to a zero value: fields that are not part of the
+// encoding are left as they are in dst rather than copied from src. The
+// top-level members named in readOnly must come out of the patch unchanged.
+func Apply(p Patch, src, dst interface{}, readOnly ...string) error {
+	js, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+
+	original, err := Decode(js)
+	if err != nil {
+		return err
+	}
+
+	doc, err := Decode(js)
+	if err != nil {
+		return err
+	}
+
+	doc, err = p.Apply(doc)
+	if err != nil {
+		return err
+	}
+
+	before, _ := original.(map[string]interface{})
+	after, _ := doc.(map[string]interface{})
+
+	for _, member := range readOnly {
+		if !reflect.DeepEqual(before[member], after[member]) {
+			return &ReadOnlyError{Member: member}
+		}
+	}
+
+	js, err = json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		return &ResultError{Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,413 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// applyTo parses doc and p, applies p and returns the result encoded again.
+func applyTo(t *testing.T, p Patch, doc string) (string, error) {
+	t.Helper()
+
+	value, err := Decode([]byte(doc))
+	if err != nil {
+		t.Fatalf("bad document %s: %v", doc, err)
+	}
+
+	value, err = p.Apply(value)
+	if err != nil {
+		return "", err
+	}
+
+	js, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(js), nil
+}
+
+// sameJSON reports whether a and b encode the same value.
+func sameJSON(t *testing.T, a, b string) bool {
+	t.Helper()
+
+	var x, y interface{}
+	if err := json.Unmarshal([]byte(a), &x); err != nil {
+		t.Fatalf("bad JSON %s: %v", a, err)
+	}
+	if err := json.Unmarshal([]byte(b), &y); err != nil {
+		t.Fatalf("bad JSON %s: %v", b, err)
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// The examples of appendix A of RFC 7396.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc   string
+		patch string
+		want  string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.doc+" "+tt.patch, func(t *testing.T) {
+			p, err := ParseMergePatch([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("ParseMergePatch: %v", err)
+			}
+
+			got, err := applyTo(t, p, tt.doc)
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+
+			if !sameJSON(t, got, tt.want) {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Mostly the examples of appendix A of RFC 6902.
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		patch    string
+		want     string
+		wantErr  bool
+		testFail bool
+	}{
+		{
+			name:  "add an object member",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz","value":"qux"}]`,
+			want:  `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			name:  "add an array element",
+			doc:   `{"foo":["bar","baz"]}`,
+			patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			want:  `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:  "append to an array",
+			doc:   `{"foo":["bar"]}`,
+			patch: `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			want:  `{"foo":["bar",["abc","def"]]}`,
+		},
+		{
+			name:  "remove an object member",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"remove","path":"/baz"}]`,
+			want:  `{"foo":"bar"}`,
+		},
+		{
+			name:  "remove an array element",
+			doc:   `{"foo":["bar","qux","baz"]}`,
+			patch: `[{"op":"remove","path":"/foo/1"}]`,
+			want:  `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:  "replace a value",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			want:  `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:  "move a value",
+			doc:   `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			want:  `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:  "move an array element",
+			doc:   `{"foo":["all","grass","cows","eat"]}`,
+			patch: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			want:  `{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			name:  "copy a value",
+			doc:   `{"foo":{"bar":1}}`,
+			patch: `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"replace","path":"/baz/bar","value":2}]`,
+			want:  `{"foo":{"bar":1},"baz":{"bar":2}}`,
+		},
+		{
+			name:  "test a value",
+			doc:   `{"baz":"qux","foo":["a",2,"c"]}`,
+			patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			want:  `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			name:  "test numbers by value",
+			doc:   `{"price":"1.50","diameter":40}`,
+			patch: `[{"op":"test","path":"/diameter","value":40.0}]`,
+			want:  `{"price":"1.50","diameter":40}`,
+		},
+		{
+			name:  "escaped pointer",
+			doc:   `{"/":9,"~1":10}`,
+			patch: `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`,
+			want:  `{"~1":10}`,
+		},
+		{
+			name:    "add to a missing parent",
+			doc:     `{"foo":"bar"}`,
+			patch:   `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "remove a missing member",
+			doc:     `{"foo":"bar"}`,
+			patch:   `[{"op":"remove","path":"/baz"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "replace a missing member",
+			doc:     `{"foo":"bar"}`,
+			patch:   `[{"op":"replace","path":"/baz","value":1}]`,
+			wantErr: true,
+		},
+		{
+			name:    "array index out of bounds",
+			doc:     `{"foo":["bar"]}`,
+			patch:   `[{"op":"add","path":"/foo/2","value":"baz"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "array index with a leading zero",
+			doc:     `{"foo":["bar","baz"]}`,
+			patch:   `[{"op":"remove","path":"/foo/01"}]`,
+			wantErr: true,
+		},
+		{
+			name:     "test a different value",
+			doc:      `{"baz":"qux"}`,
+			patch:    `[{"op":"test","path":"/baz","value":"bar"}]`,
+			wantErr:  true,
+			testFail: true,
+		},
+		{
+			name:     "test a number against a string",
+			doc:      `{"foo":"10"}`,
+			patch:    `[{"op":"test","path":"/foo","value":10}]`,
+			wantErr:  true,
+			testFail: true,
+		},
+		{
+			name:     "failed test after a change",
+			doc:      `{"foo":"bar"}`,
+			patch:    `[{"op":"replace","path":"/foo","value":"baz"},{"op":"test","path":"/foo","value":"bar"}]`,
+			wantErr:  true,
+			testFail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseJSONPatch([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("ParseJSONPatch: %v", err)
+			}
+
+			got, err := applyTo(t, p, tt.doc)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s; want an error", got)
+				}
+				if errors.Is(err, ErrTestFailed) != tt.testFail {
+					t.Errorf("err = %v; ErrTestFailed %v", err, tt.testFail)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+
+			if !sameJSON(t, got, tt.want) {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSONPatchInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{"not an array", `{"op":"add","path":"/a","value":1}`},
+		{"unknown op", `[{"op":"increment","path":"/a","value":1}]`},
+		{"missing path", `[{"op":"remove"}]`},
+		{"relative path", `[{"op":"remove","path":"a"}]`},
+		{"bad escape", `[{"op":"remove","path":"/a~2"}]`},
+		{"missing value", `[{"op":"add","path":"/a"}]`},
+		{"missing from", `[{"op":"copy","path":"/a"}]`},
+		{"move into a child", `[{"op":"move","from":"/a","path":"/a/b"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseJSONPatch([]byte(tt.patch)); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		want        interface{}
+		wantErr     error
+	}{
+		{"", `{"a":1}`, &MergePatch{}, nil},
+		{"application/json", `{"a":1}`, &MergePatch{}, nil},
+		{"application/merge-patch+json; charset=utf-8", `{"a":1}`, &MergePatch{}, nil},
+		{"application/json-patch+json", `[]`, JSONPatch{}, nil},
+		{"text/plain", `{"a":1}`, nil, ErrUnsupportedMediaType},
+		{"application/", `{"a":1}`, nil, ErrUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			p, err := Parse(tt.contentType, []byte(tt.body))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v; want %v", err, tt.wantErr)
+			}
+			if tt.want != nil && reflect.TypeOf(p) != reflect.TypeOf(tt.want) {
+				t.Errorf("got a %T; want a %T", p, tt.want)
+			}
+		})
+	}
+}
+
+type watch struct {
+	ID      int64  `json:"id"`
+	Brand   string `json:"brand"`
+	Model   string `json:"model,omitempty"`
+	Version int32  `json:"version"`
+}
+
+func TestApply(t *testing.T) {
+	src := watch{ID: 1, Brand: "Omega", Model: "Seamaster", Version: 3}
+
+	tests := []struct {
+		name         string
+		contentType  string
+		patch        string
+		want         watch
+		wantReadOnly string
+		wantResult   bool
+		wantTest     bool
+	}{
+		{
+			name:  "merge patch",
+			patch: `{"brand":"Seiko"}`,
+			want:  watch{ID: 1, Brand: "Seiko", Model: "Seamaster", Version: 3},
+		},
+		{
+			name:  "merge patch removing a member",
+			patch: `{"model":null}`,
+			want:  watch{ID: 1, Brand: "Omega", Version: 3},
+		},
+		{
+			name:  "read-only member set to its value",
+			patch: `{"id":1,"brand":"Seiko"}`,
+			want:  watch{ID: 1, Brand: "Seiko", Model: "Seamaster", Version: 3},
+		},
+		{
+			name:         "read-only member changed",
+			patch:        `{"id":2}`,
+			wantReadOnly: "id",
+		},
+		{
+			name:         "read-only member removed",
+			patch:        `{"version":null}`,
+			wantReadOnly: "version",
+		},
+		{
+			name:        "json patch",
+			contentType: MediaTypeJSONPatch,
+			patch:       `[{"op":"test","path":"/version","value":3},{"op":"replace","path":"/model","value":"Speedmaster"}]`,
+			want:        watch{ID: 1, Brand: "Omega", Model: "Speedmaster", Version: 3},
+		},
+		{
+			name:        "json patch with a failed test",
+			contentType: MediaTypeJSONPatch,
+			patch:       `[{"op":"replace","path":"/model","value":"Speedmaster"},{"op":"test","path":"/version","value":2}]`,
+			wantTest:    true,
+		},
+		{
+			name:         "json patch moving into a read-only member",
+			contentType:  MediaTypeJSONPatch,
+			patch:        `[{"op":"copy","from":"/version","path":"/id"}]`,
+			wantReadOnly: "id",
+		},
+		{
+			name:       "unknown member",
+			patch:      `{"colour":"red"}`,
+			wantResult: true,
+		},
+		{
+			name:       "wrong type",
+			patch:      `{"brand":5}`,
+			wantResult: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.contentType, []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			var dst watch
+
+			err = Apply(p, src, &dst, "id", "version")
+
+			var readOnlyErr *ReadOnlyError
+			var resultErr *ResultError
+
+			switch {
+			case tt.wantReadOnly != "":
+				if !errors.As(err, &readOnlyErr) || readOnlyErr.Member != tt.wantReadOnly {
+					t.Errorf("err = %v; want %q to be read-only", err, tt.wantReadOnly)
+				}
+			case tt.wantResult:
+				if !errors.As(err, &resultErr) {
+					t.Errorf("err = %v; want a *ResultError", err)
+				}
+			case tt.wantTest:
+				if !errors.Is(err, ErrTestFailed) {
+					t.Errorf("err = %v; want ErrTestFailed", err)
+				}
+			case err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case dst != tt.want:
+				t.Errorf("got %+v; want %+v", dst, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package payments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Fake is a Provider that runs in-process, for development and tests. It
+// authorizes every intent, and delivers the events of captures and refunds
+// signed with the webhook secret through the deliver function it was given.
+type Fake struct {
+	secret  string
+	deliver func(payload []byte, signature string)
+
+	mu      sync.Mutex
+	intents map[string]*Intent
+}
+
+// NewFake returns a fake provider. deliver is called with every event and
+// its signature header, and is expected to post them to the webhook.
+func NewFake(secret string, deliver func(payload []byte, signature string)) *Fake {
+	return &Fake{
+		secret:  secret,
+		deliver: deliver,
+		intents: make(map[string]*Intent),
+	}
+}
+
+func (f *Fake) CreateIntent(ctx context.Context, amount int64, currency, reference string) (*Intent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	id, err := randomID("pi_fake_")
+	if err != nil {
+		return nil, err
+	}
+
+	intent := &Intent{
+		ID:        id,
+		Amount:    amount,
+		Currency:  currency,
+		Reference: reference,
+		Status:    IntentRequiresCapture,
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stored := *intent
+	f.intents[id] = &stored
+
+	return intent, nil
+}
+
+// Capture collects an authorized intent and delivers a succeeded event.
+func (f *Fake) Capture(ctx context.Context, intentID string) (*Intent, error) {
+	return f.move(ctx, intentID, IntentRequiresCapture, IntentSucceeded, EventIntentSucceeded)
+}
+
+// Refund pays back a captured intent and delivers a refunded event.
+func (f *Fake) Refund(ctx context.Context, intentID string) (*Intent, error) {
+	return f.move(ctx, intentID, IntentSucceeded, IntentRefunded, EventIntentRefunded)
+}
+
+// move changes the status of an intent from one to another and delivers an
+// event of the given type.
+func (f *Fake) move(ctx context.Context, intentID, from, to, eventType string) (*Intent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+
+	stored, ok := f.intents[intentID]
+	if !ok {
+		f.mu.Unlock()
+		return nil, ErrIntentNotFound
+	}
+
+	if stored.Status != from {
+		f.mu.Unlock()
+		return nil, ErrInvalidState
+	}
+
+	stored.Status = to
+	intent := *stored
+
+	f.mu.Unlock()
+
+	err := f.emit(eventType, intent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &intent, nil
+}
+
+func (f *Fake) emit(eventType string, intent Intent) error {
+	if f.deliver == nil {
+		return nil
+	}
+
+	id, err := randomID("evt_fake_")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	payload, err := json.Marshal(Event{ID: id, Type: eventType, CreatedAt: now.UTC().Truncate(time.Second), Intent: intent})
+	if err != nil {
+		return err
+	}
+
+	f.deliver(payload, Sign(f.secret, now, payload))
+
+	return nil
+}
+
+func randomID(prefix string) (string, error) {
+	b := make([]byte, 12)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + hex.EncodeToString(b), nil
+}
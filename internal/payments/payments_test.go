@@ -0,0 +1,59 @@
+package payments
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	const secret = "whsec_test"
+
+	now := time.Unix(1_700_000_000, 0)
+	payload := []byte(`{"id":"evt_1","type":"payment_intent.succeeded"}`)
+	tolerance := 5 * time.Minute
+
+	valid := Sign(secret, now, payload)
+	signature := valid[strings.Index(valid, "v1="):]
+
+	tests := []struct {
+		name    string
+		header  string
+		payload []byte
+		wantErr bool
+	}{
+		{name: "valid", header: valid},
+		{name: "signed in the past within tolerance", header: Sign(secret, now.Add(-tolerance), payload)},
+		{name: "signed in the future within tolerance", header: Sign(secret, now.Add(tolerance), payload)},
+		{name: "signed too long ago", header: Sign(secret, now.Add(-tolerance-time.Second), payload), wantErr: true},
+		{name: "signed too far ahead", header: Sign(secret, now.Add(tolerance+time.Second), payload), wantErr: true},
+		{name: "spaces and extra members", header: " t=1700000000 , v0=abc, " + signature + " "},
+		{name: "one of several signatures", header: "t=1700000000,v1=00ff," + signature},
+		{name: "other secret", header: Sign("whsec_other", now, payload), wantErr: true},
+		{name: "tampered payload", header: valid, payload: []byte(`{"id":"evt_2","type":"payment_intent.succeeded"}`), wantErr: true},
+		{name: "timestamp swapped", header: "t=1700000001," + signature, wantErr: true},
+		{name: "no timestamp", header: signature, wantErr: true},
+		{name: "bad timestamp", header: "t=soon," + signature, wantErr: true},
+		{name: "no signature", header: "t=1700000000", wantErr: true},
+		{name: "signature not hex", header: "t=1700000000,v1=" + strings.Repeat("z", 64), wantErr: true},
+		{name: "empty", header: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.payload == nil {
+				tt.payload = payload
+			}
+
+			err := Verify(secret, tt.header, tt.payload, tolerance, now)
+
+			switch {
+			case tt.wantErr && !errors.Is(err, ErrInvalidSignature):
+				t.Errorf("err = %v; want ErrInvalidSignature", err)
+			case !tt.wantErr && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
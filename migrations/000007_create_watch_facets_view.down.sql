@@ -0,0 +1 @@
+DROP MATERIALIZED VIEW IF EXISTS watch_facets;
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS watches_search_vector_idx;
+ALTER TABLE watches DROP COLUMN IF EXISTS search_vector;
\ No newline at end of file
@@ -0,0 +1,9 @@
+ALTER TABLE watches ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce(brand, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(model, '')), 'A') ||
+        setweight(to_tsvector('simple', dial_color), 'B') ||
+        setweight(to_tsvector('simple', strap_type), 'C')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS watches_search_vector_idx ON watches USING GIN (search_vector);
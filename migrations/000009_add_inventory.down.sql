@@ -0,0 +1,6 @@
+DELETE FROM permissions WHERE code = 'inventory:write';
+DROP TABLE IF EXISTS stock_movements;
+DROP INDEX IF EXISTS watches_sku_idx;
+ALTER TABLE watches DROP CONSTRAINT IF EXISTS watches_stock_quantity_check;
+ALTER TABLE watches DROP COLUMN IF EXISTS stock_quantity;
+ALTER TABLE watches DROP COLUMN IF EXISTS sku;
\ No newline at end of file
@@ -0,0 +1,28 @@
+ALTER TABLE watches ADD COLUMN IF NOT EXISTS sku text NULL;
+ALTER TABLE watches ADD COLUMN IF NOT EXISTS stock_quantity integer NOT NULL DEFAULT 0;
+
+ALTER TABLE watches ADD CONSTRAINT watches_stock_quantity_check CHECK ( stock_quantity >= 0 );
+
+CREATE UNIQUE INDEX IF NOT EXISTS watches_sku_idx ON watches (sku);
+
+-- Append-only ledger: rows are never updated, and the latest balance of a
+-- watch always equals watches.stock_quantity.
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    watch_id bigint NOT NULL REFERENCES watches ON DELETE CASCADE,
+    kind text NOT NULL,
+    quantity integer NOT NULL,
+    balance integer NOT NULL,
+    note text NOT NULL DEFAULT '',
+    user_id bigint NULL REFERENCES users ON DELETE SET NULL,
+    CONSTRAINT stock_movements_kind_check CHECK ( kind IN ('receipt', 'sale', 'adjustment', 'return') )
+);
+
+CREATE INDEX IF NOT EXISTS stock_movements_watch_id_idx ON stock_movements (watch_id, id);
+
+GRANT ALL PRIVILEGES ON stock_movements TO watch_admin;
+GRANT ALL PRIVILEGES ON SEQUENCE stock_movements_id_seq TO watch_admin;
+
+INSERT INTO permissions (code)
+VALUES ('inventory:write');
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS watch_images;
\ No newline at end of file
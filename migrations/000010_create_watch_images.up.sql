@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS watch_images (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    watch_id bigint NOT NULL REFERENCES watches ON DELETE CASCADE,
+    position integer NOT NULL,
+    is_primary boolean NOT NULL DEFAULT false,
+    content_type text NOT NULL,
+    width integer NOT NULL,
+    height integer NOT NULL,
+    size bigint NOT NULL,
+    image_key text NOT NULL,
+    url text NOT NULL,
+    thumbnail_key text NOT NULL,
+    thumbnail_url text NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS watch_images_watch_id_idx ON watch_images (watch_id, position);
+
+-- At most one primary image per watch; watches.image_url mirrors its url.
+CREATE UNIQUE INDEX IF NOT EXISTS watch_images_primary_idx ON watch_images (watch_id) WHERE is_primary;
+
+GRANT ALL PRIVILEGES ON watch_images TO watch_admin;
+GRANT ALL PRIVILEGES ON SEQUENCE watch_images_id_seq TO watch_admin;
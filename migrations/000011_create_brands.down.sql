@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code = 'brands:write';
+ALTER TABLE watches DROP COLUMN IF EXISTS brand_id;
+DROP TABLE IF EXISTS brands;
\ No newline at end of file
@@ -0,0 +1,50 @@
+CREATE TABLE IF NOT EXISTS brands (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    slug text NOT NULL,
+    country text NOT NULL DEFAULT '',
+    description text NOT NULL DEFAULT '',
+    logo_url text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT brands_slug_key UNIQUE (slug)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS brands_name_idx ON brands (lower(name));
+
+GRANT ALL PRIVILEGES ON brands TO watch_admin;
+GRANT ALL PRIVILEGES ON SEQUENCE brands_id_seq TO watch_admin;
+
+-- One brand per spelling that differs only in case or surrounding spaces,
+-- named after the most common of those spellings. Names that slugify alike
+-- get a numeric suffix.
+WITH spellings AS (
+    SELECT btrim(brand) AS name, count(*) AS n
+    FROM watches
+    WHERE btrim(brand) <> ''
+    GROUP BY btrim(brand)
+), canonical AS (
+    SELECT DISTINCT ON (lower(name)) name
+    FROM spellings
+    ORDER BY lower(name), n DESC, name
+), slugged AS (
+    SELECT name,
+           COALESCE(NULLIF(btrim(regexp_replace(lower(name), '[^a-z0-9]+', '-', 'g'), '-'), ''), 'brand') AS slug
+    FROM canonical
+)
+INSERT INTO brands (name, slug)
+SELECT name, CASE WHEN rn = 1 THEN slug ELSE slug || '-' || rn END
+FROM (SELECT name, slug, row_number() OVER (PARTITION BY slug ORDER BY name) AS rn FROM slugged) AS numbered;
+
+ALTER TABLE watches ADD COLUMN IF NOT EXISTS brand_id bigint NULL REFERENCES brands ON DELETE RESTRICT;
+
+-- watches.brand stays as a copy of the brand's name for search and facets.
+UPDATE watches
+SET brand_id = brands.id, brand = brands.name
+FROM brands
+WHERE lower(btrim(watches.brand)) = lower(brands.name);
+
+CREATE INDEX IF NOT EXISTS watches_brand_id_idx ON watches (brand_id);
+
+INSERT INTO permissions (code)
+VALUES ('brands:write');
@@ -0,0 +1,33 @@
+DELETE FROM permissions WHERE code = 'watches:purge';
+
+DROP MATERIALIZED VIEW IF EXISTS watch_facets;
+
+ALTER TABLE watches DROP COLUMN IF EXISTS deleted_at;
+
+-- Price ranges must match priceBuckets in internal/data/facets.go.
+CREATE MATERIALIZED VIEW IF NOT EXISTS watch_facets AS
+    SELECT 'brand' AS facet, brand AS value, count(*) AS count FROM watches WHERE brand IS NOT NULL GROUP BY brand
+    UNION ALL
+    SELECT 'dial_color', dial_color, count(*) FROM watches GROUP BY dial_color
+    UNION ALL
+    SELECT 'strap_type', strap_type, count(*) FROM watches GROUP BY strap_type
+    UNION ALL
+    SELECT 'energy', energy, count(*) FROM watches GROUP BY energy
+    UNION ALL
+    SELECT 'gender', gender, count(*) FROM watches GROUP BY gender
+    UNION ALL
+    SELECT 'diameter', diameter::text, count(*) FROM watches GROUP BY diameter
+    UNION ALL
+    SELECT 'price',
+           CASE WHEN price < 500 THEN '0-500'
+                WHEN price < 1000 THEN '500-1000'
+                WHEN price < 5000 THEN '1000-5000'
+                WHEN price < 10000 THEN '5000-10000'
+                ELSE '10000+' END,
+           count(*)
+    FROM watches GROUP BY 2;
+
+-- REFRESH MATERIALIZED VIEW CONCURRENTLY requires a unique index.
+CREATE UNIQUE INDEX IF NOT EXISTS watch_facets_facet_value_idx ON watch_facets (facet, value);
+
+ALTER MATERIALIZED VIEW watch_facets OWNER TO watch_admin;
\ No newline at end of file
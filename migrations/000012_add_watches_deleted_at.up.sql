@@ -0,0 +1,38 @@
+ALTER TABLE watches ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone NULL;
+
+CREATE INDEX IF NOT EXISTS watches_deleted_at_idx ON watches (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Facet counts only cover watches that are not in the trash.
+DROP MATERIALIZED VIEW IF EXISTS watch_facets;
+
+-- Price ranges must match priceBuckets in internal/data/facets.go.
+CREATE MATERIALIZED VIEW IF NOT EXISTS watch_facets AS
+    WITH live AS (SELECT * FROM watches WHERE deleted_at IS NULL)
+    SELECT 'brand' AS facet, brand AS value, count(*) AS count FROM live WHERE brand IS NOT NULL GROUP BY brand
+    UNION ALL
+    SELECT 'dial_color', dial_color, count(*) FROM live GROUP BY dial_color
+    UNION ALL
+    SELECT 'strap_type', strap_type, count(*) FROM live GROUP BY strap_type
+    UNION ALL
+    SELECT 'energy', energy, count(*) FROM live GROUP BY energy
+    UNION ALL
+    SELECT 'gender', gender, count(*) FROM live GROUP BY gender
+    UNION ALL
+    SELECT 'diameter', diameter::text, count(*) FROM live GROUP BY diameter
+    UNION ALL
+    SELECT 'price',
+           CASE WHEN price < 500 THEN '0-500'
+                WHEN price < 1000 THEN '500-1000'
+                WHEN price < 5000 THEN '1000-5000'
+                WHEN price < 10000 THEN '5000-10000'
+                ELSE '10000+' END,
+           count(*)
+    FROM live GROUP BY 2;
+
+-- REFRESH MATERIALIZED VIEW CONCURRENTLY requires a unique index.
+CREATE UNIQUE INDEX IF NOT EXISTS watch_facets_facet_value_idx ON watch_facets (facet, value);
+
+ALTER MATERIALIZED VIEW watch_facets OWNER TO watch_admin;
+
+INSERT INTO permissions (code)
+VALUES ('watches:purge');
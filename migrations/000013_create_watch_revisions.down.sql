@@ -0,0 +1 @@
+DROP TABLE IF EXISTS watch_revisions;
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS watch_revisions (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    watch_id bigint NOT NULL REFERENCES watches ON DELETE CASCADE,
+    version integer NOT NULL,
+    action text NOT NULL,
+    user_id bigint NULL REFERENCES users ON DELETE SET NULL,
+    snapshot jsonb NOT NULL,
+    changes jsonb NOT NULL DEFAULT '{}',
+    CONSTRAINT watch_revisions_watch_id_version_key UNIQUE (watch_id, version),
+    CONSTRAINT watch_revisions_action_check CHECK ( action IN ('insert', 'update', 'delete', 'restore', 'revert') )
+);
+
+GRANT ALL PRIVILEGES ON watch_revisions TO watch_admin;
+GRANT ALL PRIVILEGES ON SEQUENCE watch_revisions_id_seq TO watch_admin;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS price_history (
+    id bigserial PRIMARY KEY,
+    changed_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    watch_id bigint NOT NULL REFERENCES watches ON DELETE CASCADE,
+    price float NOT NULL,
+    previous_price float NULL,
+    user_id bigint NULL REFERENCES users ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS price_history_watch_id_changed_at_idx ON price_history (watch_id, changed_at);
+
+-- Existing watches start their history with the price they have now.
+INSERT INTO price_history (changed_at, watch_id, price)
+SELECT created_at, id, price FROM watches;
+
+GRANT ALL PRIVILEGES ON price_history TO watch_admin;
+GRANT ALL PRIVILEGES ON SEQUENCE price_history_id_seq TO watch_admin;
@@ -0,0 +1,56 @@
+DELETE FROM permissions WHERE code = 'currencies:write';
+
+DROP TABLE IF EXISTS currency_rates;
+
+DROP MATERIALIZED VIEW IF EXISTS watch_facets;
+
+UPDATE watch_revisions
+SET changes = jsonb_set(changes, '{price}', jsonb_build_object(
+        'from', CASE WHEN jsonb_typeof(changes->'price'->'from') = 'object'
+                     THEN to_jsonb((changes->'price'->'from'->>'amount')::numeric)
+                     ELSE 'null'::jsonb END,
+        'to', CASE WHEN jsonb_typeof(changes->'price'->'to') = 'object'
+                   THEN to_jsonb((changes->'price'->'to'->>'amount')::numeric)
+                   ELSE 'null'::jsonb END))
+WHERE changes ? 'price';
+
+UPDATE watch_revisions
+SET snapshot = jsonb_set(snapshot, '{price}', to_jsonb((snapshot->'price'->>'amount')::numeric))
+WHERE jsonb_typeof(snapshot->'price') = 'object';
+
+ALTER TABLE price_history DROP COLUMN IF EXISTS previous_currency;
+ALTER TABLE price_history DROP COLUMN IF EXISTS currency;
+ALTER TABLE price_history ALTER COLUMN previous_price TYPE float USING previous_price / 100.0;
+ALTER TABLE price_history ALTER COLUMN price TYPE float USING price / 100.0;
+
+ALTER TABLE watches DROP COLUMN IF EXISTS currency;
+ALTER TABLE watches ALTER COLUMN price TYPE float USING price / 100.0;
+
+-- Price ranges must match priceBuckets in internal/data/facets.go.
+CREATE MATERIALIZED VIEW IF NOT EXISTS watch_facets AS
+    WITH live AS (SELECT * FROM watches WHERE deleted_at IS NULL)
+    SELECT 'brand' AS facet, brand AS value, count(*) AS count FROM live WHERE brand IS NOT NULL GROUP BY brand
+    UNION ALL
+    SELECT 'dial_color', dial_color, count(*) FROM live GROUP BY dial_color
+    UNION ALL
+    SELECT 'strap_type', strap_type, count(*) FROM live GROUP BY strap_type
+    UNION ALL
+    SELECT 'energy', energy, count(*) FROM live GROUP BY energy
+    UNION ALL
+    SELECT 'gender', gender, count(*) FROM live GROUP BY gender
+    UNION ALL
+    SELECT 'diameter', diameter::text, count(*) FROM live GROUP BY diameter
+    UNION ALL
+    SELECT 'price',
+           CASE WHEN price < 500 THEN '0-500'
+                WHEN price < 1000 THEN '500-1000'
+                WHEN price < 5000 THEN '1000-5000'
+                WHEN price < 10000 THEN '5000-10000'
+                ELSE '10000+' END,
+           count(*)
+    FROM live GROUP BY 2;
+
+-- REFRESH MATERIALIZED VIEW CONCURRENTLY requires a unique index.
+CREATE UNIQUE INDEX IF NOT EXISTS watch_facets_facet_value_idx ON watch_facets (facet, value);
+
+ALTER MATERIALIZED VIEW watch_facets OWNER TO watch_admin;
\ No newline at end of file
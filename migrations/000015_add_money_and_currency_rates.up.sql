@@ -0,0 +1,72 @@
+-- Prices become whole numbers of minor units of their currency. Existing
+-- prices are in the catalog currency, USD, whose minor unit is the cent.
+DROP MATERIALIZED VIEW IF EXISTS watch_facets;
+
+ALTER TABLE watches DROP CONSTRAINT IF EXISTS watches_price_check;
+ALTER TABLE watches ALTER COLUMN price TYPE bigint USING round(price * 100);
+ALTER TABLE watches ADD CONSTRAINT watches_price_check CHECK ( price > 0 );
+ALTER TABLE watches ADD COLUMN IF NOT EXISTS currency char(3) NOT NULL DEFAULT 'USD';
+
+ALTER TABLE price_history ALTER COLUMN price TYPE bigint USING round(price * 100);
+ALTER TABLE price_history ALTER COLUMN previous_price TYPE bigint USING round(previous_price * 100);
+ALTER TABLE price_history ADD COLUMN IF NOT EXISTS currency char(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE price_history ADD COLUMN IF NOT EXISTS previous_currency char(3) NULL;
+UPDATE price_history SET previous_currency = 'USD' WHERE previous_price IS NOT NULL;
+
+-- Revisions store prices the way the API writes them.
+UPDATE watch_revisions
+SET snapshot = jsonb_set(snapshot, '{price}', jsonb_build_object(
+        'amount', round((snapshot->>'price')::numeric, 2)::text, 'currency', 'USD'))
+WHERE jsonb_typeof(snapshot->'price') = 'number';
+
+UPDATE watch_revisions
+SET changes = jsonb_set(changes, '{price}', jsonb_build_object(
+        'from', CASE WHEN jsonb_typeof(changes->'price'->'from') = 'number'
+                     THEN jsonb_build_object('amount', round((changes->'price'->>'from')::numeric, 2)::text, 'currency', 'USD')
+                     ELSE 'null'::jsonb END,
+        'to', CASE WHEN jsonb_typeof(changes->'price'->'to') = 'number'
+                   THEN jsonb_build_object('amount', round((changes->'price'->>'to')::numeric, 2)::text, 'currency', 'USD')
+                   ELSE 'null'::jsonb END))
+WHERE changes ? 'price';
+
+-- Price ranges must match priceBuckets in internal/data/facets.go.
+CREATE MATERIALIZED VIEW IF NOT EXISTS watch_facets AS
+    WITH live AS (SELECT * FROM watches WHERE deleted_at IS NULL)
+    SELECT 'brand' AS facet, brand AS value, count(*) AS count FROM live WHERE brand IS NOT NULL GROUP BY brand
+    UNION ALL
+    SELECT 'dial_color', dial_color, count(*) FROM live GROUP BY dial_color
+    UNION ALL
+    SELECT 'strap_type', strap_type, count(*) FROM live GROUP BY strap_type
+    UNION ALL
+    SELECT 'energy', energy, count(*) FROM live GROUP BY energy
+    UNION ALL
+    SELECT 'gender', gender, count(*) FROM live GROUP BY gender
+    UNION ALL
+    SELECT 'diameter', diameter::text, count(*) FROM live GROUP BY diameter
+    UNION ALL
+    SELECT 'price',
+           CASE WHEN price < 50000 THEN '0-500'
+                WHEN price < 100000 THEN '500-1000'
+                WHEN price < 500000 THEN '1000-5000'
+                WHEN price < 1000000 THEN '5000-10000'
+                ELSE '10000+' END,
+           count(*)
+    FROM live GROUP BY 2;
+
+-- REFRESH MATERIALIZED VIEW CONCURRENTLY requires a unique index.
+CREATE UNIQUE INDEX IF NOT EXISTS watch_facets_facet_value_idx ON watch_facets (facet, value);
+
+ALTER MATERIALIZED VIEW watch_facets OWNER TO watch_admin;
+
+-- rate is the number of units of the currency one US dollar is worth.
+CREATE TABLE IF NOT EXISTS currency_rates (
+    currency char(3) PRIMARY KEY,
+    rate numeric(20, 10) NOT NULL,
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CONSTRAINT currency_rates_rate_check CHECK ( rate > 0 )
+);
+
+GRANT ALL PRIVILEGES ON currency_rates TO watch_admin;
+
+INSERT INTO permissions (code)
+VALUES ('currencies:write');
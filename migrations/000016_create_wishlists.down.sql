@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE code = 'wishlist:write';
+
+DROP TABLE IF EXISTS wishlist_shares;
+DROP TABLE IF EXISTS wishlist_items;
\ No newline at end of file
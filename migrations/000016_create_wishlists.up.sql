@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS wishlist_items (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    watch_id bigint NOT NULL REFERENCES watches ON DELETE CASCADE,
+    note text NOT NULL DEFAULT '',
+    added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, watch_id)
+);
+
+CREATE INDEX IF NOT EXISTS wishlist_items_watch_id_idx ON wishlist_items (watch_id);
+
+-- A shared wishlist can be read by anyone with the token whose hash is kept
+-- here. Sharing again replaces the token, and stopping deletes the row.
+CREATE TABLE IF NOT EXISTS wishlist_shares (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    hash bytea NOT NULL UNIQUE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+GRANT ALL PRIVILEGES ON wishlist_items TO watch_admin;
+GRANT ALL PRIVILEGES ON wishlist_shares TO watch_admin;
+
+INSERT INTO permissions (code)
+VALUES ('wishlist:write');
+
+-- Customers registered before wishlists get the permission new ones are
+-- granted along with watches:read.
+INSERT INTO users_permissions
+SELECT users_permissions.user_id, (SELECT id FROM permissions WHERE code = 'wishlist:write')
+FROM users_permissions
+INNER JOIN permissions ON permissions.id = users_permissions.permission_id
+WHERE permissions.code = 'watches:read'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,27 @@
+-- A cart belongs to a user or, while user_id is NULL, to the guest holding
+-- the signed token naming its id.
+CREATE TABLE IF NOT EXISTS carts (
+    id bigserial PRIMARY KEY,
+    user_id bigint UNIQUE REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+-- unit_price and currency are a snapshot of the price of the watch, kept up
+-- to date whenever the price changes.
+CREATE TABLE IF NOT EXISTS cart_items (
+    cart_id bigint NOT NULL REFERENCES carts ON DELETE CASCADE,
+    watch_id bigint NOT NULL REFERENCES watches ON DELETE CASCADE,
+    quantity integer NOT NULL,
+    unit_price bigint NOT NULL,
+    currency char(3) NOT NULL,
+    added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (cart_id, watch_id),
+    CONSTRAINT cart_items_quantity_check CHECK ( quantity > 0 )
+);
+
+CREATE INDEX IF NOT EXISTS cart_items_watch_id_idx ON cart_items (watch_id);
+
+GRANT ALL PRIVILEGES ON carts TO watch_admin;
+GRANT ALL PRIVILEGES ON SEQUENCE carts_id_seq TO watch_admin;
+GRANT ALL PRIVILEGES ON cart_items TO watch_admin;
@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE code = 'orders:manage';
+
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS orders;
\ No newline at end of file
@@ -0,0 +1,42 @@
+-- An order is placed from the cart of a user. email is where its emails go,
+-- taken from the user when the order is placed.
+CREATE TABLE IF NOT EXISTS orders (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    email citext NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    shipping_address text NOT NULL,
+    tracking_number text NOT NULL DEFAULT '',
+    total bigint NOT NULL,
+    currency char(3) NOT NULL,
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT orders_status_check CHECK ( status IN ('pending', 'paid', 'shipped', 'delivered', 'cancelled', 'refunded') )
+);
+
+CREATE INDEX IF NOT EXISTS orders_user_id_idx ON orders (user_id);
+CREATE INDEX IF NOT EXISTS orders_status_idx ON orders (status);
+
+-- brand, model, unit_price and currency are a snapshot of the watch when the
+-- order was placed. watch_id is cleared if the watch is purged.
+CREATE TABLE IF NOT EXISTS order_items (
+    order_id bigint NOT NULL REFERENCES orders ON DELETE CASCADE,
+    watch_id bigint REFERENCES watches ON DELETE SET NULL,
+    brand text NOT NULL,
+    model text NOT NULL,
+    quantity integer NOT NULL,
+    unit_price bigint NOT NULL,
+    currency char(3) NOT NULL,
+    CONSTRAINT order_items_quantity_check CHECK ( quantity > 0 )
+);
+
+CREATE INDEX IF NOT EXISTS order_items_order_id_idx ON order_items (order_id);
+CREATE INDEX IF NOT EXISTS order_items_watch_id_idx ON order_items (watch_id);
+
+GRANT ALL PRIVILEGES ON orders TO watch_admin;
+GRANT ALL PRIVILEGES ON SEQUENCE orders_id_seq TO watch_admin;
+GRANT ALL PRIVILEGES ON order_items TO watch_admin;
+
+INSERT INTO permissions (code)
+VALUES ('orders:manage');
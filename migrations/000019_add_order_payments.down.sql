@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS payment_events;
+DROP INDEX IF EXISTS orders_payment_intent_id_idx;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_payment_status_check;
+ALTER TABLE orders DROP COLUMN IF EXISTS payment_status;
+ALTER TABLE orders DROP COLUMN IF EXISTS payment_intent_id;
\ No newline at end of file
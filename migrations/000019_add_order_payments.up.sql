@@ -0,0 +1,17 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_intent_id text NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_status text NOT NULL DEFAULT 'unpaid';
+
+ALTER TABLE orders ADD CONSTRAINT orders_payment_status_check CHECK ( payment_status IN ('unpaid', 'processing', 'paid', 'failed', 'refunded') );
+
+CREATE UNIQUE INDEX IF NOT EXISTS orders_payment_intent_id_idx ON orders (payment_intent_id);
+
+-- Every webhook event applied to an order, so that a delivery the provider
+-- retries is only applied once.
+CREATE TABLE IF NOT EXISTS payment_events (
+    id text PRIMARY KEY,
+    order_id bigint NOT NULL REFERENCES orders ON DELETE CASCADE,
+    type text NOT NULL,
+    received_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+GRANT ALL PRIVILEGES ON payment_events TO watch_admin;
@@ -0,0 +1,6 @@
+DELETE FROM permissions WHERE code = 'reviews:moderate';
+
+DROP TABLE IF EXISTS reviews;
+DROP INDEX IF EXISTS watches_average_rating_idx;
+ALTER TABLE watches DROP COLUMN IF EXISTS review_count;
+ALTER TABLE watches DROP COLUMN IF EXISTS average_rating;
\ No newline at end of file
@@ -0,0 +1,30 @@
+-- average_rating and review_count cover the approved reviews of a watch and
+-- are kept up to date by every write to them.
+ALTER TABLE watches ADD COLUMN IF NOT EXISTS average_rating numeric(3, 2) NOT NULL DEFAULT 0;
+ALTER TABLE watches ADD COLUMN IF NOT EXISTS review_count integer NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS watches_average_rating_idx ON watches (average_rating);
+
+CREATE TABLE IF NOT EXISTS reviews (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    watch_id bigint NOT NULL REFERENCES watches ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    rating smallint NOT NULL,
+    title text NOT NULL,
+    body text NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT reviews_rating_check CHECK ( rating BETWEEN 1 AND 5 ),
+    CONSTRAINT reviews_status_check CHECK ( status IN ('pending', 'approved', 'rejected') ),
+    CONSTRAINT reviews_watch_id_user_id_key UNIQUE (watch_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS reviews_status_idx ON reviews (status, created_at);
+
+GRANT ALL PRIVILEGES ON reviews TO watch_admin;
+GRANT ALL PRIVILEGES ON SEQUENCE reviews_id_seq TO watch_admin;
+
+INSERT INTO permissions (code)
+VALUES ('reviews:moderate');
@@ -0,0 +1,6 @@
+DELETE FROM permissions WHERE code = 'promotions:write';
+
+ALTER TABLE orders DROP COLUMN IF EXISTS discount;
+ALTER TABLE orders DROP COLUMN IF EXISTS promotion_code;
+DROP TABLE IF EXISTS promotion_redemptions;
+DROP TABLE IF EXISTS promotions;
\ No newline at end of file
@@ -0,0 +1,58 @@
+-- A promotion takes percent_off percent or amount_off off the watches it
+-- targets: those of brand_id, the watch watch_id, or every watch when both
+-- are null. max_redemptions and max_redemptions_per_user are unlimited at 0.
+-- The brand or watch of a promotion cannot be deleted while it exists.
+CREATE TABLE IF NOT EXISTS promotions (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    code citext NOT NULL,
+    description text NOT NULL DEFAULT '',
+    kind text NOT NULL,
+    percent_off integer NOT NULL DEFAULT 0,
+    amount_off bigint NOT NULL DEFAULT 0,
+    min_order bigint NOT NULL DEFAULT 0,
+    currency char(3) NOT NULL,
+    brand_id bigint REFERENCES brands ON DELETE RESTRICT,
+    watch_id bigint REFERENCES watches ON DELETE RESTRICT,
+    max_redemptions integer NOT NULL DEFAULT 0,
+    max_redemptions_per_user integer NOT NULL DEFAULT 0,
+    redemption_count integer NOT NULL DEFAULT 0,
+    starts_at timestamp(0) with time zone,
+    ends_at timestamp(0) with time zone,
+    active boolean NOT NULL DEFAULT true,
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT promotions_code_key UNIQUE (code),
+    CONSTRAINT promotions_kind_check CHECK ( kind IN ('percentage', 'fixed') ),
+    CONSTRAINT promotions_percent_off_check CHECK ( percent_off BETWEEN 0 AND 100 ),
+    CONSTRAINT promotions_target_check CHECK ( brand_id IS NULL OR watch_id IS NULL ),
+    CONSTRAINT promotions_redemption_count_check CHECK ( max_redemptions = 0 OR redemption_count <= max_redemptions )
+);
+
+CREATE INDEX IF NOT EXISTS promotions_brand_id_idx ON promotions (brand_id);
+CREATE INDEX IF NOT EXISTS promotions_watch_id_idx ON promotions (watch_id);
+
+-- Every order placed with a promotion. A redemption is removed again when its
+-- order is cancelled; a promotion that has any is deactivated rather than
+-- deleted.
+CREATE TABLE IF NOT EXISTS promotion_redemptions (
+    order_id bigint PRIMARY KEY REFERENCES orders ON DELETE CASCADE,
+    promotion_id bigint NOT NULL REFERENCES promotions ON DELETE RESTRICT,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    discount bigint NOT NULL,
+    redeemed_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS promotion_redemptions_promotion_id_user_id_idx ON promotion_redemptions (promotion_id, user_id);
+
+-- promotion_code and discount are a snapshot of the promotion an order was
+-- placed with. total is what is left after the discount.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS promotion_code text NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS discount bigint NOT NULL DEFAULT 0;
+
+GRANT ALL PRIVILEGES ON promotions TO watch_admin;
+GRANT ALL PRIVILEGES ON SEQUENCE promotions_id_seq TO watch_admin;
+GRANT ALL PRIVILEGES ON promotion_redemptions TO watch_admin;
+
+INSERT INTO permissions (code)
+VALUES ('promotions:write');